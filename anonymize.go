@@ -0,0 +1,501 @@
+package main
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	hd "hdfs-fsimage-parse-go/pkg/hadoop_hdfs"
+	pb "hdfs-fsimage-parse-go/pkg/hadoop_hdfs_fsimage"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// Kinds of anonymized strings. Each kind has its own pseudonyms, so a
+// user and a directory of the same name are not linked.
+const (
+	anonName   = "name" // path components, snapshot names
+	anonUser   = "user"
+	anonGroup  = "group"
+	anonXAttr  = "xattr" // names of user and trusted xattrs
+	anonPool   = "pool"
+	anonClient = "client" // DFSClient names and machines of open files
+)
+
+var anonPrefixes = map[string]string{
+	anonName: "n", anonUser: "user", anonGroup: "group", anonXAttr: "attr", anonPool: "pool", anonClient: "client",
+}
+
+// anonBase32 is lower-case base32 without padding, safe in HDFS names.
+var anonBase32 = base32.NewEncoding("abcdefghijklmnopqrstuvwxyz234567").WithPadding(base32.NoPadding)
+
+type AnonymizeOptions struct {
+	Mode           string // hash or pseudonym
+	Salt           string
+	KeepExtensions bool
+	PreserveLength bool
+	KeepNames      string
+	KeepPrincipals string
+	Mapping        string
+}
+
+// runAnonymize implements the `anonymize` subcommand.
+func runAnonymize(args []string) {
+	fs := flag.NewFlagSet("anonymize", flag.ExitOnError)
+	var opts AnonymizeOptions
+	fs.StringVar(&opts.Mode, "mode", "hash", "hash: salted HMAC of each name; pseudonym: numbered names in inode id order")
+	fs.StringVar(&opts.Salt, "salt", "", "secret for -mode hash; the same salt gives the same names again (default: random)")
+	fs.BoolVar(&opts.KeepExtensions, "keep-extensions", false, "keep file name extensions such as .parquet")
+	fs.BoolVar(&opts.PreserveLength, "preserve-length", false, "give path components pseudonyms of their original length")
+	fs.StringVar(&opts.KeepNames, "keep-names", "user,tmp,.Trash,Current", "comma-separated path components kept as they are")
+	fs.StringVar(&opts.KeepPrincipals, "keep-principals", "hdfs,supergroup", "comma-separated users and groups kept as they are")
+	fs.StringVar(&opts.Mapping, "mapping", "", "write the original to anonymized mapping to this file (keep it private)")
+	registerParseFlags(fs)
+	registerLogFlags(fs)
+	fs.Usage = commandUsage(fs, "[flags] <fsimage> <output>",
+		"Path names, users, groups and user/trusted xattrs are replaced consistently,",
+		"delegation tokens and keys are dropped. Ids, sizes, times and blocks are kept.")
+	parseArgs(fs, args, 2)
+
+	a, err := newAnonymizer(opts)
+	logIfErr(err)
+
+	f, sectionMap, err := openImage(fs.Arg(0))
+	logIfErr(err)
+	defer f.Close()
+	img, err := loadImage(f, sectionMap)
+	logIfErr(err)
+	if parseReport.Total() > 0 {
+		parseReport.Log()
+		log.Fatalf("not writing %s: corrupt records were skipped", fs.Arg(1))
+	}
+
+	logIfErr(a.anonymizeImage(img, f))
+	logIfErr(writeImageFile(fs.Arg(1), img))
+	if opts.Mapping != "" {
+		logIfErr(a.writeMapping(opts.Mapping))
+	}
+	infof("wrote %s: %d names, %d users, %d groups, %d xattr names anonymized", fs.Arg(1),
+		len(a.mapped[anonName]), len(a.mapped[anonUser]), len(a.mapped[anonGroup]), len(a.mapped[anonXAttr]))
+}
+
+// anonymizer maps strings to pseudonyms, one-to-one within each kind so
+// that names stay unique within their directory.
+type anonymizer struct {
+	opts      AnonymizeOptions
+	salt      []byte
+	keep      map[string]map[string]bool
+	mapped    map[string]map[string]string
+	taken     map[string]map[string]bool
+	counters  map[string]int
+	roles     map[uint32]string // unmasked STRING_TABLE ids by first use
+	sysXAttrs map[uint32]bool   // xattr name ids used outside user and trusted
+}
+
+func newAnonymizer(opts AnonymizeOptions) (*anonymizer, error) {
+	if opts.Mode != "hash" && opts.Mode != "pseudonym" {
+		return nil, fmt.Errorf("unknown -mode %q (want hash or pseudonym)", opts.Mode)
+	}
+	a := &anonymizer{
+		opts:      opts,
+		salt:      []byte(opts.Salt),
+		keep:      make(map[string]map[string]bool),
+		mapped:    make(map[string]map[string]string),
+		taken:     make(map[string]map[string]bool),
+		counters:  make(map[string]int),
+		roles:     make(map[uint32]string),
+		sysXAttrs: make(map[uint32]bool),
+	}
+	if opts.Mode == "hash" && opts.Salt == "" {
+		a.salt = make([]byte, 16)
+		if _, err := rand.Read(a.salt); err != nil {
+			return nil, err
+		}
+		infof("using a random salt, pass -salt to get the same names again")
+	}
+	for kind := range anonPrefixes {
+		a.keep[kind] = make(map[string]bool)
+		a.mapped[kind] = make(map[string]string)
+		a.taken[kind] = make(map[string]bool)
+	}
+	for _, name := range splitList(opts.KeepNames) {
+		a.keep[anonName][name] = true
+		a.taken[anonName][name] = true
+	}
+	for _, name := range splitList(opts.KeepPrincipals) {
+		for _, kind := range []string{anonUser, anonGroup} {
+			a.keep[kind][name] = true
+			a.taken[kind][name] = true
+		}
+	}
+	return a, nil
+}
+
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// anonymize returns the pseudonym of s.
+func (a *anonymizer) anonymize(kind, s string) string {
+	if s == "" || a.keep[kind][s] {
+		return s
+	}
+	if p, ok := a.mapped[kind][s]; ok {
+		return p
+	}
+	base, ext := s, ""
+	if kind == anonName && a.opts.KeepExtensions {
+		if i := strings.LastIndexByte(s, '.'); i > 0 && len(s)-i <= 10 {
+			base, ext = s[:i], s[i:]
+		}
+	}
+	length := 0
+	if kind == anonName && a.opts.PreserveLength {
+		length = len(base)
+	}
+	for attempt := 0; ; attempt++ {
+		// short names run out of pseudonyms of their length
+		p := a.pseudonym(kind, base, attempt, length+attempt/64) + ext
+		if !a.taken[kind][p] {
+			a.taken[kind][p] = true
+			a.mapped[kind][s] = p
+			return p
+		}
+	}
+}
+
+// pseudonym is one candidate for base, length characters long unless
+// length is 0.
+func (a *anonymizer) pseudonym(kind, base string, attempt, length int) string {
+	if a.opts.Mode == "pseudonym" {
+		a.counters[kind]++
+		n := a.counters[kind]
+		if length == 0 {
+			return anonPrefixes[kind] + strconv.Itoa(n)
+		}
+		p := strconv.FormatInt(int64(n), 36)
+		if len(p) < length {
+			p = strings.Repeat("x", length-len(p)) + p
+		}
+		return p[len(p)-length:]
+	}
+
+	var out []byte
+	mac := hmac.New(sha256.New, a.salt)
+	for block := uint32(0); len(out) == 0 || (length > 0 && len(out) < length); block++ {
+		mac.Reset()
+		fmt.Fprintf(mac, "%s\x00%s\x00%d\x00", kind, base, attempt)
+		binary.Write(mac, binary.BigEndian, block)
+		out = anonBase32.AppendEncode(out, mac.Sum(nil))
+	}
+	if length == 0 {
+		return anonPrefixes[kind] + string(out[:10])
+	}
+	return string(out[:length])
+}
+
+// anonymizePath replaces every component of a path, relative or not.
+func (a *anonymizer) anonymizePath(p string) string {
+	parts := strings.Split(p, "/")
+	for i, part := range parts {
+		if part != "." && part != ".." {
+			parts[i] = a.anonymize(anonName, part)
+		}
+	}
+	return strings.Join(parts, "/")
+}
+
+// anonymizeValue replaces an xattr value with keyed hash bytes of the
+// same length.
+func (a *anonymizer) anonymizeValue(v []byte) []byte {
+	if len(v) == 0 {
+		return v
+	}
+	out := make([]byte, 0, len(v))
+	mac := hmac.New(sha256.New, a.salt)
+	for block := uint32(0); len(out) < len(v); block++ {
+		mac.Reset()
+		mac.Write(v)
+		binary.Write(mac, binary.BigEndian, block)
+		out = mac.Sum(out)
+	}
+	return out[:len(v)]
+}
+
+// noteRole records how an unmasked STRING_TABLE id is used; images
+// written before the expanded string table share one id space.
+func (a *anonymizer) noteRole(id uint32, role string) {
+	if _, ok := a.roles[id]; !ok {
+		a.roles[id] = role
+	}
+}
+
+func (a *anonymizer) notePermission(perm uint64) {
+	a.noteRole(uint32(perm>>40), anonUser)
+	a.noteRole(uint32(perm>>16)&0xFFFFFF, anonGroup)
+}
+
+func (a *anonymizer) anonymizeAcl(acl *pb.INodeSection_AclFeatureProto) {
+	for _, e := range acl.GetEntries() {
+		if name := (e >> 6) & 0xFFFFFF; name != 0 {
+			switch (e >> 3) & 3 {
+			case 0:
+				a.noteRole(name, anonUser)
+			case 1:
+				a.noteRole(name, anonGroup)
+			}
+		}
+	}
+}
+
+// anonymizeXAttrs replaces the values of user and trusted xattrs. The
+// names are replaced in the STRING_TABLE; names in the other namespaces
+// belong to HDFS and are kept, as are their values, which the namenode
+// needs (encryption zones, erasure coding policies).
+func (a *anonymizer) anonymizeXAttrs(xattrs *pb.INodeSection_XAttrFeatureProto) {
+	for _, x := range xattrs.GetXAttrs() {
+		nameId := (x.GetName() >> 6) & 0xFFFFFF
+		switch decodeXAttr(x).Namespace {
+		case "user", "trusted":
+			a.noteRole(nameId, anonXAttr)
+			x.Value = a.anonymizeValue(x.GetValue())
+		default:
+			a.sysXAttrs[nameId] = true
+			if decodeXAttr(x).FullName() == cryptoXAttrEncryptionZone {
+				x.Value = a.anonymizeZoneInfo(x.GetValue())
+			}
+		}
+	}
+}
+
+// anonymizeZoneInfo replaces the last file of a re-encryption, a path.
+// Key names stay, they must match the KMS.
+func (a *anonymizer) anonymizeZoneInfo(value []byte) []byte {
+	info := &hd.ZoneEncryptionInfoProto{}
+	if err := proto.Unmarshal(value, info); err != nil {
+		return value
+	}
+	r := info.GetReencryptionProto()
+	if r == nil || r.LastFile == nil {
+		return value
+	}
+	r.LastFile = proto.String(a.anonymizePath(r.GetLastFile()))
+	out, err := proto.MarshalOptions{Deterministic: true}.Marshal(info)
+	if err != nil {
+		return value
+	}
+	return out
+}
+
+func (a *anonymizer) anonymizeFile(file *pb.INodeSection_INodeFile) {
+	if file == nil {
+		return
+	}
+	a.notePermission(file.GetPermission())
+	a.anonymizeAcl(file.GetAcl())
+	a.anonymizeXAttrs(file.GetXAttrs())
+	if uc := file.GetFileUC(); uc != nil {
+		uc.ClientName = proto.String(a.anonymize(anonClient, uc.GetClientName()))
+		uc.ClientMachine = proto.String(a.anonymize(anonClient, uc.GetClientMachine()))
+	}
+}
+
+func (a *anonymizer) anonymizeDirectory(dir *pb.INodeSection_INodeDirectory) {
+	if dir == nil {
+		return
+	}
+	a.notePermission(dir.GetPermission())
+	a.anonymizeAcl(dir.GetAcl())
+	a.anonymizeXAttrs(dir.GetXAttrs())
+}
+
+func (a *anonymizer) anonymizeINode(inode *pb.INodeSection_INode) {
+	inode.Name = []byte(a.anonymize(anonName, string(inode.GetName())))
+	a.anonymizeFile(inode.GetFile())
+	a.anonymizeDirectory(inode.GetDirectory())
+	if s := inode.GetSymlink(); s != nil {
+		a.notePermission(s.GetPermission())
+		s.Target = []byte(a.anonymizePath(string(s.GetTarget())))
+	}
+}
+
+// anonymizeImage rewrites img in place. Inodes are visited in id order
+// so -mode pseudonym numbers names the same way every time. Sections
+// that carry names are decoded and rebuilt, ERASURE_CODING is kept and
+// sections of unknown layout are dropped.
+func (a *anonymizer) anonymizeImage(img *Image, f io.ReaderAt) error {
+	ids := make([]uint64, 0, len(inodeData))
+	for id := range inodeData {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+	for _, id := range ids {
+		a.anonymizeINode(inodeData[id])
+	}
+
+	var raw []RawSection
+	for _, s := range img.Raw {
+		switch s.Name {
+		case "ERASURE_CODING":
+			raw = append(raw, s)
+		case "SNAPSHOT", "SNAPSHOT_DIFF", "INODE_REFERENCE", "FILES_UNDERCONSTRUCTION", "SECRET_MANAGER", "CACHE_MANAGER":
+			records, err := a.anonymizeSection(s, f)
+			if err != nil {
+				return err
+			}
+			img.Records = append(img.Records, RecordSection{s.Name, records})
+		default:
+			log.Printf("warning: dropping section %s, its records cannot be anonymized", s.Name)
+		}
+	}
+	img.Raw = raw
+
+	a.anonymizeStringTable()
+	return nil
+}
+
+func (a *anonymizer) anonymizeSection(s RawSection, f io.ReaderAt) ([]proto.Message, error) {
+	info := &pb.FileSummary_Section{Name: proto.String(s.Name), Offset: proto.Uint64(uint64(s.Offset)), Length: proto.Uint64(uint64(s.Length))}
+	decode := newRecordDecoder(s.Name, true)
+	scanner := newRecordScanner(info, f)
+	var records []proto.Message
+	for {
+		record, offset, err := scanner.next()
+		if err == io.EOF {
+			return records, nil
+		} else if err != nil {
+			return nil, err
+		}
+		msg, err := decode(record)
+		if err == nil && msg == nil {
+			err = errors.New("unknown record")
+		}
+		if err != nil {
+			// a half-anonymized section must not be written
+			return nil, &SectionError{Section: s.Name, Offset: offset, Record: scanner.index, Err: err}
+		}
+		if msg = a.anonymizeRecord(msg); msg != nil {
+			records = append(records, msg)
+		}
+	}
+}
+
+// anonymizeRecord rewrites a decoded record in place and returns the
+// record to write, nil to drop it.
+func (a *anonymizer) anonymizeRecord(msg proto.Message) proto.Message {
+	switch m := msg.(type) {
+	case *pb.SnapshotSection_Snapshot:
+		a.anonymizeINode(m.GetRoot())
+	case *pb.SnapshotDiffSection_DirectoryDiff:
+		m.Name = []byte(a.anonymize(anonName, string(m.GetName())))
+		a.anonymizeDirectory(m.GetSnapshotCopy())
+	case *pb.SnapshotDiffSection_FileDiff:
+		m.Name = []byte(a.anonymize(anonName, string(m.GetName())))
+		a.anonymizeFile(m.GetSnapshotCopy())
+	case *pb.SnapshotDiffSection_CreatedListEntry:
+		m.Name = []byte(a.anonymize(anonName, string(m.GetName())))
+	case *pb.INodeReferenceSection_INodeReference:
+		if m.Name != nil {
+			m.Name = []byte(a.anonymize(anonName, string(m.GetName())))
+		}
+	case *pb.FilesUnderConstructionSection_FileUnderConstructionEntry:
+		m.FullPath = proto.String(a.anonymizePath(m.GetFullPath()))
+	case *pb.SecretManagerSection:
+		// the decoder still counts keys against the header it returned
+		header := proto.Clone(m).(*pb.SecretManagerSection)
+		header.NumKeys = proto.Uint32(0)
+		header.NumTokens = proto.Uint32(0)
+		return header
+	case *pb.SecretManagerSection_DelegationKey, *pb.SecretManagerSection_PersistToken:
+		return nil
+	case *hd.CachePoolInfoProto:
+		m.PoolName = proto.String(a.anonymize(anonPool, m.GetPoolName()))
+		if m.OwnerName != nil {
+			m.OwnerName = proto.String(a.anonymize(anonUser, m.GetOwnerName()))
+		}
+		if m.GroupName != nil {
+			m.GroupName = proto.String(a.anonymize(anonGroup, m.GetGroupName()))
+		}
+	case *hd.CacheDirectiveInfoProto:
+		m.Path = proto.String(a.anonymizePath(m.GetPath()))
+		m.Pool = proto.String(a.anonymize(anonPool, m.GetPool()))
+	}
+	return msg
+}
+
+// anonymizeStringTable replaces users, groups and the names of user and
+// trusted xattrs. Masked ids carry their kind, unmasked ones take the
+// kind of their first use, or user when nothing uses them; xattr names
+// HDFS itself uses are kept.
+func (a *anonymizer) anonymizeStringTable() {
+	ids := make([]uint32, 0, len(stringMap))
+	for id := range stringMap {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+	for _, id := range ids {
+		serial := id & 0xFFFFFF
+		role := a.roles[id]
+		switch id >> 29 {
+		case 1:
+			role = anonUser
+		case 2:
+			role = anonGroup
+		case 3:
+			role = anonXAttr
+		}
+		if role == anonXAttr && a.sysXAttrs[serial] {
+			continue
+		}
+		if role == "" {
+			// the namenode keeps the entries of deleted users and groups,
+			// unused entries are replaced like users
+			role = anonUser
+		}
+		stringMap[id] = a.anonymize(role, stringMap[id])
+	}
+}
+
+// writeMapping writes every replaced string as kind, original and
+// anonymized value. The file is created readable by its owner only.
+func (a *anonymizer) writeMapping(fileName string) error {
+	f, err := os.OpenFile(fileName, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	w.WriteString("Kind\tOriginal\tAnonymized\n")
+	for _, kind := range []string{anonName, anonUser, anonGroup, anonXAttr, anonPool, anonClient} {
+		originals := make([]string, 0, len(a.mapped[kind]))
+		for s := range a.mapped[kind] {
+			originals = append(originals, s)
+		}
+		slices.Sort(originals)
+		for _, s := range originals {
+			fmt.Fprintf(w, "%s\t%s\t%s\n", kind, convertSpecialSymbols(s), a.mapped[kind][s])
+		}
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestAnonymizeUnusedStrings checks that STRING_TABLE entries no inode
+// uses, which the namenode keeps after users are deleted, are replaced
+// too.
+func TestAnonymizeUnusedStrings(t *testing.T) {
+	fileName := writeTestImage(t, testGenerateOptions())
+	f, sectionMap, err := openImage(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	img, err := loadImage(f, sectionMap)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// an unmasked entry, as images before the expanded string table have
+	const formerUser = 99
+	stringMap[formerUser] = "formeruser"
+
+	a, err := newAnonymizer(AnonymizeOptions{Mode: "pseudonym"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := a.anonymizeImage(img, f); err != nil {
+		t.Fatal(err)
+	}
+	for id, s := range stringMap {
+		if s == "formeruser" || strings.HasPrefix(s, "user0") || strings.HasPrefix(s, "group0") {
+			t.Errorf("string %d %q is kept", id, s)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"time"
+
+	hd "hdfs-fsimage-parse-go/pkg/hadoop_hdfs"
+	pb "hdfs-fsimage-parse-go/pkg/hadoop_hdfs_fsimage"
+)
+
+// BlockRow is one BlockProto of a file, in the order the blocks appear
+// in the file.
+type BlockRow struct {
+	BlockId     int64
+	GenStamp    uint64
+	NumBytes    uint64
+	Path        string
+	InodeId     uint64
+	Index       int
+	BlockType   string
+	ECPolicyId  uint32
+	Replication uint32
+}
+
+// runBlocks implements the `blocks` subcommand: one row per block so
+// the output can be joined with datanode block reports.
+func runBlocks(args []string) {
+	fs := flag.NewFlagSet("blocks", flag.ExitOnError)
+	var outOpts OutputOptions
+	registerOutputFlags(fs, &outOpts)
+	var fOpts FilterOptions
+	registerFilterFlags(fs, &fOpts)
+	fs.Usage = commandUsage(fs, "[flags] <fsimage> [output.tsv]")
+	registerEditsFlags(fs)
+	registerParseFlags(fs)
+	registerLogFlags(fs)
+	parseArgs(fs, args, 1)
+
+	filter, err := NewFilter(fOpts, time.Now())
+	logIfErr(err)
+
+	f, sectionMap, err := openImage(fs.Arg(0))
+	logIfErr(err)
+	defer f.Close()
+	ns, err := loadNamespace(f, sectionMap)
+	logIfErr(err)
+
+	out, err := createOutput(fs.Arg(1), outOpts)
+	logIfErr(err)
+	writer := bufio.NewWriterSize(out, 1<<20)
+
+	writer.WriteString("BlockId\tBlockName\tGenStamp\tNumBytes\tPath\tInodeId\tIndex\tBlockType\tECPolicyId\tReplication\n")
+	ns.Walk(filter, func(inode *pb.INodeSection_INode, path string) {
+		for _, b := range inodeBlocks(inode, path) {
+			fmt.Fprintf(writer, "%d\tblk_%d\t%d\t%d\t%s\t%d\t%d\t%s\t%d\t%d\n",
+				b.BlockId,
+				b.BlockId,
+				b.GenStamp,
+				b.NumBytes,
+				convertSpecialSymbols(b.Path),
+				b.InodeId,
+				b.Index,
+				b.BlockType,
+				b.ECPolicyId,
+				b.Replication,
+			)
+		}
+	})
+	logIfErr(writer.Flush())
+	logIfErr(out.Close())
+}
+
+// inodeBlocks lists the blocks of a file inode. Striped block groups
+// have negative ids, as in Hadoop.
+func inodeBlocks(inode *pb.INodeSection_INode, path string) []BlockRow {
+	if inode.GetType() != pb.INodeSection_INode_FILE {
+		return nil
+	}
+	file := inode.GetFile()
+	blockType := "CONTIGUOUS"
+	var ecPolicy uint32
+	if file.GetBlockType() == hd.BlockTypeProto_STRIPED {
+		blockType = "STRIPED"
+		ecPolicy = file.GetErasureCodingPolicyID()
+	}
+
+	rows := make([]BlockRow, 0, len(file.GetBlocks()))
+	for i, b := range file.GetBlocks() {
+		rows = append(rows, BlockRow{
+			BlockId:     int64(b.GetBlockId()),
+			GenStamp:    b.GetGenStamp(),
+			NumBytes:    b.GetNumBytes(),
+			Path:        path,
+			InodeId:     inode.GetId(),
+			Index:       i,
+			BlockType:   blockType,
+			ECPolicyId:  ecPolicy,
+			Replication: file.GetReplication(),
+		})
+	}
+	return rows
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	hd "hdfs-fsimage-parse-go/pkg/hadoop_hdfs"
+	pb "hdfs-fsimage-parse-go/pkg/hadoop_hdfs_fsimage"
+
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	// cacheLimitUnlimited is CachePoolInfo.LIMIT_UNLIMITED.
+	cacheLimitUnlimited = math.MaxInt64
+	// cacheExpiryNever is Expiration.MAX_RELATIVE_EXPIRY_MS, the relative
+	// expiry meaning "never". Absolute expiries at or past it never expire.
+	cacheExpiryNever = math.MaxInt64 / 4
+)
+
+// CacheManager is the CACHE_MANAGER section: centralized cache pools and
+// the directives caching paths in them.
+type CacheManager struct {
+	NextDirectiveId uint64
+	Pools           []*hd.CachePoolInfoProto
+	Directives      []*hd.CacheDirectiveInfoProto
+}
+
+// parseCacheManagerSection reads the header, then numPools
+// CachePoolInfoProto and numDirectives CacheDirectiveInfoProto records.
+func parseCacheManagerSection(info *pb.FileSummary_Section, imageFile *os.File) (*CacheManager, error) {
+	cm := &CacheManager{}
+	header := &pb.CacheManagerSection{}
+	var index uint32
+	err := forEachRecord(info, imageFile, header, func(record []byte) error {
+		index++
+		if index <= header.GetNumPools() {
+			pool := &hd.CachePoolInfoProto{}
+			if err := proto.Unmarshal(record, pool); err != nil {
+				return err
+			}
+			cm.Pools = append(cm.Pools, pool)
+			return nil
+		}
+		directive := &hd.CacheDirectiveInfoProto{}
+		if err := proto.Unmarshal(record, directive); err != nil {
+			return err
+		}
+		cm.Directives = append(cm.Directives, directive)
+		return nil
+	})
+	cm.NextDirectiveId = header.GetNextDirectiveId()
+	if err == nil && (uint32(len(cm.Pools)) != header.GetNumPools() || uint32(len(cm.Directives)) != header.GetNumDirectives()) {
+		log.Printf("warning: CACHE_MANAGER header lists %d pools and %d directives, found %d and %d",
+			header.GetNumPools(), header.GetNumDirectives(), len(cm.Pools), len(cm.Directives))
+	}
+	return cm, err
+}
+
+// CacheReport is the result of `cache`, also its JSON output. Limits
+// and expiries keep their raw values; -1 stands for unlimited/never.
+type CacheReport struct {
+	Image           string           `json:"image"`
+	NextDirectiveId uint64           `json:"next_directive_id"`
+	Pools           []CachePool      `json:"pools"`
+	Directives      []CacheDirective `json:"directives"`
+}
+
+type CachePool struct {
+	Name               string `json:"name"`
+	Owner              string `json:"owner"`
+	Group              string `json:"group"`
+	Mode               string `json:"mode"`
+	Limit              int64  `json:"limit"`
+	MaxRelativeExpiry  int64  `json:"max_relative_expiry_ms"`
+	DefaultReplication uint32 `json:"default_replication"`
+	Directives         int    `json:"directives"`
+}
+
+type CacheDirective struct {
+	Id          int64  `json:"id"`
+	Path        string `json:"path"`
+	Replication uint32 `json:"replication"`
+	Pool        string `json:"pool"`
+	Expiry      string `json:"expiry"` // "never" or a UTC time
+	Expired     bool   `json:"expired"`
+}
+
+// runCache implements the `cache` subcommand, the centralized cache
+// configuration stored in CACHE_MANAGER.
+func runCache(args []string) {
+	fs := flag.NewFlagSet("cache", flag.ExitOnError)
+	format := fs.String("format", "text", "output format: text or json")
+	output := fs.String("o", "", "write to this file instead of stdout")
+	registerParseFlags(fs)
+	registerLogFlags(fs)
+	fs.Usage = commandUsage(fs, "[flags] <fsimage>")
+	parseArgs(fs, args, 1)
+
+	if *format != "text" && *format != "json" {
+		log.Fatalf("unknown format %q (want text or json)", *format)
+	}
+	f, sectionMap, err := openImage(fs.Arg(0))
+	logIfErr(err)
+	defer f.Close()
+	if sectionMap["CACHE_MANAGER"] == nil {
+		log.Printf("%s has no CACHE_MANAGER section", fs.Arg(0))
+	}
+	cm, err := parseCacheManagerSection(sectionMap["CACHE_MANAGER"], f)
+	logIfErr(err)
+
+	report := buildCacheReport(cm, uint64(time.Now().UnixMilli()))
+	report.Image = fs.Arg(0)
+
+	out, err := createOutput(*output, OutputOptions{})
+	logIfErr(err)
+	if *format == "json" {
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		logIfErr(enc.Encode(report))
+	} else {
+		logIfErr(writeCacheReport(out, report))
+	}
+	logIfErr(out.Close())
+}
+
+func buildCacheReport(cm *CacheManager, now uint64) *CacheReport {
+	report := &CacheReport{NextDirectiveId: cm.NextDirectiveId, Pools: []CachePool{}, Directives: []CacheDirective{}}
+	directives := make(map[string]int)
+	for _, d := range cm.Directives {
+		directives[d.GetPool()]++
+		directive := CacheDirective{
+			Id:          d.GetId(),
+			Path:        d.GetPath(),
+			Replication: d.GetReplication(),
+			Pool:        d.GetPool(),
+			Expiry:      "never",
+		}
+		// directives are saved with absolute expiries
+		if millis := d.GetExpiration().GetMillis(); d.GetExpiration() != nil && millis < cacheExpiryNever {
+			directive.Expiry = formatTime(uint64(millis))
+			directive.Expired = uint64(millis) < now
+		}
+		report.Directives = append(report.Directives, directive)
+	}
+	for _, p := range cm.Pools {
+		report.Pools = append(report.Pools, CachePool{
+			Name:               p.GetPoolName(),
+			Owner:              p.GetOwnerName(),
+			Group:              p.GetGroupName(),
+			Mode:               formatPermissionBits(uint16(p.GetMode())),
+			Limit:              unlimitedAsNegative(p.GetLimit(), cacheLimitUnlimited),
+			MaxRelativeExpiry:  unlimitedAsNegative(p.GetMaxRelativeExpiry(), cacheExpiryNever),
+			DefaultReplication: p.GetDefaultReplication(),
+			Directives:         directives[p.GetPoolName()],
+		})
+	}
+	return report
+}
+
+func unlimitedAsNegative(v, unlimited int64) int64 {
+	if v >= unlimited {
+		return -1
+	}
+	return v
+}
+
+func writeCacheReport(out io.Writer, r *CacheReport) error {
+	w := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(w, "Pool\tOwner\tGroup\tMode\tLimit\tMaxTTL\tReplication\tDirectives\n")
+	for _, p := range r.Pools {
+		limit, ttl := "unlimited", "never"
+		if p.Limit >= 0 {
+			limit = formatSize(uint64(p.Limit))
+		}
+		if p.MaxRelativeExpiry >= 0 {
+			ttl = formatDuration(time.Duration(p.MaxRelativeExpiry) * time.Millisecond)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%d\t%d\n", convertSpecialSymbols(p.Name), convertSpecialSymbols(p.Owner),
+			convertSpecialSymbols(p.Group), p.Mode, limit, ttl, p.DefaultReplication, p.Directives)
+	}
+
+	fmt.Fprintf(w, "\nId\tPool\tReplication\tExpiry\tExpired\tPath\n")
+	for _, d := range r.Directives {
+		fmt.Fprintf(w, "%d\t%s\t%d\t%s\t%t\t%s\n", d.Id, convertSpecialSymbols(d.Pool), d.Replication, d.Expiry, d.Expired,
+			convertSpecialSymbols(d.Path))
+	}
+	return w.Flush()
+}
+
+// formatDuration prints whole days and the remainder, e.g. "30d" or
+// "1d12h0m0s".
+func formatDuration(d time.Duration) string {
+	days := d / (24 * time.Hour)
+	rest := d % (24 * time.Hour)
+	switch {
+	case days == 0:
+		return rest.String()
+	case rest == 0:
+		return fmt.Sprintf("%dd", days)
+	}
+	return fmt.Sprintf("%dd%s", days, rest)
+}
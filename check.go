@@ -0,0 +1,294 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"log"
+	"maps"
+	"os"
+	"slices"
+	"sort"
+
+	hd "hdfs-fsimage-parse-go/pkg/hadoop_hdfs"
+	pb "hdfs-fsimage-parse-go/pkg/hadoop_hdfs_fsimage"
+)
+
+// Problem kinds reported by `check`.
+const (
+	problemOrphan         = "orphan"
+	problemDangling       = "dangling-child"
+	problemDanglingRef    = "dangling-ref"
+	problemNotDirectory   = "non-directory-parent"
+	problemDuplicate      = "duplicate-parent"
+	problemCycle          = "cycle"
+	problemMissingRoot    = "missing-root"
+	problemZeroBlocks     = "zero-blocks-with-size"
+	problemOversizedBlock = "oversized-block"
+	problemSharedBlock    = "shared-block"
+)
+
+type checkReporter struct {
+	w      *bufio.Writer
+	max    int
+	counts map[string]int
+	order  []string
+}
+
+func (r *checkReporter) report(kind string, inodeId uint64, format string, args ...any) {
+	if r.counts[kind] == 0 {
+		r.order = append(r.order, kind)
+	}
+	r.counts[kind]++
+	if r.max > 0 && r.counts[kind] > r.max {
+		return
+	}
+	fmt.Fprintf(r.w, "%s\t%d\t%s\n", kind, inodeId, convertSpecialSymbols(fmt.Sprintf(format, args...)))
+}
+
+// runCheck implements the `check` subcommand, an offline fsck of the
+// structure of an image.
+func runCheck(args []string) {
+	fs := flag.NewFlagSet("check", flag.ExitOnError)
+	maxReport := fs.Int("max", 1000, "report at most this many problems of each kind, 0 for all")
+	fs.Usage = commandUsage(fs, "[flags] <fsimage>",
+		fmt.Sprintf("Exits with status %d when problems are found.", exitProblems))
+	registerParseFlags(fs)
+	registerLogFlags(fs)
+	parseArgs(fs, args, 1)
+
+	f, sectionMap, err := openImage(fs.Arg(0))
+	logIfErr(err)
+	ns, err := loadNamespace(f, sectionMap)
+	logIfErr(err)
+	refs, err := parseINodeReferenceSection(sectionMap["INODE_REFERENCE"], f)
+	logIfErr(err)
+	diffs, err := parseSnapshotDiffSection(sectionMap["SNAPSHOT_DIFF"], f)
+	logIfErr(err)
+	f.Close()
+
+	r := &checkReporter{w: bufio.NewWriter(os.Stdout), max: *maxReport, counts: make(map[string]int)}
+	r.w.WriteString("Problem\tInodeId\tDetail\n")
+	// reports follow inode ids, so two runs can be diffed
+	ids := slices.Sorted(maps.Keys(inodeData))
+	checkStructure(r, ns, ids, refs, diffs)
+	checkFiles(r, ids, diffs)
+	logIfErr(r.w.Flush())
+
+	if len(r.order) == 0 {
+		infof("check: %d inodes, no problems found", len(inodeData))
+		return
+	}
+	for _, kind := range r.order {
+		log.Printf("check: %s: %d", kind, r.counts[kind])
+	}
+	parseReport.Log()
+	os.Exit(exitProblems)
+}
+
+// inodeSet is a bitset over the sorted ids of inodeData.
+type inodeSet struct {
+	ids  []uint64
+	bits []uint64
+}
+
+func newInodeSet(ids []uint64) *inodeSet {
+	return &inodeSet{ids: ids, bits: make([]uint64, (len(ids)+63)/64)}
+}
+
+func (s *inodeSet) index(id uint64) (int, bool) {
+	i := sort.Search(len(s.ids), func(i int) bool { return s.ids[i] >= id })
+	return i, i < len(s.ids) && s.ids[i] == id
+}
+
+// add marks id and reports whether it was newly added.
+func (s *inodeSet) add(id uint64) bool {
+	i, ok := s.index(id)
+	if !ok || s.bits[i/64]&(1<<(i%64)) != 0 {
+		return false
+	}
+	s.bits[i/64] |= 1 << (i % 64)
+	return true
+}
+
+func (s *inodeSet) has(id uint64) bool {
+	i, ok := s.index(id)
+	return ok && s.bits[i/64]&(1<<(i%64)) != 0
+}
+
+// checkStructure validates INODE_DIR against INODE: dangling and
+// duplicate children, non-directory parents, cycles and inodes that
+// cannot be reached from the root nor are kept by a snapshot. ids are
+// the inode ids in order.
+func checkStructure(r *checkReporter, ns *Namespace, ids []uint64, refs []*pb.INodeReferenceSection_INodeReference, diffs *SnapshotDiffs) {
+	if _, ok := inodeData[ROOT_INODE_ID]; !ok {
+		r.report(problemMissingRoot, ROOT_INODE_ID, "root inode not found in INODE")
+	}
+
+	listed := newInodeSet(ids)
+	for i, dir := range ns.dirs {
+		if inode, ok := inodeData[dir]; !ok {
+			r.report(problemDangling, dir, "INODE_DIR entry for unknown parent")
+		} else if inode.GetType() != pb.INodeSection_INode_DIRECTORY {
+			r.report(problemNotDirectory, dir, "%s inode has %d children", inode.GetType(), ns.start[i+1]-ns.start[i])
+		}
+		for _, child := range ns.children[ns.start[i]:ns.start[i+1]] {
+			if _, ok := inodeData[child]; !ok {
+				r.report(problemDangling, child, "listed under %d but not in INODE", dir)
+				continue
+			}
+			if !listed.add(child) {
+				r.report(problemDuplicate, child, "listed again under %d", dir)
+			}
+		}
+	}
+	for _, dir := range slices.Sorted(maps.Keys(ns.refChildren)) {
+		for _, ref := range ns.refChildren[dir] {
+			if int(ref) >= len(refs) {
+				r.report(problemDanglingRef, dir, "reference %d out of range (%d references)", ref, len(refs))
+			}
+		}
+	}
+
+	reachable := newInodeSet(ids)
+	reachable.add(ROOT_INODE_ID)
+	markSubtrees(ns, refs, reachable, []uint64{ROOT_INODE_ID})
+
+	// inodes kept only by snapshots are not orphans
+	retained := newInodeSet(ids)
+	var roots []uint64
+	for id := range diffs.Deleted {
+		if retained.add(id) {
+			roots = append(roots, id)
+		}
+	}
+	for _, ref := range refs {
+		if retained.add(ref.GetReferredId()) {
+			roots = append(roots, ref.GetReferredId())
+		}
+	}
+	markSubtrees(ns, refs, retained, roots)
+
+	checkCycles(r, ns, ids)
+
+	for _, id := range ids {
+		if reachable.has(id) || retained.has(id) {
+			continue
+		}
+		inode := inodeData[id]
+		r.report(problemOrphan, id, "%s %q unreachable from root", inode.GetType(), inode.GetName())
+	}
+}
+
+// markSubtrees adds everything below roots to set, following children
+// and reference children.
+func markSubtrees(ns *Namespace, refs []*pb.INodeReferenceSection_INodeReference, set *inodeSet, roots []uint64) {
+	queue := append([]uint64(nil), roots...)
+	for len(queue) > 0 {
+		id := queue[len(queue)-1]
+		queue = queue[:len(queue)-1]
+		for _, child := range ns.Children(id) {
+			if set.add(child) {
+				queue = append(queue, child)
+			}
+		}
+		for _, ref := range ns.refChildren[id] {
+			if int(ref) < len(refs) {
+				if child := refs[ref].GetReferredId(); set.add(child) {
+					queue = append(queue, child)
+				}
+			}
+		}
+	}
+}
+
+// checkCycles runs an iterative three-colour DFS over every directory
+// and reports each back edge.
+func checkCycles(r *checkReporter, ns *Namespace, ids []uint64) {
+	const (
+		white = iota
+		grey
+		black
+	)
+	color := make([]byte, len(ids))
+	index := func(id uint64) (int, bool) {
+		i := sort.Search(len(ids), func(i int) bool { return ids[i] >= id })
+		return i, i < len(ids) && ids[i] == id
+	}
+
+	type frame struct {
+		idx      int
+		children []uint64
+		next     int
+	}
+	for _, dir := range ns.dirs {
+		start, ok := index(dir)
+		if !ok || color[start] != white {
+			continue
+		}
+		color[start] = grey
+		stack := []frame{{idx: start, children: ns.Children(dir)}}
+		for len(stack) > 0 {
+			top := &stack[len(stack)-1]
+			if top.next >= len(top.children) {
+				color[top.idx] = black
+				stack = stack[:len(stack)-1]
+				continue
+			}
+			child := top.children[top.next]
+			top.next++
+			ci, ok := index(child)
+			if !ok {
+				continue
+			}
+			switch color[ci] {
+			case grey:
+				r.report(problemCycle, child, "reachable from its own descendant %d", ids[top.idx])
+			case white:
+				color[ci] = grey
+				stack = append(stack, frame{idx: ci, children: ns.Children(child)})
+			}
+		}
+	}
+}
+
+// checkFiles validates file contents: empty files that claim a size,
+// blocks larger than the file's block size and blocks owned by more
+// than one file.
+func checkFiles(r *checkReporter, ids []uint64, diffs *SnapshotDiffs) {
+	type owner struct {
+		block int64
+		inode uint64
+	}
+	var owners []owner
+	for _, id := range ids {
+		inode := inodeData[id]
+		if inode.GetType() != pb.INodeSection_INode_FILE {
+			continue
+		}
+		file := inode.GetFile()
+		if len(file.GetBlocks()) == 0 && diffs.FileSizes[id] > 0 && file.GetFileUC() == nil {
+			r.report(problemZeroBlocks, id, "no blocks but a snapshot records %d bytes", diffs.FileSizes[id])
+		}
+		striped := file.GetBlockType() == hd.BlockTypeProto_STRIPED
+		for _, b := range file.GetBlocks() {
+			if !striped && file.GetPreferredBlockSize() > 0 && b.GetNumBytes() > file.GetPreferredBlockSize() {
+				r.report(problemOversizedBlock, id, "blk_%d has %d bytes, block size is %d",
+					int64(b.GetBlockId()), b.GetNumBytes(), file.GetPreferredBlockSize())
+			}
+			owners = append(owners, owner{int64(b.GetBlockId()), id})
+		}
+	}
+
+	sort.Slice(owners, func(i, j int) bool {
+		if owners[i].block != owners[j].block {
+			return owners[i].block < owners[j].block
+		}
+		return owners[i].inode < owners[j].inode
+	})
+	for i := 1; i < len(owners); i++ {
+		if owners[i].block == owners[i-1].block && owners[i].inode != owners[i-1].inode {
+			r.report(problemSharedBlock, owners[i].inode, "blk_%d also belongs to inode %d", owners[i].block, owners[i-1].inode)
+		}
+	}
+}
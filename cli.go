@@ -0,0 +1,139 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+)
+
+// Exit statuses, documented in the README.
+const (
+	exitOK         = 0
+	exitError      = 1 // unreadable image, I/O error, corrupt record with -strict
+	exitUsage      = 2 // bad flags or arguments, as the flag package does
+	exitProblems   = 3 // check or verify found problems, or quota reached -threshold
+	exitIncomplete = 4 // finished, but corrupt records were skipped
+)
+
+type command struct {
+	name    string
+	args    string
+	summary string
+	run     func(args []string)
+}
+
+var commands = []command{
+	{"export", "[flags] <fsimage> [output]", "write one row per inode as TSV or a SQLite database", runExport},
+	{"info", "[flags] <fsimage>", "print the image header, NS_INFO and namespace totals", runInfo},
+	{"sections", "[flags] <fsimage>", "list the sections of the image with their size and record count", runSections},
+	{"dump", "[flags] <fsimage> <section>", "print the decoded records of a section", runDump},
+	{"du", "[flags] <fsimage> [path...]", "summarize space used under directories", runDu},
+	{"query", "[flags] <fsimage> <sql>", "run SQL against the namespace", runQuery},
+	{"blocks", "[flags] <fsimage> [output]", "write one row per block", runBlocks},
+	{"lookup", "[flags] <fsimage> [key...]", "resolve block ids, inode ids and paths", runLookup},
+	{"encryption", "[flags] <fsimage>", "inventory encryption zones and files missing encryption info", runEncryption},
+	{"tokens", "[flags] <fsimage>", "audit delegation tokens and master keys from SECRET_MANAGER", runTokens},
+	{"cache", "[flags] <fsimage>", "report cache pools and directives from CACHE_MANAGER", runCache},
+	{"quota", "[flags] <fsimage>", "report quota usage, headroom and violations", runQuota},
+	{"metrics", "[flags] <fsimage>", "export namespace gauges for Prometheus, once or on /metrics", runMetrics},
+	{"watch", "[flags] <dir>", "process each new checkpoint written to a directory", runWatch},
+	{"history", "[flags] <history.db> <fsimage>...", "append per-directory, user and policy aggregates of images to a history database", runHistory},
+	{"trend", "[flags] <history.db>", "report growth rates and when quotas run out from the history", runTrend},
+	{"generate", "[flags] <output>", "write a synthetic fsimage with a configurable shape", runGenerate},
+	{"rewrite", "[flags] <fsimage> <output>", "write the image back through the fsimage writer", runRewrite},
+	{"anonymize", "[flags] <fsimage> <output>", "replace names, principals and xattr values for sharing the image", runAnonymize},
+	{"edits", "[flags] <edits>...", "list the transactions in edit log segments", runEdits},
+	{"oev", "[flags] <edits>", "convert an edits segment to XML, JSON Lines or statistics, or XML back", runOev},
+	{"check", "[flags] <fsimage>", "report structural inconsistencies", runCheck},
+	{"verify", "[flags] <fsimage>...", "check the MD5 sidecar, header and section layout", runVerify},
+}
+
+func findCommand(name string) (command, bool) {
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd, true
+		}
+	}
+	return command{}, false
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: %s <command> [flags] <fsimage> ...\n\nCommands:\n", os.Args[0])
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-9s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprintf(os.Stderr, "\nRun '%s <command> -h' for the flags of a command.\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "Without a command, the arguments are passed to export.\n\n")
+	fmt.Fprintf(os.Stderr, "Exit status:\n")
+	fmt.Fprintf(os.Stderr, "  %d  success\n", exitOK)
+	fmt.Fprintf(os.Stderr, "  %d  error: unreadable image, I/O error, corrupt record with -strict\n", exitError)
+	fmt.Fprintf(os.Stderr, "  %d  usage error\n", exitUsage)
+	fmt.Fprintf(os.Stderr, "  %d  check or verify found problems, or quota reached -threshold\n", exitProblems)
+	fmt.Fprintf(os.Stderr, "  %d  finished, but corrupt records were skipped\n", exitIncomplete)
+}
+
+// commandUsage returns a FlagSet usage function for a subcommand.
+func commandUsage(fs *flag.FlagSet, args string, notes ...string) func() {
+	return func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s %s %s\n", os.Args[0], fs.Name(), args)
+		for _, note := range notes {
+			fmt.Fprintln(os.Stderr, note)
+		}
+		fs.PrintDefaults()
+	}
+}
+
+// verbosity selects what is logged on stderr: 0 only warnings and
+// errors, 1 progress (the default), 2 debug details. Everything that is
+// not the command's output goes to stderr.
+var verbosity = 1
+
+func registerLogFlags(fs *flag.FlagSet) {
+	fs.BoolFunc("v", "log debug details on stderr", func(string) error {
+		verbosity = 2
+		return nil
+	})
+	fs.BoolFunc("q", "log only warnings and errors", func(string) error {
+		verbosity = 0
+		return nil
+	})
+}
+
+func infof(format string, args ...any) {
+	if verbosity >= 1 {
+		log.Printf(format, args...)
+	}
+}
+
+func debugf(format string, args ...any) {
+	if verbosity >= 2 {
+		log.Printf(format, args...)
+	}
+}
+
+// parseArgs parses a subcommand's flags and exits with a usage error
+// when fewer than minArgs positional arguments remain. Flags may also
+// follow the positional arguments, where fs.Parse alone would stop and
+// take them as arguments; after "--" everything is an argument.
+func parseArgs(fs *flag.FlagSet, args []string, minArgs int) {
+	var positional []string
+	for {
+		fs.Parse(args)
+		rest := fs.Args()
+		if n := len(args) - len(rest); n > 0 && args[n-1] == "--" {
+			positional = append(positional, rest...)
+			break
+		}
+		if len(rest) == 0 {
+			break
+		}
+		positional = append(positional, rest[0])
+		args = rest[1:]
+	}
+	fs.Parse(append([]string{"--"}, positional...))
+	if fs.NArg() < minArgs {
+		fs.Usage()
+		os.Exit(exitUsage)
+	}
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	hd "hdfs-fsimage-parse-go/pkg/hadoop_hdfs"
+	pb "hdfs-fsimage-parse-go/pkg/hadoop_hdfs_fsimage"
+)
+
+// DuEntry is the usage of one subtree.
+type DuEntry struct {
+	Path     string
+	Bytes    uint64
+	RawBytes uint64 // replicated size, striped files count their data only
+	Files    uint64
+	Dirs     uint64
+}
+
+// runDu implements the `du` subcommand, like `hdfs dfs -du` against the
+// image: the usage of every entry depth levels below each path.
+func runDu(args []string) {
+	fs := flag.NewFlagSet("du", flag.ExitOnError)
+	depth := fs.Int("depth", 1, "report entries this many levels below each path, 0 to summarize the paths themselves")
+	human := fs.Bool("h", false, "print sizes as 1.5 G instead of bytes")
+	sortBy := fs.String("sort", "path", "order of the entries: path or size (largest first)")
+	var fOpts FilterOptions
+	registerFilterFlags(fs, &fOpts)
+	registerEditsFlags(fs)
+	registerParseFlags(fs)
+	registerLogFlags(fs)
+	fs.Usage = commandUsage(fs, "[flags] <fsimage> [path...]", "Paths default to /.")
+	parseArgs(fs, args, 1)
+
+	if *depth < 0 {
+		log.Fatalf("-depth must not be negative")
+	}
+	if *sortBy != "path" && *sortBy != "size" {
+		log.Fatalf("unknown -sort %q (want path or size)", *sortBy)
+	}
+	roots := []string{"/"}
+	if fs.NArg() > 1 {
+		roots = roots[:0]
+		for _, root := range fs.Args()[1:] {
+			if !strings.HasPrefix(root, "/") {
+				log.Fatalf("%s: paths must be absolute", root)
+			}
+			roots = append(roots, path.Clean(root))
+		}
+	}
+	// without path predicates of its own the walk is limited to the roots
+	if len(fOpts.IncludeGlobs) == 0 && len(fOpts.IncludeRegexs) == 0 && !slices.Contains(roots, "/") {
+		for _, root := range roots {
+			fOpts.IncludeRegexs = append(fOpts.IncludeRegexs, "^"+regexp.QuoteMeta(root)+"(/|$)")
+		}
+	}
+	filter, err := NewFilter(fOpts, time.Now())
+	logIfErr(err)
+
+	f, sectionMap, err := openImage(fs.Arg(0))
+	logIfErr(err)
+	defer f.Close()
+	ns, err := loadNamespace(f, sectionMap)
+	logIfErr(err)
+
+	entries := diskUsage(ns, filter, roots, *depth)
+	for _, root := range roots {
+		if !hasDuEntryUnder(entries, root) {
+			log.Printf("%s: no such path, or nothing matched", root)
+		}
+	}
+	if *sortBy == "size" {
+		sort.SliceStable(entries, func(i, j int) bool { return entries[i].Bytes > entries[j].Bytes })
+	}
+
+	size := func(n uint64) string {
+		if *human {
+			return formatSize(n)
+		}
+		return fmt.Sprint(n)
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "Size\tRawSize\tFiles\tDirs\tPath")
+	for _, e := range entries {
+		fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%s\n", size(e.Bytes), size(e.RawBytes), e.Files, e.Dirs, convertSpecialSymbols(e.Path))
+	}
+	logIfErr(w.Flush())
+}
+
+// diskUsage sums every visited inode into the entry depth levels below
+// the root containing it. Entries are returned in path order.
+func diskUsage(ns *Namespace, filter *Filter, roots []string, depth int) []DuEntry {
+	byPath := make(map[string]*DuEntry)
+	ns.Walk(filter, func(inode *pb.INodeSection_INode, p string) {
+		for _, root := range roots {
+			key, ok := duKey(root, p, depth, inode.GetType() == pb.INodeSection_INode_DIRECTORY)
+			if !ok {
+				continue
+			}
+			e := byPath[key]
+			if e == nil {
+				e = &DuEntry{Path: key}
+				byPath[key] = e
+			}
+			switch inode.GetType() {
+			case pb.INodeSection_INode_FILE:
+				e.Files++
+				e.Bytes += getFileSize(inode.GetFile())
+				e.RawBytes += fileRawBytes(inode.GetFile())
+			case pb.INodeSection_INode_DIRECTORY:
+				e.Dirs++
+			}
+		}
+	})
+
+	entries := make([]DuEntry, 0, len(byPath))
+	for _, e := range byPath {
+		entries = append(entries, *e)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Path < entries[j].Path })
+	return entries
+}
+
+// duKey returns the entry p is counted in: root plus the first depth
+// components of p below it. A directory root is not an entry of its
+// own unless depth is 0.
+func duKey(root, p string, depth int, isDir bool) (string, bool) {
+	var rel string
+	switch {
+	case p == root:
+		return root, depth == 0 || !isDir
+	case root == "/":
+		rel = p[1:]
+	case strings.HasPrefix(p, root) && p[len(root)] == '/':
+		rel = p[len(root)+1:]
+	default:
+		return "", false
+	}
+	if depth == 0 {
+		return root, true
+	}
+	end := 0
+	for i := 0; i < depth; i++ {
+		next := strings.IndexByte(rel[end:], '/')
+		if next < 0 {
+			return p, true
+		}
+		end += next + 1
+	}
+	return p[:len(p)-len(rel)+end-1], true
+}
+
+func hasDuEntryUnder(entries []DuEntry, root string) bool {
+	for _, e := range entries {
+		if e.Path == root || root == "/" || strings.HasPrefix(e.Path, root+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// fileRawBytes is the space a file takes on datanodes for contiguous
+// files. Parity of striped files depends on the EC policy and is not
+// included.
+func fileRawBytes(file *pb.INodeSection_INodeFile) uint64 {
+	if file.GetBlockType() == hd.BlockTypeProto_STRIPED {
+		return getFileSize(file)
+	}
+	return getFileSize(file) * uint64(file.GetReplication())
+}
+
+// formatSize prints n with a binary unit, as `hdfs dfs -du -h` does.
+func formatSize(n uint64) string {
+	const units = "KMGTPE"
+	if n < 1024 {
+		return fmt.Sprint(n)
+	}
+	v, i := float64(n)/1024, 0
+	for v >= 1024 && i < len(units)-1 {
+		v /= 1024
+		i++
+	}
+	return fmt.Sprintf("%.1f %c", v, units[i])
+}
@@ -0,0 +1,438 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	hd "hdfs-fsimage-parse-go/pkg/hadoop_hdfs"
+	pb "hdfs-fsimage-parse-go/pkg/hadoop_hdfs_fsimage"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/encoding/prototext"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+)
+
+// recordScanner streams the records of a section through a small
+// buffer, unlike recordReader which loads the whole section.
+type recordScanner struct {
+	section string
+	r       *bufio.Reader
+	offset  int64 // file offset of the next record
+	end     int64
+	index   int
+}
+
+func newRecordScanner(info *pb.FileSummary_Section, imageFile io.ReaderAt) *recordScanner {
+	offset := int64(info.GetOffset())
+	return &recordScanner{
+		section: info.GetName(),
+		r:       bufio.NewReaderSize(io.NewSectionReader(imageFile, offset, int64(info.GetLength())), 1<<20),
+		offset:  offset,
+		end:     offset + int64(info.GetLength()),
+		index:   -1,
+	}
+}
+
+// header reads the length prefix of the next record.
+func (s *recordScanner) header() (length int64, err error) {
+	if s.offset >= s.end {
+		return 0, io.EOF
+	}
+	s.index++
+	n, err := binary.ReadUvarint(s.r)
+	if err != nil {
+		return 0, s.fail(errBadRecordLength)
+	}
+	length = int64(n)
+	prefix := int64(len(binary.AppendUvarint(nil, n)))
+	if length < 0 || s.offset+prefix+length > s.end {
+		return 0, s.fail(errTruncatedRecord)
+	}
+	return length, nil
+}
+
+// next returns the next record and its file offset, io.EOF at the end
+// of the section or a *SectionError.
+func (s *recordScanner) next() ([]byte, int64, error) {
+	length, err := s.header()
+	if err != nil {
+		return nil, 0, err
+	}
+	record := make([]byte, length)
+	if _, err := io.ReadFull(s.r, record); err != nil {
+		return nil, 0, s.fail(errTruncatedSection)
+	}
+	offset := s.offset
+	s.offset += int64(len(binary.AppendUvarint(nil, uint64(length)))) + length
+	return record, offset, nil
+}
+
+// skip moves past the next record without reading it into memory.
+func (s *recordScanner) skip() error {
+	length, err := s.header()
+	if err != nil {
+		return err
+	}
+	if _, err := s.r.Discard(int(length)); err != nil {
+		return s.fail(errTruncatedSection)
+	}
+	s.offset += int64(len(binary.AppendUvarint(nil, uint64(length)))) + length
+	return nil
+}
+
+// fail locates err at the current record and ends the scan, the rest
+// of the section cannot be framed.
+func (s *recordScanner) fail(err error) *SectionError {
+	offset := s.offset
+	s.offset = s.end
+	return &SectionError{Section: s.section, Offset: offset, Record: s.index, Err: err}
+}
+
+// countRecords counts the delimited records of a section, headers
+// included. On a framing error it returns the records before it.
+func countRecords(info *pb.FileSummary_Section, imageFile io.ReaderAt) (int, error) {
+	s := newRecordScanner(info, imageFile)
+	for {
+		if err := s.skip(); err == io.EOF {
+			return s.index + 1, nil
+		} else if err != nil {
+			return s.index, err
+		}
+	}
+}
+
+// recordDecoder decodes the successive records of one section. It
+// returns a nil message for records whose type is not known, they are
+// printed as raw protobuf fields.
+type recordDecoder func(record []byte) (proto.Message, error)
+
+// unmarshalAs decodes record into msg; a nil msg leaves it raw.
+func unmarshalAs(msg proto.Message, record []byte) (proto.Message, error) {
+	if msg == nil {
+		return nil, nil
+	}
+	if err := proto.Unmarshal(record, msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// headerThen decodes the first record with header and the rest with body.
+func headerThen(header func() proto.Message, body func() proto.Message) recordDecoder {
+	first := true
+	return func(record []byte) (proto.Message, error) {
+		if first {
+			first = false
+			return unmarshalAs(header(), record)
+		}
+		return unmarshalAs(body(), record)
+	}
+}
+
+func each(body func() proto.Message) recordDecoder {
+	return func(record []byte) (proto.Message, error) {
+		return unmarshalAs(body(), record)
+	}
+}
+
+// newRecordDecoder knows the record layout of every section written by
+// FSImageFormatProtobuf. Delegation key material is dropped unless
+// includeKeys is set.
+func newRecordDecoder(section string, includeKeys bool) recordDecoder {
+	switch section {
+	case "NS_INFO":
+		return each(func() proto.Message { return &pb.NameSystemSection{} })
+	case "STRING_TABLE":
+		return headerThen(func() proto.Message { return &pb.StringTableSection{} },
+			func() proto.Message { return &pb.StringTableSection_Entry{} })
+	case "INODE":
+		return headerThen(func() proto.Message { return &pb.INodeSection{} },
+			func() proto.Message { return &pb.INodeSection_INode{} })
+	case "INODE_DIR":
+		return each(func() proto.Message { return &pb.INodeDirectorySection_DirEntry{} })
+	case "INODE_REFERENCE":
+		return each(func() proto.Message { return &pb.INodeReferenceSection_INodeReference{} })
+	case "FILES_UNDERCONSTRUCTION":
+		return each(func() proto.Message { return &pb.FilesUnderConstructionSection_FileUnderConstructionEntry{} })
+	case "SNAPSHOT":
+		return headerThen(func() proto.Message { return &pb.SnapshotSection{} },
+			func() proto.Message { return &pb.SnapshotSection_Snapshot{} })
+	case "SNAPSHOT_DIFF":
+		return snapshotDiffDecoder()
+	case "SECRET_MANAGER":
+		return secretManagerDecoder(includeKeys)
+	case "CACHE_MANAGER":
+		return cacheManagerDecoder()
+	case "ERASURE_CODING":
+		return each(func() proto.Message { return &pb.ErasureCodingSection{} })
+	}
+	return func([]byte) (proto.Message, error) { return nil, nil }
+}
+
+// snapshotDiffDecoder follows the nesting of SNAPSHOT_DIFF: a DiffEntry,
+// numOfDiff file or directory diffs, and after each directory diff its
+// createdListSize CreatedListEntry records.
+func snapshotDiffDecoder() recordDecoder {
+	var entry *pb.SnapshotDiffSection_DiffEntry
+	var diffsLeft, createdLeft uint32
+	return func(record []byte) (proto.Message, error) {
+		switch {
+		case createdLeft > 0:
+			createdLeft--
+			return unmarshalAs(&pb.SnapshotDiffSection_CreatedListEntry{}, record)
+		case diffsLeft > 0 && entry.GetType() == pb.SnapshotDiffSection_DiffEntry_DIRECTORYDIFF:
+			diffsLeft--
+			diff := &pb.SnapshotDiffSection_DirectoryDiff{}
+			if err := proto.Unmarshal(record, diff); err != nil {
+				return nil, err
+			}
+			createdLeft = diff.GetCreatedListSize()
+			return diff, nil
+		case diffsLeft > 0:
+			diffsLeft--
+			return unmarshalAs(&pb.SnapshotDiffSection_FileDiff{}, record)
+		}
+		entry = &pb.SnapshotDiffSection_DiffEntry{}
+		if err := proto.Unmarshal(record, entry); err != nil {
+			return nil, err
+		}
+		diffsLeft = entry.GetNumOfDiff()
+		return entry, nil
+	}
+}
+
+// cacheManagerDecoder follows the header with numPools pools, then
+// directives.
+func cacheManagerDecoder() recordDecoder {
+	var header *pb.CacheManagerSection
+	var index uint32
+	return func(record []byte) (proto.Message, error) {
+		if header == nil {
+			header = &pb.CacheManagerSection{}
+			if err := proto.Unmarshal(record, header); err != nil {
+				header = nil
+				return nil, err
+			}
+			return header, nil
+		}
+		index++
+		if index <= header.GetNumPools() {
+			return unmarshalAs(&hd.CachePoolInfoProto{}, record)
+		}
+		return unmarshalAs(&hd.CacheDirectiveInfoProto{}, record)
+	}
+}
+
+// secretManagerDecoder reads the SecretManagerSection header, then
+// numKeys DelegationKey and numTokens PersistToken records.
+func secretManagerDecoder(includeKeys bool) recordDecoder {
+	var header *pb.SecretManagerSection
+	var index uint32
+	return func(record []byte) (proto.Message, error) {
+		if header == nil {
+			header = &pb.SecretManagerSection{}
+			if err := proto.Unmarshal(record, header); err != nil {
+				header = nil
+				return nil, err
+			}
+			return header, nil
+		}
+		index++
+		if index <= header.GetNumKeys() {
+			key := &pb.SecretManagerSection_DelegationKey{}
+			if err := proto.Unmarshal(record, key); err != nil {
+				return nil, err
+			}
+			if !includeKeys {
+				key.Key = nil
+			}
+			return key, nil
+		}
+		return unmarshalAs(&pb.SecretManagerSection_PersistToken{}, record)
+	}
+}
+
+// runDump implements the `dump` subcommand, the decoded records of one
+// section.
+func runDump(args []string) {
+	fs := flag.NewFlagSet("dump", flag.ExitOnError)
+	format := fs.String("format", "text", "output format: text (protobuf text format) or json (one object per line)")
+	offset := fs.Int("offset", 0, "skip this many records, the section header included")
+	limit := fs.Int("limit", 0, "print at most this many records, 0 for all")
+	output := fs.String("o", "", "write to this file instead of stdout")
+	includeKeys := fs.Bool("include-keys", false, "print SECRET_MANAGER master key material; it is removed by default")
+	var outOpts OutputOptions
+	registerOutputFlags(fs, &outOpts)
+	registerLogFlags(fs)
+	fs.Usage = commandUsage(fs, "[flags] <fsimage> <section>",
+		"Sections: see the sections command. Records of unknown types are printed as raw protobuf fields.")
+	parseArgs(fs, args, 2)
+
+	if *format != "text" && *format != "json" {
+		log.Fatalf("unknown format %q (want text or json)", *format)
+	}
+	f, sectionMap, err := openImage(fs.Arg(0))
+	logIfErr(err)
+	defer f.Close()
+	section := strings.ToUpper(fs.Arg(1))
+	info := sectionMap[section]
+	if info == nil {
+		log.Fatalf("section %s not found", section)
+	}
+
+	out, err := createOutput(*output, outOpts)
+	logIfErr(err)
+	w := bufio.NewWriter(out)
+
+	decode := newRecordDecoder(section, *includeKeys)
+	s := newRecordScanner(info, f)
+	printed := 0
+	for *limit == 0 || printed < *limit {
+		record, recordOffset, err := s.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			w.Flush()
+			out.Close()
+			log.Fatal(err)
+		}
+		msg, err := decode(record)
+		if err != nil && section == "SECRET_MANAGER" && !*includeKeys {
+			// a raw dump could expose key material
+			log.Fatal(&SectionError{Section: section, Offset: recordOffset, Record: s.index, Err: err})
+		}
+		if err != nil {
+			// keep going with the raw fields, the layout is lost anyway
+			log.Print(&SectionError{Section: section, Offset: recordOffset, Record: s.index, Err: err})
+			msg = nil
+		}
+		if s.index < *offset {
+			continue
+		}
+		logIfErr(writeRecord(w, *format, section, s.index, recordOffset, msg, record))
+		printed++
+	}
+	logIfErr(w.Flush())
+	logIfErr(out.Close())
+}
+
+func writeRecord(w *bufio.Writer, format, section string, index int, offset int64, msg proto.Message, record []byte) error {
+	typeName := "raw"
+	if msg != nil {
+		typeName = string(msg.ProtoReflect().Descriptor().FullName())
+	}
+	if format == "json" {
+		var body json.RawMessage
+		var err error
+		if msg != nil {
+			body, err = protojson.Marshal(msg)
+		} else {
+			body, err = json.Marshal(rawFields(record))
+		}
+		if err != nil {
+			return err
+		}
+		line, err := json.Marshal(struct {
+			Section string          `json:"section"`
+			Record  int             `json:"record"`
+			Offset  int64           `json:"offset"`
+			Type    string          `json:"type"`
+			Message json.RawMessage `json:"message"`
+		}{section, index, offset, typeName, body})
+		if err != nil {
+			return err
+		}
+		w.Write(line)
+		return w.WriteByte('\n')
+	}
+
+	fmt.Fprintf(w, "# %s record %d at offset %d: %s\n", section, index, offset, typeName)
+	if msg != nil {
+		w.WriteString(prototext.MarshalOptions{Multiline: true}.Format(msg))
+	} else {
+		for _, field := range rawFields(record) {
+			if field.Wire == "string" {
+				fmt.Fprintf(w, "%d: %q\n", field.Field, field.Value)
+			} else {
+				fmt.Fprintf(w, "%d: %v\n", field.Field, field.Value)
+			}
+		}
+	}
+	_, err := w.WriteString("\n")
+	return err
+}
+
+// RawField is one field of a record decoded without its schema.
+// Length-delimited values are a "string" when they are printable UTF-8
+// and hex "bytes" otherwise; nested messages are not expanded.
+type RawField struct {
+	Field protowire.Number `json:"field"`
+	Wire  string           `json:"wire"`
+	Value any              `json:"value"`
+}
+
+func rawFields(record []byte) []RawField {
+	var fields []RawField
+	for len(record) > 0 {
+		num, typ, n := protowire.ConsumeTag(record)
+		if n < 0 {
+			return append(fields, RawField{Wire: "invalid", Value: hex.EncodeToString(record)})
+		}
+		record = record[n:]
+		field := RawField{Field: num}
+		switch typ {
+		case protowire.VarintType:
+			v, m := protowire.ConsumeVarint(record)
+			field.Wire, field.Value, n = "varint", v, m
+		case protowire.Fixed32Type:
+			v, m := protowire.ConsumeFixed32(record)
+			field.Wire, field.Value, n = "fixed32", v, m
+		case protowire.Fixed64Type:
+			v, m := protowire.ConsumeFixed64(record)
+			field.Wire, field.Value, n = "fixed64", v, m
+		case protowire.BytesType:
+			v, m := protowire.ConsumeBytes(record)
+			n = m
+			if isText(v) {
+				field.Wire, field.Value = "string", string(v)
+			} else {
+				field.Wire, field.Value = "bytes", hex.EncodeToString(v)
+			}
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, record)
+			field.Wire = "group"
+			if n >= 0 {
+				field.Value = hex.EncodeToString(record[:n])
+			}
+		}
+		if n < 0 {
+			return append(fields, RawField{Field: num, Wire: "invalid", Value: hex.EncodeToString(record)})
+		}
+		record = record[n:]
+		fields = append(fields, field)
+	}
+	return fields
+}
+
+func isText(b []byte) bool {
+	if !utf8.Valid(b) {
+		return false
+	}
+	for _, r := range string(b) {
+		if !strconv.IsPrint(r) && r != '\t' && r != '\n' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,997 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"flag"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	hd "hdfs-fsimage-parse-go/pkg/hadoop_hdfs"
+
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+)
+
+// editOpCode is FSEditLogOpCodes.
+type editOpCode int8
+
+const (
+	opAdd                        editOpCode = 0
+	opRenameOld                  editOpCode = 1
+	opDelete                     editOpCode = 2
+	opMkdir                      editOpCode = 3
+	opSetReplication             editOpCode = 4
+	opSetPermissions             editOpCode = 7
+	opSetOwner                   editOpCode = 8
+	opClose                      editOpCode = 9
+	opSetGenstampV1              editOpCode = 10
+	opSetNSQuota                 editOpCode = 11
+	opClearNSQuota               editOpCode = 12
+	opTimes                      editOpCode = 13
+	opSetQuota                   editOpCode = 14
+	opRename                     editOpCode = 15
+	opConcatDelete               editOpCode = 16
+	opSymlink                    editOpCode = 17
+	opGetDelegationToken         editOpCode = 18
+	opRenewDelegationToken       editOpCode = 19
+	opCancelDelegationToken      editOpCode = 20
+	opUpdateMasterKey            editOpCode = 21
+	opReassignLease              editOpCode = 22
+	opEndLogSegment              editOpCode = 23
+	opStartLogSegment            editOpCode = 24
+	opUpdateBlocks               editOpCode = 25
+	opCreateSnapshot             editOpCode = 26
+	opDeleteSnapshot             editOpCode = 27
+	opRenameSnapshot             editOpCode = 28
+	opAllowSnapshot              editOpCode = 29
+	opDisallowSnapshot           editOpCode = 30
+	opSetGenstampV2              editOpCode = 31
+	opAllocateBlockId            editOpCode = 32
+	opAddBlock                   editOpCode = 33
+	opAddCacheDirective          editOpCode = 34
+	opRemoveCacheDirective       editOpCode = 35
+	opAddCachePool               editOpCode = 36
+	opModifyCachePool            editOpCode = 37
+	opRemoveCachePool            editOpCode = 38
+	opModifyCacheDirective       editOpCode = 39
+	opSetAcl                     editOpCode = 40
+	opRollingUpgradeStart        editOpCode = 41
+	opRollingUpgradeFinalize     editOpCode = 42
+	opSetXAttr                   editOpCode = 43
+	opRemoveXAttr                editOpCode = 44
+	opSetStoragePolicy           editOpCode = 45
+	opTruncate                   editOpCode = 46
+	opAppend                     editOpCode = 47
+	opSetQuotaByStorageType      editOpCode = 48
+	opAddErasureCodingPolicy     editOpCode = 49
+	opEnableErasureCodingPolicy  editOpCode = 50
+	opDisableErasureCodingPolicy editOpCode = 51
+	opRemoveErasureCodingPolicy  editOpCode = 52
+	opInvalid                    editOpCode = -1
+)
+
+var editOpNames = map[editOpCode]string{
+	opAdd: "OP_ADD", opRenameOld: "OP_RENAME_OLD", opDelete: "OP_DELETE", opMkdir: "OP_MKDIR",
+	opSetReplication: "OP_SET_REPLICATION", opSetPermissions: "OP_SET_PERMISSIONS", opSetOwner: "OP_SET_OWNER",
+	opClose: "OP_CLOSE", opSetGenstampV1: "OP_SET_GENSTAMP_V1", opSetNSQuota: "OP_SET_NS_QUOTA",
+	opClearNSQuota: "OP_CLEAR_NS_QUOTA", opTimes: "OP_TIMES", opSetQuota: "OP_SET_QUOTA", opRename: "OP_RENAME",
+	opConcatDelete: "OP_CONCAT_DELETE", opSymlink: "OP_SYMLINK", opGetDelegationToken: "OP_GET_DELEGATION_TOKEN",
+	opRenewDelegationToken: "OP_RENEW_DELEGATION_TOKEN", opCancelDelegationToken: "OP_CANCEL_DELEGATION_TOKEN",
+	opUpdateMasterKey: "OP_UPDATE_MASTER_KEY", opReassignLease: "OP_REASSIGN_LEASE",
+	opEndLogSegment: "OP_END_LOG_SEGMENT", opStartLogSegment: "OP_START_LOG_SEGMENT",
+	opUpdateBlocks: "OP_UPDATE_BLOCKS", opCreateSnapshot: "OP_CREATE_SNAPSHOT", opDeleteSnapshot: "OP_DELETE_SNAPSHOT",
+	opRenameSnapshot: "OP_RENAME_SNAPSHOT", opAllowSnapshot: "OP_ALLOW_SNAPSHOT",
+	opDisallowSnapshot: "OP_DISALLOW_SNAPSHOT", opSetGenstampV2: "OP_SET_GENSTAMP_V2",
+	opAllocateBlockId: "OP_ALLOCATE_BLOCK_ID", opAddBlock: "OP_ADD_BLOCK",
+	opAddCacheDirective: "OP_ADD_CACHE_DIRECTIVE", opRemoveCacheDirective: "OP_REMOVE_CACHE_DIRECTIVE",
+	opAddCachePool: "OP_ADD_CACHE_POOL", opModifyCachePool: "OP_MODIFY_CACHE_POOL",
+	opRemoveCachePool: "OP_REMOVE_CACHE_POOL", opModifyCacheDirective: "OP_MODIFY_CACHE_DIRECTIVE",
+	opSetAcl: "OP_SET_ACL", opRollingUpgradeStart: "OP_ROLLING_UPGRADE_START",
+	opRollingUpgradeFinalize: "OP_ROLLING_UPGRADE_FINALIZE", opSetXAttr: "OP_SET_XATTR",
+	opRemoveXAttr: "OP_REMOVE_XATTR", opSetStoragePolicy: "OP_SET_STORAGE_POLICY", opTruncate: "OP_TRUNCATE",
+	opAppend: "OP_APPEND", opSetQuotaByStorageType: "OP_SET_QUOTA_BY_STORAGETYPE",
+	opAddErasureCodingPolicy: "OP_ADD_ERASURE_CODING_POLICY", opEnableErasureCodingPolicy: "OP_ENABLE_ERASURE_CODING_POLICY",
+	opDisableErasureCodingPolicy: "OP_DISABLE_ERASURE_CODING_POLICY", opRemoveErasureCodingPolicy: "OP_REMOVE_ERASURE_CODING_POLICY",
+	opInvalid: "OP_INVALID",
+}
+
+func (c editOpCode) String() string {
+	if name, ok := editOpNames[c]; ok {
+		return name
+	}
+	return fmt.Sprintf("OP_%d", c)
+}
+
+// Layout versions of the NameNodeLayoutVersion features that change
+// the op encoding. Older logs, without op lengths, are not supported.
+const (
+	layoutEditLogLength            = -56
+	layoutXAttrs                   = -57
+	layoutCreateOverwrite          = -58
+	layoutBlockStoragePolicy       = -60
+	layoutErasureCoding            = -64
+	layoutSnapshotModificationTime = -66
+	layoutNVDIMM                   = -67
+)
+
+// maxEditOpSize is DFS_NAMENODE_MAX_OP_SIZE_DEFAULT.
+const maxEditOpSize = 50 * 1024 * 1024
+
+var (
+	errEditChecksum  = errors.New("op checksum mismatch")
+	errEditOpLength  = errors.New("invalid op length")
+	errEditTruncated = errors.New("op runs past the end of the file")
+	errEditShortOp   = errors.New("op body is shorter than its fields")
+	errEditLongOp    = errors.New("op body has bytes after its fields")
+)
+
+// EditBlock is a Block as the edit log writes it.
+type EditBlock struct {
+	Id       int64 `json:"id"`
+	NumBytes int64 `json:"num_bytes"`
+	GenStamp int64 `json:"genstamp"`
+}
+
+// EditPermission is a PermissionStatus.
+type EditPermission struct {
+	User  string
+	Group string
+	Mode  uint16
+}
+
+// EditToken is a DelegationTokenIdentifier.
+type EditToken struct {
+	Owner          string `json:"owner"`
+	Renewer        string `json:"renewer"`
+	RealUser       string `json:"real_user,omitempty"`
+	IssueDate      int64  `json:"issue_date"`
+	MaxDate        int64  `json:"max_date"`
+	SequenceNumber int32  `json:"sequence_number"`
+	MasterKeyId    int32  `json:"master_key_id"`
+}
+
+// EditKey is a DelegationKey; Key is nil when the namenode logged none.
+type EditKey struct {
+	Id         int32
+	ExpiryDate int64
+	Key        []byte
+}
+
+// EditOp is one decoded FSEditLogOp. The fields are shared between op
+// types, each uses the ones FSEditLogOp gives it; ops whose body is not
+// decoded (OP_ADD_ERASURE_CODING_POLICY and opcodes this version does
+// not know) keep it in Body.
+type EditOp struct {
+	Code editOpCode
+	TxId int64
+
+	InodeId       int64
+	Path          string   // path, src, concat target or snapshot root
+	Dst           string   // rename destination or symlink target
+	Srcs          []string // OP_CONCAT_DELETE sources
+	SnapshotName  string
+	NewName       string // OP_RENAME_SNAPSHOT
+	Replication   int16
+	Mtime         int64 // mtime or timestamp
+	Atime         int64
+	BlockSize     int64
+	Blocks        []EditBlock
+	Permissions   *EditPermission // OP_ADD, OP_MKDIR, OP_SYMLINK
+	Mode          uint16          // OP_SET_PERMISSIONS
+	User, Group   string          // OP_SET_OWNER, empty when unchanged
+	Acl           []*hd.AclEntryProto
+	XAttrs        []*hd.XAttrProto
+	ClientName    string // lease holder; OP_REASSIGN_LEASE new holder
+	ClientMachine string
+	LeaseHolder   string // OP_REASSIGN_LEASE old holder
+	Overwrite     bool
+	NewBlock      bool
+	StoragePolicy int8
+	ECPolicy      int8
+	NsQuota       int64
+	DsQuota       int64
+	StorageType   hd.StorageTypeProto
+	RenameOptions []byte
+	NewLength     int64
+	Value         int64 // generation stamp, block id, token expiry or rolling upgrade time
+	Token         *EditToken
+	Key           *EditKey
+	Directive     *hd.CacheDirectiveInfoProto
+	Pool          *hd.CachePoolInfoProto // only the name for OP_REMOVE_CACHE_POOL
+	PolicyName    string                 // erasure coding policy ops
+	RpcClientId   []byte
+	RpcCallId     int32
+	Body          []byte
+}
+
+// editReader decodes the DataOutput encodings FSEditLogOp uses. The
+// first error sticks and later reads return zero values.
+type editReader struct {
+	buf []byte
+	err error
+}
+
+func (r *editReader) next(n int) []byte {
+	if r.err != nil || n < 0 || n > len(r.buf) {
+		if r.err == nil {
+			r.err = errEditShortOp
+		}
+		return nil
+	}
+	b := r.buf[:n]
+	r.buf = r.buf[n:]
+	return b
+}
+
+func (r *editReader) long() int64 {
+	if b := r.next(8); b != nil {
+		return int64(binary.BigEndian.Uint64(b))
+	}
+	return 0
+}
+
+func (r *editReader) int() int32 {
+	if b := r.next(4); b != nil {
+		return int32(binary.BigEndian.Uint32(b))
+	}
+	return 0
+}
+
+func (r *editReader) short() int16 {
+	if b := r.next(2); b != nil {
+		return int16(binary.BigEndian.Uint16(b))
+	}
+	return 0
+}
+
+func (r *editReader) byte() int8 {
+	if b := r.next(1); b != nil {
+		return int8(b[0])
+	}
+	return 0
+}
+
+func (r *editReader) bool() bool {
+	return r.byte() != 0
+}
+
+// string reads FSImageSerialization.readString, a DeprecatedUTF8 with
+// an unsigned short length.
+func (r *editReader) string() string {
+	return decodeModifiedUTF8(r.next(int(uint16(r.short()))))
+}
+
+// decodeModifiedUTF8 converts the UTF-8 of DataOutput.writeUTF, which
+// encodes characters outside the BMP as two 3-byte surrogates, to UTF-8.
+func decodeModifiedUTF8(b []byte) string {
+	if utf8.Valid(b) {
+		return string(b)
+	}
+	units := make([]uint16, 0, len(b))
+	for i := 0; i < len(b); {
+		c := b[i]
+		switch {
+		case c < 0x80:
+			units = append(units, uint16(c))
+			i++
+		case c&0xe0 == 0xc0 && i+1 < len(b):
+			units = append(units, uint16(c&0x1f)<<6|uint16(b[i+1]&0x3f))
+			i += 2
+		case c&0xf0 == 0xe0 && i+2 < len(b):
+			units = append(units, uint16(c&0x0f)<<12|uint16(b[i+1]&0x3f)<<6|uint16(b[i+2]&0x3f))
+			i += 3
+		default:
+			units = append(units, utf8.RuneError)
+			i++
+		}
+	}
+	return string(utf16.Decode(units))
+}
+
+// text reads Text.readString, with a vint length.
+func (r *editReader) text() string {
+	return string(r.next(int(r.vlong())))
+}
+
+// bytes reads FSImageSerialization.readBytes.
+func (r *editReader) bytes() []byte {
+	return r.next(int(uint16(r.short())))
+}
+
+// vlong reads WritableUtils.readVLong.
+func (r *editReader) vlong() int64 {
+	first := r.byte()
+	if first >= -112 {
+		return int64(first)
+	}
+	// the first byte gives the sign and the number of bytes after it
+	n := int(-112 - first)
+	negative := first < -120
+	if negative {
+		n = int(-120 - first)
+	}
+	var v int64
+	for _, b := range r.next(n) {
+		v = v<<8 | int64(b)
+	}
+	if negative {
+		v = ^v
+	}
+	return v
+}
+
+// vint reads WritableUtils.readVInt, the same encoding as a vlong.
+func (r *editReader) vint() int32 {
+	return int32(r.vlong())
+}
+
+func (r *editReader) rpcIds(op *EditOp) {
+	op.RpcClientId = r.bytes()
+	op.RpcCallId = r.int()
+}
+
+func (r *editReader) permission() *EditPermission {
+	return &EditPermission{User: r.text(), Group: r.text(), Mode: uint16(r.short())}
+}
+
+// blocks reads an ArrayWritable of Blocks.
+func (r *editReader) blocks() []EditBlock {
+	n := r.int()
+	if n < 0 || int(n) > len(r.buf)/24 {
+		r.next(-1)
+		return nil
+	}
+	blocks := make([]EditBlock, n)
+	for i := range blocks {
+		blocks[i] = EditBlock{Id: r.long(), NumBytes: r.long(), GenStamp: r.long()}
+	}
+	return blocks
+}
+
+// compactBlocks reads FSImageSerialization.readCompactBlockArray: sizes
+// and generation stamps are deltas to the previous block.
+func (r *editReader) compactBlocks() []EditBlock {
+	n := r.vlong()
+	if n < 0 || n > int64(len(r.buf)/10) {
+		r.next(-1)
+		return nil
+	}
+	blocks := make([]EditBlock, n)
+	var prev EditBlock
+	for i := range blocks {
+		blocks[i] = EditBlock{Id: r.long(), NumBytes: prev.NumBytes + r.vlong(), GenStamp: prev.GenStamp + r.vlong()}
+		prev = blocks[i]
+	}
+	return blocks
+}
+
+// acl reads AclEditLogUtil's encoding: a count, then per entry a byte
+// of scope, type and permission bits and the name if it has one.
+func (r *editReader) acl() []*hd.AclEntryProto {
+	n := r.int()
+	if n < 0 || int(n) > len(r.buf) {
+		r.next(-1)
+		return nil
+	}
+	entries := make([]*hd.AclEntryProto, 0, n)
+	for range n {
+		v := r.byte()
+		entry := &hd.AclEntryProto{
+			Type:        hd.AclEntryProto_AclEntryTypeProto((v >> 3) & 3).Enum(),
+			Scope:       hd.AclEntryProto_AclEntryScopeProto((v >> 5) & 1).Enum(),
+			Permissions: hd.AclEntryProto_FsActionProto(v & 7).Enum(),
+		}
+		if v&(1<<6) != 0 {
+			entry.Name = proto.String(r.string())
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+// token reads DelegationTokenIdentifier.readFields.
+func (r *editReader) token() *EditToken {
+	if v := r.byte(); v != 0 && r.err == nil {
+		r.err = fmt.Errorf("unknown token identifier version %d", v)
+	}
+	return &EditToken{Owner: r.text(), Renewer: r.text(), RealUser: r.text(), IssueDate: r.vlong(), MaxDate: r.vlong(),
+		SequenceNumber: r.vint(), MasterKeyId: r.vint()}
+}
+
+// key reads DelegationKey.readFields.
+func (r *editReader) key() *EditKey {
+	k := &EditKey{Id: r.vint(), ExpiryDate: r.vlong()}
+	if n := r.vint(); n >= 0 {
+		k.Key = r.next(int(n))
+	}
+	return k
+}
+
+// Flags of FSImageSerialization.writeCacheDirectiveInfo and
+// writeCachePoolInfo, one per field present.
+const (
+	cacheDirectivePath        = 0x1
+	cacheDirectiveReplication = 0x2
+	cacheDirectivePool        = 0x4
+	cacheDirectiveExpiration  = 0x8
+
+	cachePoolOwner              = 0x1
+	cachePoolGroup              = 0x2
+	cachePoolMode               = 0x4
+	cachePoolLimit              = 0x8
+	cachePoolMaxRelativeExpiry  = 0x10
+	cachePoolDefaultReplication = 0x20
+)
+
+// directive reads FSImageSerialization.readCacheDirectiveInfo. The
+// expiration is absolute.
+func (r *editReader) directive() *hd.CacheDirectiveInfoProto {
+	d := &hd.CacheDirectiveInfoProto{Id: proto.Int64(r.long())}
+	flags := r.int()
+	if flags&^0xf != 0 && r.err == nil {
+		r.err = fmt.Errorf("unknown cache directive flags %#x", flags)
+	}
+	if flags&cacheDirectivePath != 0 {
+		d.Path = proto.String(r.string())
+	}
+	if flags&cacheDirectiveReplication != 0 {
+		d.Replication = proto.Uint32(uint32(r.short()))
+	}
+	if flags&cacheDirectivePool != 0 {
+		d.Pool = proto.String(r.string())
+	}
+	if flags&cacheDirectiveExpiration != 0 {
+		d.Expiration = &hd.CacheDirectiveInfoExpirationProto{Millis: proto.Int64(r.long()), IsRelative: proto.Bool(false)}
+	}
+	return d
+}
+
+// pool reads FSImageSerialization.readCachePoolInfo.
+func (r *editReader) pool() *hd.CachePoolInfoProto {
+	p := &hd.CachePoolInfoProto{PoolName: proto.String(r.string())}
+	flags := r.int()
+	if flags&^0x3f != 0 && r.err == nil {
+		r.err = fmt.Errorf("unknown cache pool flags %#x", flags)
+	}
+	if flags&cachePoolOwner != 0 {
+		p.OwnerName = proto.String(r.string())
+	}
+	if flags&cachePoolGroup != 0 {
+		p.GroupName = proto.String(r.string())
+	}
+	if flags&cachePoolMode != 0 {
+		p.Mode = proto.Int32(int32(r.short()))
+	}
+	if flags&cachePoolLimit != 0 {
+		p.Limit = proto.Int64(r.long())
+	}
+	if flags&cachePoolMaxRelativeExpiry != 0 {
+		p.MaxRelativeExpiry = proto.Int64(r.long())
+	}
+	if flags&cachePoolDefaultReplication != 0 {
+		p.DefaultReplication = proto.Uint32(uint32(r.short()))
+	}
+	return p
+}
+
+// delimited reads a varint-delimited protobuf message.
+func (r *editReader) delimited(m proto.Message) {
+	if r.err != nil {
+		return
+	}
+	n, size := protowire.ConsumeVarint(r.buf)
+	if size < 0 {
+		r.err = errEditShortOp
+		return
+	}
+	r.next(size)
+	if err := proto.Unmarshal(r.next(int(n)), m); err != nil && r.err == nil {
+		r.err = err
+	}
+}
+
+// storageTypes are the StorageType ordinals OP_SET_QUOTA_BY_STORAGETYPE
+// writes, NVDIMM was inserted after RAM_DISK.
+func storageTypes(version int32) []hd.StorageTypeProto {
+	if version <= layoutNVDIMM {
+		return []hd.StorageTypeProto{hd.StorageTypeProto_RAM_DISK, hd.StorageTypeProto_NVDIMM, hd.StorageTypeProto_SSD,
+			hd.StorageTypeProto_DISK, hd.StorageTypeProto_ARCHIVE, hd.StorageTypeProto_PROVIDED}
+	}
+	return []hd.StorageTypeProto{hd.StorageTypeProto_RAM_DISK, hd.StorageTypeProto_SSD, hd.StorageTypeProto_DISK,
+		hd.StorageTypeProto_ARCHIVE, hd.StorageTypeProto_PROVIDED}
+}
+
+// readFields decodes the body of op, following the readFields method
+// of its FSEditLogOp subclass.
+func (op *EditOp) readFields(r *editReader, version int32) {
+	switch op.Code {
+	case opAdd, opClose:
+		op.InodeId = r.long()
+		op.Path = r.string()
+		op.Replication = r.short()
+		op.Mtime = r.long()
+		op.Atime = r.long()
+		op.BlockSize = r.long()
+		op.Blocks = r.blocks()
+		op.Permissions = r.permission()
+		if op.Code == opClose {
+			break
+		}
+		op.Acl = r.acl()
+		if version <= layoutXAttrs {
+			x := &hd.XAttrEditLogProto{}
+			r.delimited(x)
+			op.XAttrs = x.GetXAttrs()
+		}
+		op.ClientName = r.string()
+		op.ClientMachine = r.string()
+		if version <= layoutCreateOverwrite {
+			op.Overwrite = r.bool()
+		}
+		if version <= layoutBlockStoragePolicy {
+			op.StoragePolicy = r.byte()
+		}
+		if version <= layoutErasureCoding {
+			op.ECPolicy = r.byte()
+		}
+		r.rpcIds(op)
+	case opMkdir:
+		op.InodeId = r.long()
+		op.Path = r.string()
+		op.Mtime = r.long()
+		op.Atime = r.long()
+		op.Permissions = r.permission()
+		op.Acl = r.acl()
+		if version <= layoutXAttrs {
+			x := &hd.XAttrEditLogProto{}
+			r.delimited(x)
+			op.XAttrs = x.GetXAttrs()
+		}
+	case opSymlink:
+		op.InodeId = r.long()
+		op.Path = r.string()
+		op.Dst = r.string()
+		op.Mtime = r.long()
+		op.Atime = r.long()
+		op.Permissions = r.permission()
+		r.rpcIds(op)
+	case opDelete:
+		op.Path = r.string()
+		op.Mtime = r.long()
+		r.rpcIds(op)
+	case opRenameOld:
+		op.Path = r.string()
+		op.Dst = r.string()
+		op.Mtime = r.long()
+		r.rpcIds(op)
+	case opRename:
+		op.Path = r.string()
+		op.Dst = r.string()
+		op.Mtime = r.long()
+		op.RenameOptions = r.next(int(r.int()))
+		r.rpcIds(op)
+	case opConcatDelete:
+		op.Path = r.string()
+		n := r.int()
+		if n < 0 || int(n) > len(r.buf)/2 {
+			r.next(-1)
+			break
+		}
+		for range n {
+			op.Srcs = append(op.Srcs, r.string())
+		}
+		op.Mtime = r.long()
+		r.rpcIds(op)
+	case opSetReplication:
+		op.Path = r.string()
+		op.Replication = r.short()
+	case opSetPermissions:
+		op.Path = r.string()
+		op.Mode = uint16(r.short())
+	case opSetOwner:
+		op.Path = r.string()
+		op.User = r.string()
+		op.Group = r.string()
+	case opTimes:
+		op.Path = r.string()
+		op.Mtime = r.long()
+		op.Atime = r.long()
+	case opSetNSQuota:
+		op.Path = r.string()
+		op.NsQuota = r.long()
+	case opClearNSQuota, opAllowSnapshot, opDisallowSnapshot:
+		op.Path = r.string()
+	case opSetQuota:
+		op.Path = r.string()
+		op.NsQuota = r.long()
+		op.DsQuota = r.long()
+	case opSetQuotaByStorageType:
+		op.Path = r.string()
+		if types, i := storageTypes(version), r.int(); i >= 0 && int(i) < len(types) {
+			op.StorageType = types[i]
+		} else if r.err == nil {
+			r.err = fmt.Errorf("unknown storage type %d", i)
+		}
+		op.DsQuota = r.long()
+	case opReassignLease:
+		op.LeaseHolder = r.string()
+		op.Path = r.string()
+		op.ClientName = r.string()
+	case opAddBlock, opUpdateBlocks:
+		op.Path = r.string()
+		op.Blocks = r.compactBlocks()
+		r.rpcIds(op)
+	case opTruncate:
+		op.Path = r.string()
+		op.ClientName = r.string()
+		op.ClientMachine = r.string()
+		op.NewLength = r.long()
+		op.Mtime = r.long()
+		op.Blocks = r.compactBlocks()
+	case opAppend:
+		op.Path = r.string()
+		op.ClientName = r.string()
+		op.ClientMachine = r.string()
+		op.NewBlock = r.bool()
+		r.rpcIds(op)
+	case opSetStoragePolicy:
+		op.Path = r.string()
+		op.StoragePolicy = r.byte()
+	case opSetAcl:
+		a := &hd.AclEditLogProto{}
+		r.delimited(a)
+		op.Path, op.Acl = a.GetSrc(), a.GetEntries()
+	case opSetXAttr, opRemoveXAttr:
+		x := &hd.XAttrEditLogProto{}
+		r.delimited(x)
+		op.Path, op.XAttrs = x.GetSrc(), x.GetXAttrs()
+		r.rpcIds(op)
+	case opCreateSnapshot, opDeleteSnapshot:
+		op.Path = r.string()
+		op.SnapshotName = r.string()
+		r.rpcIds(op)
+		if version <= layoutSnapshotModificationTime {
+			op.Mtime = r.long()
+		}
+	case opRenameSnapshot:
+		op.Path = r.string()
+		op.SnapshotName = r.string()
+		op.NewName = r.string()
+		r.rpcIds(op)
+		if version <= layoutSnapshotModificationTime {
+			op.Mtime = r.long()
+		}
+	case opSetGenstampV1, opSetGenstampV2, opAllocateBlockId, opRollingUpgradeStart, opRollingUpgradeFinalize:
+		op.Value = r.long()
+	case opGetDelegationToken, opRenewDelegationToken:
+		op.Token = r.token()
+		op.Value = r.long()
+	case opCancelDelegationToken:
+		op.Token = r.token()
+	case opUpdateMasterKey:
+		op.Key = r.key()
+	case opAddCacheDirective, opModifyCacheDirective:
+		op.Directive = r.directive()
+		r.rpcIds(op)
+	case opRemoveCacheDirective:
+		op.Directive = &hd.CacheDirectiveInfoProto{Id: proto.Int64(r.long())}
+		r.rpcIds(op)
+	case opAddCachePool, opModifyCachePool:
+		op.Pool = r.pool()
+		r.rpcIds(op)
+	case opRemoveCachePool:
+		op.Pool = &hd.CachePoolInfoProto{PoolName: proto.String(r.string())}
+		r.rpcIds(op)
+	case opEnableErasureCodingPolicy, opDisableErasureCodingPolicy, opRemoveErasureCodingPolicy:
+		op.PolicyName = r.string()
+		r.rpcIds(op)
+	case opStartLogSegment, opEndLogSegment:
+	default:
+		op.Body = r.next(len(r.buf))
+	}
+}
+
+// readEditLog calls fn with every op of an edits segment, in order. Ops
+// failing their checksum or not decoding are skipped and recorded in
+// parseReport; a bad length ends the segment, the rest cannot be
+// framed. The op passed to fn is not reused.
+func readEditLog(fileName string, fn func(op *EditOp) error) (int32, error) {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	br := bufio.NewReaderSize(f, 1<<20)
+	section := filepath.Base(fileName)
+	version, err := readEditLogHeader(br, fileName)
+	if err != nil {
+		return version, err
+	}
+
+	var header [4]byte
+	offset := int64(8)
+	for index := 0; ; index++ {
+		code, err := br.ReadByte()
+		if err == io.EOF || (err == nil && editOpCode(code) == opInvalid) {
+			// end of the segment or its preallocated padding
+			return version, nil
+		} else if err != nil {
+			return version, err
+		}
+		if _, err := io.ReadFull(br, header[:]); err != nil {
+			return version, parseReport.add(&SectionError{Section: section, Offset: offset, Record: index, Err: errEditTruncated})
+		}
+		// the length counts the txid, the body and the checksum
+		length := int32(binary.BigEndian.Uint32(header[:]))
+		if length < 12 || length > maxEditOpSize {
+			return version, parseReport.add(&SectionError{Section: section, Offset: offset, Record: index, Err: errEditOpLength})
+		}
+		record := make([]byte, 5+length)
+		record[0] = code
+		copy(record[1:5], header[:])
+		if _, err := io.ReadFull(br, record[5:]); err != nil {
+			return version, parseReport.add(&SectionError{Section: section, Offset: offset, Record: index, Err: errEditTruncated})
+		}
+		opOffset := offset
+		offset += int64(len(record))
+
+		body := record[:len(record)-4]
+		if crc32.ChecksumIEEE(body) != binary.BigEndian.Uint32(record[len(record)-4:]) {
+			if err := parseReport.add(&SectionError{Section: section, Offset: opOffset, Record: index, Err: errEditChecksum}); err != nil {
+				return version, err
+			}
+			continue
+		}
+		op := &EditOp{Code: editOpCode(code), TxId: int64(binary.BigEndian.Uint64(body[5:13]))}
+		r := &editReader{buf: body[13:]}
+		op.readFields(r, version)
+		if r.err == nil && len(r.buf) > 0 {
+			r.err = errEditLongOp
+		}
+		if r.err != nil {
+			err := fmt.Errorf("%s txid %d: %w", op.Code, op.TxId, r.err)
+			if err := parseReport.add(&SectionError{Section: section, Offset: opOffset, Record: index, Err: err}); err != nil {
+				return version, err
+			}
+			continue
+		}
+		if err := fn(op); err != nil {
+			return version, err
+		}
+	}
+}
+
+// readEditLogHeader reads the layout version and the layout flags that
+// start a segment.
+func readEditLogHeader(r io.Reader, fileName string) (int32, error) {
+	var header [4]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return 0, fmt.Errorf("%s: no layout version: %w", fileName, err)
+	}
+	version := int32(binary.BigEndian.Uint32(header[:]))
+	if version > layoutEditLogLength {
+		return version, fmt.Errorf("%s: layout version %d is older than %d, ops without lengths are not supported",
+			fileName, version, layoutEditLogLength)
+	}
+	if version < layoutNVDIMM {
+		log.Printf("warning: %s: layout version %d is newer than %d, ops may not decode", fileName, version, layoutNVDIMM)
+	}
+	// LayoutFlags, always empty
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return version, fmt.Errorf("%s: no layout flags: %w", fileName, err)
+	}
+	if n := binary.BigEndian.Uint32(header[:]); n != 0 {
+		return version, fmt.Errorf("%s: unknown layout flags (%d)", fileName, n)
+	}
+	return version, nil
+}
+
+// EditSegment is an edits file and the transactions its name claims;
+// Last is -1 for a segment still in progress.
+type EditSegment struct {
+	Path  string
+	First int64
+	Last  int64
+}
+
+var (
+	finalizedSegmentRe  = regexp.MustCompile(`^edits_(\d+)-(\d+)$`)
+	inProgressSegmentRe = regexp.MustCompile(`^edits_inprogress_(\d+)$`)
+)
+
+// findEditSegments expands directories into the segments in them, as
+// FileJournalManager names them, and orders everything by first
+// transaction. Files given by name are taken whatever their name, and
+// sort by it only if it follows the pattern.
+func findEditSegments(paths []string) ([]EditSegment, error) {
+	var segments []EditSegment
+	for _, p := range paths {
+		info, err := os.Stat(p)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			segment, _ := parseSegmentName(p)
+			segments = append(segments, segment)
+			continue
+		}
+		entries, err := os.ReadDir(p)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range entries {
+			if segment, ok := parseSegmentName(filepath.Join(p, e.Name())); ok && !e.IsDir() {
+				segments = append(segments, segment)
+			}
+		}
+	}
+	sort.SliceStable(segments, func(i, j int) bool { return segments[i].First < segments[j].First })
+	return segments, nil
+}
+
+func parseSegmentName(p string) (EditSegment, bool) {
+	segment := EditSegment{Path: p, Last: -1}
+	if m := finalizedSegmentRe.FindStringSubmatch(filepath.Base(p)); m != nil {
+		segment.First, _ = strconv.ParseInt(m[1], 10, 64)
+		segment.Last, _ = strconv.ParseInt(m[2], 10, 64)
+		return segment, true
+	}
+	if m := inProgressSegmentRe.FindStringSubmatch(filepath.Base(p)); m != nil {
+		segment.First, _ = strconv.ParseInt(m[1], 10, 64)
+		return segment, true
+	}
+	return segment, false
+}
+
+// forEachEdit reads the segments in order and calls fn once per
+// transaction after fromTxId, skipping ones repeated by overlapping
+// segments. A gap in the transaction ids is an error, replaying past it
+// would give a namespace the namenode never had, unless it is where
+// corrupt ops were skipped.
+func forEachEdit(segments []EditSegment, fromTxId int64, fn func(op *EditOp) error) (last int64, err error) {
+	last = fromTxId
+	skipped := parseReport.Total()
+	for _, s := range segments {
+		if s.Last >= 0 && s.Last <= last {
+			debugf("skipping %s, its transactions are before %d", s.Path, last+1)
+			continue
+		}
+		_, err := readEditLog(s.Path, func(op *EditOp) error {
+			switch {
+			case op.TxId <= last:
+				return nil
+			case op.TxId != last+1 && (last != 0 || fromTxId != 0) && parseReport.Total() == skipped:
+				return fmt.Errorf("%s: transactions %d to %d are missing", s.Path, last+1, op.TxId-1)
+			}
+			last, skipped = op.TxId, parseReport.Total()
+			return fn(op)
+		})
+		if err != nil {
+			return last, err
+		}
+	}
+	return last, nil
+}
+
+// describe returns the path an op works on and a short summary of its
+// other fields for the text listing.
+func (op *EditOp) describe() (string, string) {
+	perm := func(p *EditPermission) string {
+		if p == nil {
+			return ""
+		}
+		return fmt.Sprintf("%s:%s %s", p.User, p.Group, formatPermissionBits(p.Mode))
+	}
+	switch op.Code {
+	case opClose:
+		return op.Path, fmt.Sprintf("%d blocks, replication %d, %s", len(op.Blocks), op.Replication, perm(op.Permissions))
+	case opAdd:
+		return op.Path, fmt.Sprintf("inode %d, %d blocks, replication %d, %s", op.InodeId, len(op.Blocks), op.Replication, perm(op.Permissions))
+	case opMkdir:
+		return op.Path, fmt.Sprintf("inode %d, %s", op.InodeId, perm(op.Permissions))
+	case opSymlink:
+		return op.Path, fmt.Sprintf("inode %d -> %s", op.InodeId, op.Dst)
+	case opRename, opRenameOld:
+		return op.Path, "-> " + op.Dst
+	case opConcatDelete:
+		return op.Path, "<- " + strings.Join(op.Srcs, ", ")
+	case opSetReplication:
+		return op.Path, fmt.Sprintf("replication %d", op.Replication)
+	case opSetPermissions:
+		return op.Path, formatPermissionBits(op.Mode)
+	case opSetOwner:
+		return op.Path, op.User + ":" + op.Group
+	case opTimes:
+		return op.Path, fmt.Sprintf("mtime %d, atime %d", op.Mtime, op.Atime)
+	case opSetQuota, opSetNSQuota:
+		return op.Path, fmt.Sprintf("ns %d, ds %d", op.NsQuota, op.DsQuota)
+	case opSetQuotaByStorageType:
+		return op.Path, fmt.Sprintf("%s %d", op.StorageType, op.DsQuota)
+	case opAddBlock, opUpdateBlocks:
+		return op.Path, fmt.Sprintf("%d blocks", len(op.Blocks))
+	case opTruncate:
+		return op.Path, fmt.Sprintf("to %d bytes", op.NewLength)
+	case opAppend:
+		return op.Path, "by " + op.ClientName
+	case opReassignLease:
+		return op.Path, op.LeaseHolder + " -> " + op.ClientName
+	case opSetStoragePolicy:
+		return op.Path, fmt.Sprintf("policy %d", op.StoragePolicy)
+	case opSetAcl:
+		return op.Path, fmt.Sprintf("%d entries", len(op.Acl))
+	case opSetXAttr, opRemoveXAttr:
+		names := make([]string, 0, len(op.XAttrs))
+		for _, x := range op.XAttrs {
+			names = append(names, strings.ToLower(x.GetNamespace().String())+"."+x.GetName())
+		}
+		return op.Path, strings.Join(names, ", ")
+	case opCreateSnapshot, opDeleteSnapshot:
+		return op.Path, op.SnapshotName
+	case opRenameSnapshot:
+		return op.Path, op.SnapshotName + " -> " + op.NewName
+	case opSetGenstampV1, opSetGenstampV2, opAllocateBlockId, opRollingUpgradeStart, opRollingUpgradeFinalize:
+		return "", strconv.FormatInt(op.Value, 10)
+	case opGetDelegationToken, opRenewDelegationToken, opCancelDelegationToken:
+		return "", fmt.Sprintf("owner %s, sequence %d", op.Token.Owner, op.Token.SequenceNumber)
+	case opUpdateMasterKey:
+		return "", fmt.Sprintf("key %d", op.Key.Id)
+	case opAddCacheDirective, opModifyCacheDirective, opRemoveCacheDirective:
+		details := fmt.Sprintf("directive %d", op.Directive.GetId())
+		if op.Directive.Pool != nil {
+			details += " in " + op.Directive.GetPool()
+		}
+		return op.Directive.GetPath(), details
+	case opAddCachePool, opModifyCachePool, opRemoveCachePool:
+		return "", "pool " + op.Pool.GetPoolName()
+	case opEnableErasureCodingPolicy, opDisableErasureCodingPolicy, opRemoveErasureCodingPolicy:
+		return "", op.PolicyName
+	}
+	if op.Body != nil {
+		return op.Path, fmt.Sprintf("%d bytes", len(op.Body))
+	}
+	return op.Path, ""
+}
+
+// runEdits implements the `edits` subcommand, a listing of the ops in
+// edit log segments.
+func runEdits(args []string) {
+	fs := flag.NewFlagSet("edits", flag.ExitOnError)
+	from := fs.Int64("from-txid", 0, "list transactions after this one")
+	output := fs.String("o", "", "write to this file instead of stdout")
+	registerParseFlags(fs)
+	registerLogFlags(fs)
+	fs.Usage = commandUsage(fs, "[flags] <edits file or directory>...",
+		"Directories are searched for edits_<first>-<last> and edits_inprogress_<first> segments.")
+	parseArgs(fs, args, 1)
+
+	segments, err := findEditSegments(fs.Args())
+	logIfErr(err)
+	out, err := createOutput(*output, OutputOptions{})
+	logIfErr(err)
+	w := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(w, "TxId\tOp\tPath\tDetails\n")
+	n := 0
+	last, err := forEachEdit(segments, *from, func(op *EditOp) error {
+		path, details := op.describe()
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", op.TxId, op.Code, convertSpecialSymbols(path), convertSpecialSymbols(details))
+		n++
+		return nil
+	})
+	logIfErr(err)
+	logIfErr(w.Flush())
+	logIfErr(out.Close())
+	infof("read %d transactions from %d segments, last txid %d", n, len(segments), last)
+}
@@ -0,0 +1,503 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+	"slices"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	hd "hdfs-fsimage-parse-go/pkg/hadoop_hdfs"
+
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+)
+
+var errEditStringLength = errors.New("string longer than 65535 bytes")
+
+// EditLogWriter writes an edits segment: the layout version and flags,
+// then every op framed by its opcode, length, txid and CRC32 checksum as
+// FSEditLogOp.Writer frames it.
+type EditLogWriter struct {
+	w       *bufio.Writer
+	version int32
+	buf     editWriter
+}
+
+// NewEditLogWriter writes the segment header to w. Ops are encoded for
+// the given layout version.
+func NewEditLogWriter(w io.Writer, version int32) (*EditLogWriter, error) {
+	if version > layoutEditLogLength {
+		return nil, fmt.Errorf("layout version %d is older than %d, ops without lengths are not supported",
+			version, layoutEditLogLength)
+	}
+	ew := &EditLogWriter{w: bufio.NewWriterSize(w, 1<<20), version: version}
+	var header [8]byte
+	binary.BigEndian.PutUint32(header[:4], uint32(version))
+	_, err := ew.w.Write(header[:])
+	return ew, err
+}
+
+// WriteOp encodes op and appends it to the segment.
+func (ew *EditLogWriter) WriteOp(op *EditOp) error {
+	w := &ew.buf
+	w.buf, w.err = append(w.buf[:0], byte(op.Code), 0, 0, 0, 0), nil
+	w.long(op.TxId)
+	op.writeFields(w, ew.version)
+	if w.err != nil {
+		return fmt.Errorf("%s txid %d: %w", op.Code, op.TxId, w.err)
+	}
+	// the length counts the txid, the body and the checksum
+	length := len(w.buf) - 5 + 4
+	if length > maxEditOpSize {
+		return fmt.Errorf("%s txid %d: op of %d bytes is larger than %d", op.Code, op.TxId, length, maxEditOpSize)
+	}
+	binary.BigEndian.PutUint32(w.buf[1:5], uint32(length))
+	w.buf = binary.BigEndian.AppendUint32(w.buf, crc32.ChecksumIEEE(w.buf))
+	_, err := ew.w.Write(w.buf)
+	return err
+}
+
+// Flush writes buffered ops to the underlying writer, which it does not
+// close.
+func (ew *EditLogWriter) Flush() error {
+	return ew.w.Flush()
+}
+
+// editWriter encodes what editReader decodes. The first error sticks.
+type editWriter struct {
+	buf []byte
+	err error
+}
+
+func (w *editWriter) long(v int64) {
+	w.buf = binary.BigEndian.AppendUint64(w.buf, uint64(v))
+}
+
+func (w *editWriter) int(v int32) {
+	w.buf = binary.BigEndian.AppendUint32(w.buf, uint32(v))
+}
+
+func (w *editWriter) short(v int16) {
+	w.buf = binary.BigEndian.AppendUint16(w.buf, uint16(v))
+}
+
+func (w *editWriter) byte(v int8) {
+	w.buf = append(w.buf, byte(v))
+}
+
+func (w *editWriter) bool(v bool) {
+	if v {
+		w.byte(1)
+	} else {
+		w.byte(0)
+	}
+}
+
+// string writes FSImageSerialization.writeString.
+func (w *editWriter) string(s string) {
+	w.bytes(encodeModifiedUTF8(s))
+}
+
+// encodeModifiedUTF8 splits characters outside the BMP into surrogates
+// as DataOutput.writeUTF does; other strings are written unchanged.
+func encodeModifiedUTF8(s string) []byte {
+	b := make([]byte, 0, len(s))
+	for _, c := range s {
+		if c < 0x10000 {
+			b = utf8.AppendRune(b, c)
+			continue
+		}
+		r1, r2 := utf16.EncodeRune(c)
+		b = append(b, 0xe0|byte(r1>>12), 0x80|byte(r1>>6)&0x3f, 0x80|byte(r1)&0x3f)
+		b = append(b, 0xe0|byte(r2>>12), 0x80|byte(r2>>6)&0x3f, 0x80|byte(r2)&0x3f)
+	}
+	return b
+}
+
+// text writes Text.writeString.
+func (w *editWriter) text(s string) {
+	w.vlong(int64(len(s)))
+	w.buf = append(w.buf, s...)
+}
+
+// bytes writes FSImageSerialization.writeBytes.
+func (w *editWriter) bytes(b []byte) {
+	if len(b) > math.MaxUint16 {
+		if w.err == nil {
+			w.err = errEditStringLength
+		}
+		return
+	}
+	w.short(int16(uint16(len(b))))
+	w.buf = append(w.buf, b...)
+}
+
+// vlong writes WritableUtils.writeVLong.
+func (w *editWriter) vlong(v int64) {
+	if v >= -112 && v <= 127 {
+		w.byte(int8(v))
+		return
+	}
+	first := -112
+	if v < 0 {
+		v = ^v
+		first = -120
+	}
+	n := 0
+	for tmp := v; tmp != 0; tmp >>= 8 {
+		n++
+	}
+	w.byte(int8(first - n))
+	for i := n - 1; i >= 0; i-- {
+		w.buf = append(w.buf, byte(v>>(8*i)))
+	}
+}
+
+func (w *editWriter) vint(v int32) {
+	w.vlong(int64(v))
+}
+
+func (w *editWriter) rpcIds(op *EditOp) {
+	w.bytes(op.RpcClientId)
+	w.int(op.RpcCallId)
+}
+
+func (w *editWriter) permission(p *EditPermission) {
+	if p == nil {
+		p = &EditPermission{}
+	}
+	w.text(p.User)
+	w.text(p.Group)
+	w.short(int16(p.Mode))
+}
+
+func (w *editWriter) blocks(blocks []EditBlock) {
+	w.int(int32(len(blocks)))
+	for _, b := range blocks {
+		w.long(b.Id)
+		w.long(b.NumBytes)
+		w.long(b.GenStamp)
+	}
+}
+
+func (w *editWriter) compactBlocks(blocks []EditBlock) {
+	w.vlong(int64(len(blocks)))
+	var prev EditBlock
+	for _, b := range blocks {
+		w.long(b.Id)
+		w.vlong(b.NumBytes - prev.NumBytes)
+		w.vlong(b.GenStamp - prev.GenStamp)
+		prev = b
+	}
+}
+
+func (w *editWriter) acl(entries []*hd.AclEntryProto) {
+	w.int(int32(len(entries)))
+	for _, e := range entries {
+		v := int8(e.GetScope())<<5 | int8(e.GetType())<<3 | int8(e.GetPermissions())
+		if e.Name != nil {
+			v |= 1 << 6
+		}
+		w.byte(v)
+		if e.Name != nil {
+			w.string(e.GetName())
+		}
+	}
+}
+
+func (w *editWriter) token(t *EditToken) {
+	if t == nil {
+		t = &EditToken{}
+	}
+	w.byte(0)
+	w.text(t.Owner)
+	w.text(t.Renewer)
+	w.text(t.RealUser)
+	w.vlong(t.IssueDate)
+	w.vlong(t.MaxDate)
+	w.vint(t.SequenceNumber)
+	w.vint(t.MasterKeyId)
+}
+
+func (w *editWriter) key(k *EditKey) {
+	if k == nil {
+		k = &EditKey{}
+	}
+	w.vint(k.Id)
+	w.vlong(k.ExpiryDate)
+	if k.Key == nil {
+		w.vint(-1)
+		return
+	}
+	w.vint(int32(len(k.Key)))
+	w.buf = append(w.buf, k.Key...)
+}
+
+func (w *editWriter) directive(d *hd.CacheDirectiveInfoProto) {
+	w.long(d.GetId())
+	var flags int32
+	if d.Path != nil {
+		flags |= cacheDirectivePath
+	}
+	if d.Replication != nil {
+		flags |= cacheDirectiveReplication
+	}
+	if d.Pool != nil {
+		flags |= cacheDirectivePool
+	}
+	if d.Expiration != nil {
+		flags |= cacheDirectiveExpiration
+	}
+	w.int(flags)
+	if d.Path != nil {
+		w.string(d.GetPath())
+	}
+	if d.Replication != nil {
+		w.short(int16(d.GetReplication()))
+	}
+	if d.Pool != nil {
+		w.string(d.GetPool())
+	}
+	if d.Expiration != nil {
+		w.long(d.GetExpiration().GetMillis())
+	}
+}
+
+func (w *editWriter) pool(p *hd.CachePoolInfoProto) {
+	w.string(p.GetPoolName())
+	var flags int32
+	if p.OwnerName != nil {
+		flags |= cachePoolOwner
+	}
+	if p.GroupName != nil {
+		flags |= cachePoolGroup
+	}
+	if p.Mode != nil {
+		flags |= cachePoolMode
+	}
+	if p.Limit != nil {
+		flags |= cachePoolLimit
+	}
+	if p.MaxRelativeExpiry != nil {
+		flags |= cachePoolMaxRelativeExpiry
+	}
+	if p.DefaultReplication != nil {
+		flags |= cachePoolDefaultReplication
+	}
+	w.int(flags)
+	if p.OwnerName != nil {
+		w.string(p.GetOwnerName())
+	}
+	if p.GroupName != nil {
+		w.string(p.GetGroupName())
+	}
+	if p.Mode != nil {
+		w.short(int16(p.GetMode()))
+	}
+	if p.Limit != nil {
+		w.long(p.GetLimit())
+	}
+	if p.MaxRelativeExpiry != nil {
+		w.long(p.GetMaxRelativeExpiry())
+	}
+	if p.DefaultReplication != nil {
+		w.short(int16(p.GetDefaultReplication()))
+	}
+}
+
+// delimited writes a varint-delimited protobuf message.
+func (w *editWriter) delimited(m proto.Message) {
+	b, err := proto.Marshal(m)
+	if err != nil {
+		if w.err == nil {
+			w.err = err
+		}
+		return
+	}
+	w.buf = protowire.AppendVarint(w.buf, uint64(len(b)))
+	w.buf = append(w.buf, b...)
+}
+
+// writeFields encodes the body of op, mirroring readFields.
+func (op *EditOp) writeFields(w *editWriter, version int32) {
+	switch op.Code {
+	case opAdd, opClose:
+		w.long(op.InodeId)
+		w.string(op.Path)
+		w.short(op.Replication)
+		w.long(op.Mtime)
+		w.long(op.Atime)
+		w.long(op.BlockSize)
+		w.blocks(op.Blocks)
+		w.permission(op.Permissions)
+		if op.Code == opClose {
+			break
+		}
+		w.acl(op.Acl)
+		if version <= layoutXAttrs {
+			w.delimited(&hd.XAttrEditLogProto{XAttrs: op.XAttrs})
+		}
+		w.string(op.ClientName)
+		w.string(op.ClientMachine)
+		if version <= layoutCreateOverwrite {
+			w.bool(op.Overwrite)
+		}
+		if version <= layoutBlockStoragePolicy {
+			w.byte(op.StoragePolicy)
+		}
+		if version <= layoutErasureCoding {
+			w.byte(op.ECPolicy)
+		}
+		w.rpcIds(op)
+	case opMkdir:
+		w.long(op.InodeId)
+		w.string(op.Path)
+		w.long(op.Mtime)
+		w.long(op.Atime)
+		w.permission(op.Permissions)
+		w.acl(op.Acl)
+		if version <= layoutXAttrs {
+			w.delimited(&hd.XAttrEditLogProto{XAttrs: op.XAttrs})
+		}
+	case opSymlink:
+		w.long(op.InodeId)
+		w.string(op.Path)
+		w.string(op.Dst)
+		w.long(op.Mtime)
+		w.long(op.Atime)
+		w.permission(op.Permissions)
+		w.rpcIds(op)
+	case opDelete:
+		w.string(op.Path)
+		w.long(op.Mtime)
+		w.rpcIds(op)
+	case opRenameOld:
+		w.string(op.Path)
+		w.string(op.Dst)
+		w.long(op.Mtime)
+		w.rpcIds(op)
+	case opRename:
+		w.string(op.Path)
+		w.string(op.Dst)
+		w.long(op.Mtime)
+		w.int(int32(len(op.RenameOptions)))
+		w.buf = append(w.buf, op.RenameOptions...)
+		w.rpcIds(op)
+	case opConcatDelete:
+		w.string(op.Path)
+		w.int(int32(len(op.Srcs)))
+		for _, src := range op.Srcs {
+			w.string(src)
+		}
+		w.long(op.Mtime)
+		w.rpcIds(op)
+	case opSetReplication:
+		w.string(op.Path)
+		w.short(op.Replication)
+	case opSetPermissions:
+		w.string(op.Path)
+		w.short(int16(op.Mode))
+	case opSetOwner:
+		w.string(op.Path)
+		w.string(op.User)
+		w.string(op.Group)
+	case opTimes:
+		w.string(op.Path)
+		w.long(op.Mtime)
+		w.long(op.Atime)
+	case opSetNSQuota:
+		w.string(op.Path)
+		w.long(op.NsQuota)
+	case opClearNSQuota, opAllowSnapshot, opDisallowSnapshot:
+		w.string(op.Path)
+	case opSetQuota:
+		w.string(op.Path)
+		w.long(op.NsQuota)
+		w.long(op.DsQuota)
+	case opSetQuotaByStorageType:
+		w.string(op.Path)
+		i := slices.Index(storageTypes(version), op.StorageType)
+		if i < 0 && w.err == nil {
+			w.err = fmt.Errorf("storage type %s is not in layout version %d", op.StorageType, version)
+		}
+		w.int(int32(i))
+		w.long(op.DsQuota)
+	case opReassignLease:
+		w.string(op.LeaseHolder)
+		w.string(op.Path)
+		w.string(op.ClientName)
+	case opAddBlock, opUpdateBlocks:
+		w.string(op.Path)
+		w.compactBlocks(op.Blocks)
+		w.rpcIds(op)
+	case opTruncate:
+		w.string(op.Path)
+		w.string(op.ClientName)
+		w.string(op.ClientMachine)
+		w.long(op.NewLength)
+		w.long(op.Mtime)
+		w.compactBlocks(op.Blocks)
+	case opAppend:
+		w.string(op.Path)
+		w.string(op.ClientName)
+		w.string(op.ClientMachine)
+		w.bool(op.NewBlock)
+		w.rpcIds(op)
+	case opSetStoragePolicy:
+		w.string(op.Path)
+		w.byte(op.StoragePolicy)
+	case opSetAcl:
+		w.delimited(&hd.AclEditLogProto{Src: proto.String(op.Path), Entries: op.Acl})
+	case opSetXAttr, opRemoveXAttr:
+		w.delimited(&hd.XAttrEditLogProto{Src: proto.String(op.Path), XAttrs: op.XAttrs})
+		w.rpcIds(op)
+	case opCreateSnapshot, opDeleteSnapshot:
+		w.string(op.Path)
+		w.string(op.SnapshotName)
+		w.rpcIds(op)
+		if version <= layoutSnapshotModificationTime {
+			w.long(op.Mtime)
+		}
+	case opRenameSnapshot:
+		w.string(op.Path)
+		w.string(op.SnapshotName)
+		w.string(op.NewName)
+		w.rpcIds(op)
+		if version <= layoutSnapshotModificationTime {
+			w.long(op.Mtime)
+		}
+	case opSetGenstampV1, opSetGenstampV2, opAllocateBlockId, opRollingUpgradeStart, opRollingUpgradeFinalize:
+		w.long(op.Value)
+	case opGetDelegationToken, opRenewDelegationToken:
+		w.token(op.Token)
+		w.long(op.Value)
+	case opCancelDelegationToken:
+		w.token(op.Token)
+	case opUpdateMasterKey:
+		w.key(op.Key)
+	case opAddCacheDirective, opModifyCacheDirective:
+		w.directive(op.Directive)
+		w.rpcIds(op)
+	case opRemoveCacheDirective:
+		w.long(op.Directive.GetId())
+		w.rpcIds(op)
+	case opAddCachePool, opModifyCachePool:
+		w.pool(op.Pool)
+		w.rpcIds(op)
+	case opRemoveCachePool:
+		w.string(op.Pool.GetPoolName())
+		w.rpcIds(op)
+	case opEnableErasureCodingPolicy, opDisableErasureCodingPolicy, opRemoveErasureCodingPolicy:
+		w.string(op.PolicyName)
+		w.rpcIds(op)
+	case opStartLogSegment, opEndLogSegment:
+	default:
+		w.buf = append(w.buf, op.Body...)
+	}
+}
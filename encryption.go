@@ -0,0 +1,235 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"text/tabwriter"
+
+	hd "hdfs-fsimage-parse-go/pkg/hadoop_hdfs"
+	pb "hdfs-fsimage-parse-go/pkg/hadoop_hdfs_fsimage"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// Names of the raw xattrs in which the namenode keeps encryption zone
+// and per-file encryption info, see HdfsServerConstants.
+const (
+	cryptoXAttrEncryptionZone     = "raw.hdfs.crypto.encryption.zone"
+	cryptoXAttrFileEncryptionInfo = "raw.hdfs.crypto.file.encryption.info"
+)
+
+// findXAttr returns the value of the xattr with the given full name.
+func findXAttr(inode *pb.INodeSection_INode, name string) ([]byte, bool) {
+	for _, x := range inodeXAttrs(inode) {
+		if x.FullName() == name {
+			return x.Value, true
+		}
+	}
+	return nil, false
+}
+
+// EncryptionReport is the result of `encryption`, also its JSON output.
+type EncryptionReport struct {
+	Image        string           `json:"image"`
+	Zones        []EncryptionZone `json:"zones"`
+	MissingFiles []MissingFile    `json:"missing_files"`
+}
+
+// EncryptionZone is a zone root and the files below it. A nested zone
+// takes its files out of the enclosing one.
+type EncryptionZone struct {
+	Path                  string        `json:"path"`
+	InodeId               uint64        `json:"inode_id"`
+	KeyName               string        `json:"key_name"`
+	CipherSuite           string        `json:"cipher_suite"`
+	CryptoProtocolVersion string        `json:"crypto_protocol_version"`
+	Reencryption          *Reencryption `json:"reencryption,omitempty"`
+	Error                 string        `json:"error,omitempty"` // the zone xattr could not be decoded
+	Files                 uint64        `json:"files"`
+	Bytes                 uint64        `json:"bytes"`
+	MissingFiles          uint64        `json:"missing_files"`
+}
+
+// Reencryption is the last re-encryption of a zone, from
+// ReencryptionInfoProto.
+type Reencryption struct {
+	EzKeyVersionName string `json:"ez_key_version_name"`
+	Submitted        string `json:"submitted"`
+	Completed        string `json:"completed,omitempty"`
+	Canceled         bool   `json:"canceled"`
+	Reencrypted      int64  `json:"reencrypted"`
+	Failures         int64  `json:"failures"`
+	LastFile         string `json:"last_file,omitempty"`
+}
+
+// MissingFile is a file inside a zone without usable per-file
+// encryption info.
+type MissingFile struct {
+	Path   string `json:"path"`
+	Zone   string `json:"zone"`
+	Reason string `json:"reason"`
+}
+
+// runEncryption implements the `encryption` subcommand, an inventory of
+// the encryption zones in the namespace.
+func runEncryption(args []string) {
+	fs := flag.NewFlagSet("encryption", flag.ExitOnError)
+	format := fs.String("format", "text", "output format: text or json")
+	human := fs.Bool("h", false, "print sizes as 1.5 G instead of bytes")
+	output := fs.String("o", "", "write to this file instead of stdout")
+	registerEditsFlags(fs)
+	registerParseFlags(fs)
+	registerLogFlags(fs)
+	fs.Usage = commandUsage(fs, "[flags] <fsimage>")
+	parseArgs(fs, args, 1)
+
+	if *format != "text" && *format != "json" {
+		log.Fatalf("unknown format %q (want text or json)", *format)
+	}
+	f, sectionMap, err := openImage(fs.Arg(0))
+	logIfErr(err)
+	defer f.Close()
+	ns, err := loadNamespace(f, sectionMap)
+	logIfErr(err)
+
+	report := buildEncryptionReport(ns)
+	report.Image = fs.Arg(0)
+	infof("found %d encryption zones, %d files without encryption info", len(report.Zones), len(report.MissingFiles))
+
+	out, err := createOutput(*output, OutputOptions{})
+	logIfErr(err)
+	if *format == "json" {
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		logIfErr(enc.Encode(report))
+	} else {
+		logIfErr(writeEncryptionReport(out, report, *human))
+	}
+	logIfErr(out.Close())
+}
+
+// buildEncryptionReport walks the namespace once. Zone roots are visited
+// before their contents, so every file finds its zone among the ones
+// already seen.
+func buildEncryptionReport(ns *Namespace) *EncryptionReport {
+	report := &EncryptionReport{Zones: []EncryptionZone{}, MissingFiles: []MissingFile{}}
+	zones := make(map[string]int) // path to index in report.Zones
+	ns.Walk(nil, func(inode *pb.INodeSection_INode, path string) {
+		switch inode.GetType() {
+		case pb.INodeSection_INode_DIRECTORY:
+			if value, ok := findXAttr(inode, cryptoXAttrEncryptionZone); ok {
+				zones[path] = len(report.Zones)
+				report.Zones = append(report.Zones, decodeEncryptionZone(inode.GetId(), path, value))
+			}
+		case pb.INodeSection_INode_FILE:
+			i, ok := enclosingZone(zones, path)
+			if !ok {
+				return
+			}
+			zone := &report.Zones[i]
+			zone.Files++
+			zone.Bytes += getFileSize(inode.GetFile())
+
+			reason := ""
+			if value, ok := findXAttr(inode, cryptoXAttrFileEncryptionInfo); !ok {
+				reason = "no encryption info"
+			} else if err := proto.Unmarshal(value, &hd.PerFileEncryptionInfoProto{}); err != nil {
+				reason = fmt.Sprintf("undecodable encryption info: %v", err)
+			}
+			if reason != "" {
+				zone.MissingFiles++
+				report.MissingFiles = append(report.MissingFiles, MissingFile{Path: path, Zone: zone.Path, Reason: reason})
+			}
+		}
+	})
+	return report
+}
+
+// enclosingZone finds the innermost zone root above path.
+func enclosingZone(zones map[string]int, path string) (int, bool) {
+	if len(zones) == 0 {
+		return 0, false
+	}
+	for dir := path; dir != "/"; {
+		slash := strings.LastIndexByte(dir, '/')
+		dir = dir[:slash]
+		if dir == "" {
+			dir = "/"
+		}
+		if i, ok := zones[dir]; ok {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+func decodeEncryptionZone(id uint64, path string, value []byte) EncryptionZone {
+	zone := EncryptionZone{Path: path, InodeId: id}
+	info := &hd.ZoneEncryptionInfoProto{}
+	if err := proto.Unmarshal(value, info); err != nil {
+		log.Printf("warning: %s: undecodable %s: %v", path, cryptoXAttrEncryptionZone, err)
+		zone.Error = err.Error()
+		return zone
+	}
+	zone.KeyName = info.GetKeyName()
+	zone.CipherSuite = info.GetSuite().String()
+	zone.CryptoProtocolVersion = info.GetCryptoProtocolVersion().String()
+	if r := info.GetReencryptionProto(); r != nil {
+		zone.Reencryption = &Reencryption{
+			EzKeyVersionName: r.GetEzKeyVersionName(),
+			Submitted:        formatTime(r.GetSubmissionTime()),
+			Canceled:         r.GetCanceled(),
+			Reencrypted:      r.GetNumReencrypted(),
+			Failures:         r.GetNumFailures(),
+			LastFile:         r.GetLastFile(),
+		}
+		if r.CompletionTime != nil {
+			zone.Reencryption.Completed = formatTime(r.GetCompletionTime())
+		}
+	}
+	return zone
+}
+
+func writeEncryptionReport(out io.Writer, r *EncryptionReport, human bool) error {
+	size := func(n uint64) string {
+		if human {
+			return formatSize(n)
+		}
+		return fmt.Sprint(n)
+	}
+	w := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(w, "Zone\tKey\tCipherSuite\tProtocolVersion\tFiles\tBytes\tMissing\tReencryption\n")
+	for _, z := range r.Zones {
+		if z.Error != "" {
+			fmt.Fprintf(w, "%s\t<undecodable: %s>\t\t\t%d\t%s\t%d\t-\n", convertSpecialSymbols(z.Path), z.Error,
+				z.Files, size(z.Bytes), z.MissingFiles)
+			continue
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%s\t%d\t%s\n", convertSpecialSymbols(z.Path), convertSpecialSymbols(z.KeyName),
+			z.CipherSuite, z.CryptoProtocolVersion, z.Files, size(z.Bytes), z.MissingFiles, formatReencryption(z.Reencryption))
+	}
+
+	if len(r.MissingFiles) > 0 {
+		fmt.Fprintf(w, "\nZone\tReason\tPath\n")
+		for _, m := range r.MissingFiles {
+			fmt.Fprintf(w, "%s\t%s\t%s\n", convertSpecialSymbols(m.Zone), m.Reason, convertSpecialSymbols(m.Path))
+		}
+	}
+	return w.Flush()
+}
+
+func formatReencryption(r *Reencryption) string {
+	switch {
+	case r == nil:
+		return "-"
+	case r.Canceled:
+		return fmt.Sprintf("%s canceled", r.EzKeyVersionName)
+	case r.Completed != "":
+		return fmt.Sprintf("%s completed %s, %d files, %d failures", r.EzKeyVersionName, r.Completed, r.Reencrypted, r.Failures)
+	}
+	return fmt.Sprintf("%s submitted %s, %d files so far", r.EzKeyVersionName, r.Submitted, r.Reencrypted)
+}
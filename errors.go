@@ -0,0 +1,216 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+
+	pb "hdfs-fsimage-parse-go/pkg/hadoop_hdfs_fsimage"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// SectionError locates a problem in an fsimage by section name, the
+// absolute file offset and the index of the record within the section.
+type SectionError struct {
+	Section string
+	Offset  int64
+	Record  int // -1 when the error concerns the section itself
+	Err     error
+}
+
+func (e *SectionError) Error() string {
+	if e.Record < 0 {
+		return fmt.Sprintf("%s section at offset %d: %v", e.Section, e.Offset, e.Err)
+	}
+	return fmt.Sprintf("%s record %d at offset %d: %v", e.Section, e.Record, e.Offset, e.Err)
+}
+
+func (e *SectionError) Unwrap() error {
+	return e.Err
+}
+
+var (
+	errBadRecordLength  = errors.New("invalid record length prefix")
+	errTruncatedRecord  = errors.New("record runs past the end of the section")
+	errTruncatedSection = errors.New("section runs past the end of the file")
+)
+
+// maxReportedErrors bounds the errors kept by ParseReport; counts are
+// always complete.
+const maxReportedErrors = 20
+
+// ParseReport collects records skipped while parsing. In lenient mode
+// (the default) a bad record is counted and skipped, in strict mode the
+// first one aborts parsing with its location.
+type ParseReport struct {
+	Strict  bool
+	Skipped map[string]int
+	Errors  []*SectionError
+}
+
+var parseReport = &ParseReport{Skipped: make(map[string]int)}
+
+func registerParseFlags(fs *flag.FlagSet) {
+	fs.BoolVar(&parseReport.Strict, "strict", false, "abort on the first corrupt record instead of skipping it")
+}
+
+// add records err and returns it in strict mode, nil otherwise.
+func (r *ParseReport) add(err *SectionError) error {
+	if r.Strict {
+		return err
+	}
+	r.Skipped[err.Section]++
+	if len(r.Errors) < maxReportedErrors {
+		r.Errors = append(r.Errors, err)
+	}
+	return nil
+}
+
+// reset forgets the skipped records, before the next image is parsed.
+func (r *ParseReport) reset() {
+	r.Skipped = make(map[string]int)
+	r.Errors = nil
+}
+
+// Total is the number of skipped records over all sections.
+func (r *ParseReport) Total() int {
+	total := 0
+	for _, n := range r.Skipped {
+		total += n
+	}
+	return total
+}
+
+// Log prints the report to stderr if anything was skipped.
+func (r *ParseReport) Log() {
+	if r.Total() == 0 {
+		return
+	}
+	sections := make([]string, 0, len(r.Skipped))
+	for s := range r.Skipped {
+		sections = append(sections, s)
+	}
+	sort.Strings(sections)
+	log.Printf("WARNING: %d corrupt records skipped, output is incomplete", r.Total())
+	for _, s := range sections {
+		log.Printf("  %s: %d skipped", s, r.Skipped[s])
+	}
+	for _, err := range r.Errors {
+		log.Printf("  %v", err)
+	}
+	if len(r.Errors) < r.Total() {
+		log.Printf("  ... %d more", r.Total()-len(r.Errors))
+	}
+}
+
+// recordReader walks the varint-delimited records of one section.
+type recordReader struct {
+	section string
+	base    int64 // file offset of buf[0]
+	buf     []byte
+	pos     int
+	index   int
+	last    int // offset in buf of the last record returned
+}
+
+// readSection loads a whole section into memory.
+func readSection(info *pb.FileSummary_Section, imageFile io.ReaderAt) (*recordReader, error) {
+	r := &recordReader{section: info.GetName(), base: int64(info.GetOffset()), index: -1}
+	debugf("reading %s: %d bytes at offset %d", r.section, info.GetLength(), r.base)
+	r.buf = make([]byte, info.GetLength())
+	n, err := imageFile.ReadAt(r.buf, r.base)
+	if err == io.EOF && n < len(r.buf) {
+		err = errTruncatedSection
+	}
+	if err != nil && err != io.EOF {
+		return nil, &SectionError{Section: r.section, Offset: r.base, Record: -1, Err: err}
+	}
+	return r, nil
+}
+
+// next returns the next record, io.EOF at the end of the section or a
+// *SectionError when the framing is broken. Framing errors cannot be
+// skipped, the rest of the section is lost.
+func (r *recordReader) next() ([]byte, error) {
+	if r.pos >= len(r.buf) {
+		return nil, io.EOF
+	}
+	r.index++
+	r.last = r.pos
+	record, rest, ok := readDelimited(r.buf[r.pos:])
+	if !ok {
+		err := errTruncatedRecord
+		if _, c := binary.Uvarint(r.buf[r.pos:]); c <= 0 {
+			err = errBadRecordLength
+		}
+		r.pos = len(r.buf)
+		return nil, r.fail(err)
+	}
+	r.pos = len(r.buf) - len(rest)
+	return record, nil
+}
+
+// fail wraps err with the location of the last record returned.
+func (r *recordReader) fail(err error) *SectionError {
+	return &SectionError{Section: r.section, Offset: r.base + int64(r.last), Record: r.index, Err: err}
+}
+
+// forEachRecord calls fn for every record of a section. When header is
+// not nil the first record is unmarshalled into it. Errors returned by
+// fn and framing errors go through parseReport.
+func forEachRecord(info *pb.FileSummary_Section, imageFile io.ReaderAt, header proto.Message, fn func(record []byte) error) error {
+	if info == nil {
+		return nil
+	}
+	r, err := readSection(info, imageFile)
+	if err != nil {
+		return parseReport.add(sectionError(info, err))
+	}
+	if header != nil {
+		record, err := r.next()
+		if err == nil {
+			err = proto.Unmarshal(record, header)
+		}
+		if err != nil && err != io.EOF {
+			// without the header the records cannot be trusted
+			return parseReport.add(asSectionError(r, err))
+		}
+	}
+	for {
+		record, err := r.next()
+		if err == io.EOF {
+			return nil
+		}
+		if err == nil {
+			err = fn(record)
+		}
+		if err != nil {
+			if err := parseReport.add(asSectionError(r, err)); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// sectionError is asSectionError for errors about a whole section,
+// before there is a reader.
+func sectionError(info *pb.FileSummary_Section, err error) *SectionError {
+	var se *SectionError
+	if errors.As(err, &se) {
+		return se
+	}
+	return &SectionError{Section: info.GetName(), Offset: int64(info.GetOffset()), Record: -1, Err: err}
+}
+
+func asSectionError(r *recordReader, err error) *SectionError {
+	var se *SectionError
+	if errors.As(err, &se) {
+		return se
+	}
+	return r.fail(err)
+}
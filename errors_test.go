@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// writeCorruptSummary copies a generated image with the length of the
+// INODE section in its summary replaced.
+func writeCorruptSummary(t *testing.T, length uint64) string {
+	t.Helper()
+	image := writeTestImage(t, testGenerateOptions())
+	data, err := os.ReadFile(image)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(image)
+	if err != nil {
+		t.Fatal(err)
+	}
+	summary, summaryStart, err := readFileSummary(f, int64(len(data)))
+	f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range summary.GetSections() {
+		if s.GetName() == "INODE" {
+			s.Length = proto.Uint64(length)
+		}
+	}
+	msg, err := proto.Marshal(summary)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := binary.AppendUvarint(data[:summaryStart:summaryStart], uint64(len(msg)))
+	out = append(out, msg...)
+	out = binary.BigEndian.AppendUint32(out, uint32(len(out)-int(summaryStart)))
+	fileName := filepath.Join(t.TempDir(), "fsimage_corrupt")
+	if err := os.WriteFile(fileName, out, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return fileName
+}
+
+func TestSectionPastEndOfFile(t *testing.T) {
+	fileName := writeCorruptSummary(t, 1<<62)
+
+	f, sectionMap, err := openImage(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if sectionMap["INODE"] != nil {
+		t.Error("INODE is listed although it runs past the end of the file")
+	}
+	if parseReport.Skipped["INODE"] != 1 {
+		t.Errorf("INODE skipped %d times, want 1", parseReport.Skipped["INODE"])
+	}
+	if _, err := loadNamespace(f, sectionMap); err == nil {
+		t.Error("loaded a namespace without INODE")
+	}
+
+	resetNamespace()
+	parseReport.Strict = true
+	defer func() { parseReport.Strict = false }()
+	_, _, err = openImage(fileName)
+	var se *SectionError
+	if !errors.As(err, &se) || se.Section != "INODE" {
+		t.Errorf("strict open returned %v, want an INODE SectionError", err)
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+
+	pb "hdfs-fsimage-parse-go/pkg/hadoop_hdfs_fsimage"
+)
+
+type AclEntry struct {
+	Scope      string `json:"scope"` // access, default
+	Type       string `json:"type"`  // user, group, mask, other
+	Name       string `json:"name,omitempty"`
+	Permission string `json:"permission"`
+}
+
+type XAttr struct {
+	Namespace string `json:"namespace"` // user, trusted, security, system, raw
+	Name      string `json:"name"`
+	Value     []byte `json:"value,omitempty"`
+}
+
+var (
+	aclScopes       = []string{"access", "default"}
+	aclTypes        = []string{"user", "group", "mask", "other"}
+	xattrNamespaces = []string{"user", "trusted", "security", "system", "raw"}
+)
+
+// FullName is the xattr name as shown by `hdfs dfs -getfattr`.
+func (x XAttr) FullName() string {
+	return x.Namespace + "." + x.Name
+}
+
+// decodeAclEntry unpacks an AclFeatureProto entry, see the bit layout in
+// fsimage.proto.
+func decodeAclEntry(e uint32) AclEntry {
+	perm := uint16(e & 7)
+	typ := (e >> 3) & 3
+	scope := (e >> 5) & 1
+	nameId := (e >> 6) & 0xFFFFFF
+
+	entry := AclEntry{
+		Scope:      aclScopes[scope],
+		Type:       aclTypes[typ],
+		Permission: formatPermissionBits(perm)[6:],
+	}
+	if nameId != 0 {
+		switch typ {
+		case 0:
+			entry.Name = lookupUser(nameId)
+		case 1:
+			entry.Name = lookupGroup(nameId)
+		}
+	}
+	return entry
+}
+
+// decodeXAttr unpacks an XAttrCompactProto, see the bit layout in
+// fsimage.proto.
+func decodeXAttr(x *pb.INodeSection_XAttrCompactProto) XAttr {
+	v := x.GetName()
+	ns := (v >> 30) & 3
+	ns |= ((v >> 5) & 1) << 2
+	nameId := (v >> 6) & 0xFFFFFF
+
+	namespace := fmt.Sprintf("ns%d", ns)
+	if int(ns) < len(xattrNamespaces) {
+		namespace = xattrNamespaces[ns]
+	}
+	return XAttr{Namespace: namespace, Name: lookupXAttrName(nameId), Value: x.GetValue()}
+}
+
+func lookupXAttrName(id uint32) string {
+	if s, ok := stringMap[id|0x60000000]; ok {
+		return s
+	}
+	if s, ok := stringMap[id]; ok {
+		return s
+	}
+	return fmt.Sprintf("%d", id)
+}
+
+// inodeAcl returns the decoded ACL entries of a file or directory.
+func inodeAcl(inode *pb.INodeSection_INode) []AclEntry {
+	var acl *pb.INodeSection_AclFeatureProto
+	switch inode.GetType() {
+	case pb.INodeSection_INode_FILE:
+		acl = inode.GetFile().GetAcl()
+	case pb.INodeSection_INode_DIRECTORY:
+		acl = inode.GetDirectory().GetAcl()
+	}
+	if acl == nil {
+		return nil
+	}
+	entries := make([]AclEntry, 0, len(acl.GetEntries()))
+	for _, e := range acl.GetEntries() {
+		entries = append(entries, decodeAclEntry(e))
+	}
+	return entries
+}
+
+// inodeXAttrs returns the decoded extended attributes of a file or
+// directory.
+func inodeXAttrs(inode *pb.INodeSection_INode) []XAttr {
+	var xf *pb.INodeSection_XAttrFeatureProto
+	switch inode.GetType() {
+	case pb.INodeSection_INode_FILE:
+		xf = inode.GetFile().GetXAttrs()
+	case pb.INodeSection_INode_DIRECTORY:
+		xf = inode.GetDirectory().GetXAttrs()
+	}
+	if xf == nil {
+		return nil
+	}
+	attrs := make([]XAttr, 0, len(xf.GetXAttrs()))
+	for _, x := range xf.GetXAttrs() {
+		attrs = append(attrs, decodeXAttr(x))
+	}
+	return attrs
+}
+
+// inodePermission returns the packed permission of any inode type.
+func inodePermission(inode *pb.INodeSection_INode) uint64 {
+	switch inode.GetType() {
+	case pb.INodeSection_INode_FILE:
+		return inode.GetFile().GetPermission()
+	case pb.INodeSection_INode_DIRECTORY:
+		return inode.GetDirectory().GetPermission()
+	case pb.INodeSection_INode_SYMLINK:
+		return inode.GetSymlink().GetPermission()
+	}
+	return 0
+}
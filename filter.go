@@ -0,0 +1,441 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	pb "hdfs-fsimage-parse-go/pkg/hadoop_hdfs_fsimage"
+)
+
+// Filter decides which inodes end up in the export. Path predicates
+// (globs and anchored regexes) are also used to prune whole subtrees
+// during the walk, attribute predicates only filter emitted rows.
+type Filter struct {
+	Include      []*pathPattern
+	Exclude      []*pathPattern
+	Users        map[string]bool
+	Groups       map[string]bool
+	Types        map[pb.INodeSection_INode_Type]bool
+	MinSize      uint64
+	MaxSize      uint64
+	MtimeBefore  uint64
+	MtimeAfter   uint64
+	AtimeBefore  uint64
+	AtimeAfter   uint64
+	hasMaxSize   bool
+	hasAttrMatch bool
+}
+
+type pathPattern struct {
+	raw    string
+	re     *regexp.Regexp
+	prefix string // literal prefix every matching path starts with, "" if unknown
+}
+
+// stringList collects repeated flag values (-include a -include b) and
+// comma separated lists (-user a,b).
+type stringList []string
+
+func (s *stringList) String() string { return strings.Join(*s, ",") }
+
+func (s *stringList) Set(v string) error {
+	for _, part := range strings.Split(v, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			*s = append(*s, part)
+		}
+	}
+	return nil
+}
+
+// FilterOptions is the raw, flag level representation of a Filter.
+type FilterOptions struct {
+	IncludeGlobs  stringList
+	ExcludeGlobs  stringList
+	IncludeRegexs stringList
+	ExcludeRegexs stringList
+	Users         stringList
+	Groups        stringList
+	Types         stringList
+	MinSize       string
+	MaxSize       string
+	MtimeBefore   string
+	MtimeAfter    string
+	AtimeBefore   string
+	AtimeAfter    string
+}
+
+func registerFilterFlags(fs *flag.FlagSet, opts *FilterOptions) {
+	fs.Var(&opts.IncludeGlobs, "include", "only export paths matching this glob (repeatable, '**' crosses directories)")
+	fs.Var(&opts.ExcludeGlobs, "exclude", "skip paths matching this glob, excluded directories are not descended (repeatable)")
+	fs.Var(&opts.IncludeRegexs, "include-regex", "only export paths matching this regexp (repeatable)")
+	fs.Var(&opts.ExcludeRegexs, "exclude-regex", "skip paths matching this regexp (repeatable)")
+	fs.Var(&opts.Users, "user", "only export inodes owned by these users (comma separated)")
+	fs.Var(&opts.Groups, "group", "only export inodes owned by these groups (comma separated)")
+	fs.Var(&opts.Types, "type", "only export these inode types: file, dir, symlink (comma separated)")
+	fs.StringVar(&opts.MinSize, "min-size", "", "minimum file size, e.g. 128M")
+	fs.StringVar(&opts.MaxSize, "max-size", "", "maximum file size, e.g. 1G")
+	fs.StringVar(&opts.MtimeBefore, "mtime-before", "", "modified before a date (2024-01-31) or older than an age (90d)")
+	fs.StringVar(&opts.MtimeAfter, "mtime-after", "", "modified after a date (2024-01-31) or within an age (7d)")
+	fs.StringVar(&opts.AtimeBefore, "atime-before", "", "accessed before a date or older than an age")
+	fs.StringVar(&opts.AtimeAfter, "atime-after", "", "accessed after a date or within an age")
+}
+
+// NewFilter compiles opts. It returns nil when no predicate is set, so
+// callers can skip filtering entirely.
+func NewFilter(opts FilterOptions, now time.Time) (*Filter, error) {
+	f := &Filter{}
+	for _, g := range opts.IncludeGlobs {
+		p, err := compileGlob(g)
+		if err != nil {
+			return nil, err
+		}
+		f.Include = append(f.Include, p)
+	}
+	for _, g := range opts.ExcludeGlobs {
+		p, err := compileGlob(g)
+		if err != nil {
+			return nil, err
+		}
+		f.Exclude = append(f.Exclude, p)
+	}
+	for _, r := range opts.IncludeRegexs {
+		p, err := compileRegex(r)
+		if err != nil {
+			return nil, err
+		}
+		f.Include = append(f.Include, p)
+	}
+	for _, r := range opts.ExcludeRegexs {
+		p, err := compileRegex(r)
+		if err != nil {
+			return nil, err
+		}
+		f.Exclude = append(f.Exclude, p)
+	}
+	if len(opts.Users) > 0 {
+		f.Users = make(map[string]bool)
+		for _, u := range opts.Users {
+			f.Users[u] = true
+		}
+	}
+	if len(opts.Groups) > 0 {
+		f.Groups = make(map[string]bool)
+		for _, g := range opts.Groups {
+			f.Groups[g] = true
+		}
+	}
+	if len(opts.Types) > 0 {
+		f.Types = make(map[pb.INodeSection_INode_Type]bool)
+		for _, t := range opts.Types {
+			it, err := parseInodeType(t)
+			if err != nil {
+				return nil, err
+			}
+			f.Types[it] = true
+		}
+	}
+
+	var err error
+	if opts.MinSize != "" {
+		if f.MinSize, err = parseSize(opts.MinSize); err != nil {
+			return nil, err
+		}
+	}
+	if opts.MaxSize != "" {
+		if f.MaxSize, err = parseSize(opts.MaxSize); err != nil {
+			return nil, err
+		}
+		f.hasMaxSize = true
+	}
+	if f.MtimeBefore, err = parseTimeBound(opts.MtimeBefore, now); err != nil {
+		return nil, err
+	}
+	if f.MtimeAfter, err = parseTimeBound(opts.MtimeAfter, now); err != nil {
+		return nil, err
+	}
+	if f.AtimeBefore, err = parseTimeBound(opts.AtimeBefore, now); err != nil {
+		return nil, err
+	}
+	if f.AtimeAfter, err = parseTimeBound(opts.AtimeAfter, now); err != nil {
+		return nil, err
+	}
+
+	f.hasAttrMatch = f.Users != nil || f.Groups != nil || f.Types != nil ||
+		f.MinSize > 0 || f.hasMaxSize ||
+		f.MtimeBefore > 0 || f.MtimeAfter > 0 || f.AtimeBefore > 0 || f.AtimeAfter > 0
+	if !f.hasAttrMatch && len(f.Include) == 0 && len(f.Exclude) == 0 {
+		return nil, nil
+	}
+	return f, nil
+}
+
+// Prune reports whether nothing at or below dirPath can be emitted.
+func (f *Filter) Prune(dirPath string) bool {
+	if f == nil || dirPath == "/" {
+		return false
+	}
+	for _, p := range f.Exclude {
+		if p.re.MatchString(dirPath) {
+			return true
+		}
+	}
+	if len(f.Include) == 0 {
+		return false
+	}
+	for _, p := range f.Include {
+		if p.mayMatchUnder(dirPath) {
+			return false
+		}
+	}
+	return true
+}
+
+// Match reports whether the inode at path should be emitted.
+func (f *Filter) Match(inode *pb.INodeSection_INode, path string) bool {
+	if f == nil {
+		return true
+	}
+	for _, p := range f.Exclude {
+		if p.re.MatchString(path) {
+			return false
+		}
+	}
+	if len(f.Include) > 0 {
+		matched := false
+		for _, p := range f.Include {
+			if p.re.MatchString(path) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	if !f.hasAttrMatch {
+		return true
+	}
+
+	if f.Types != nil && !f.Types[inode.GetType()] {
+		return false
+	}
+
+	var perm, mtime, atime, size uint64
+	switch inode.GetType() {
+	case pb.INodeSection_INode_FILE:
+		file := inode.GetFile()
+		perm = file.GetPermission()
+		mtime = file.GetModificationTime()
+		atime = file.GetAccessTime()
+		size = getFileSize(file)
+	case pb.INodeSection_INode_DIRECTORY:
+		dir := inode.GetDirectory()
+		perm = dir.GetPermission()
+		mtime = dir.GetModificationTime()
+	case pb.INodeSection_INode_SYMLINK:
+		link := inode.GetSymlink()
+		perm = link.GetPermission()
+		mtime = link.GetModificationTime()
+		atime = link.GetAccessTime()
+	}
+
+	if size < f.MinSize || (f.hasMaxSize && size > f.MaxSize) {
+		return false
+	}
+	if f.MtimeBefore > 0 && mtime >= f.MtimeBefore {
+		return false
+	}
+	if f.MtimeAfter > 0 && mtime < f.MtimeAfter {
+		return false
+	}
+	if f.AtimeBefore > 0 && atime >= f.AtimeBefore {
+		return false
+	}
+	if f.AtimeAfter > 0 && atime < f.AtimeAfter {
+		return false
+	}
+	if f.Users != nil || f.Groups != nil {
+		ps := decodePermission(perm)
+		if f.Users != nil && !f.Users[ps.UserName] {
+			return false
+		}
+		if f.Groups != nil && !f.Groups[ps.GroupName] {
+			return false
+		}
+	}
+	return true
+}
+
+// mayMatchUnder reports whether dirPath or anything below it can match.
+func (p *pathPattern) mayMatchUnder(dirPath string) bool {
+	if p.prefix == "" {
+		return true
+	}
+	dir := dirPath + "/"
+	return strings.HasPrefix(p.prefix, dir) || strings.HasPrefix(dir, p.prefix) ||
+		p.prefix == dirPath
+}
+
+// compileGlob turns a path glob into an anchored regexp. '*' and '?'
+// stay within one path component, '**' crosses components and a
+// trailing '/**' also matches the directory itself. Globs without a
+// leading '/' match at any depth.
+func compileGlob(glob string) (*pathPattern, error) {
+	var sb strings.Builder
+	sb.WriteString("^")
+	if !strings.HasPrefix(glob, "/") {
+		// relative globs match at any depth, e.g. "*.tmp"
+		sb.WriteString("(?:.*/)?")
+	}
+	prefixEnd := -1
+	for i := 0; i < len(glob); i++ {
+		c := glob[i]
+		switch c {
+		case '*':
+			if prefixEnd < 0 {
+				prefixEnd = i
+			}
+			if i+1 < len(glob) && glob[i+1] == '*' {
+				i++
+				if i+1 < len(glob) && glob[i+1] == '/' {
+					i++
+					sb.WriteString("(?:.*/)?")
+				} else {
+					sb.WriteString(".*")
+				}
+			} else {
+				sb.WriteString("[^/]*")
+			}
+		case '?':
+			if prefixEnd < 0 {
+				prefixEnd = i
+			}
+			sb.WriteString("[^/]")
+		case '[':
+			if prefixEnd < 0 {
+				prefixEnd = i
+			}
+			j := strings.IndexByte(glob[i:], ']')
+			if j < 0 {
+				return nil, fmt.Errorf("glob %q: unterminated character class", glob)
+			}
+			class := glob[i+1 : i+j]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			sb.WriteString("[" + class + "]")
+			i += j
+		case '/':
+			if strings.HasPrefix(glob[i:], "/**") && i+3 == len(glob) {
+				if prefixEnd < 0 {
+					prefixEnd = i
+				}
+				sb.WriteString("(?:/.*)?")
+				i += 2
+			} else {
+				sb.WriteByte('/')
+			}
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	sb.WriteString("$")
+
+	re, err := regexp.Compile(sb.String())
+	if err != nil {
+		return nil, fmt.Errorf("glob %q: %w", glob, err)
+	}
+	prefix := glob
+	if prefixEnd >= 0 {
+		prefix = glob[:prefixEnd]
+	}
+	if !strings.HasPrefix(prefix, "/") {
+		prefix = ""
+	}
+	return &pathPattern{raw: glob, re: re, prefix: prefix}, nil
+}
+
+func compileRegex(expr string) (*pathPattern, error) {
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, fmt.Errorf("regex %q: %w", expr, err)
+	}
+	prefix := ""
+	if strings.HasPrefix(expr, "^") {
+		if lit, _ := re.LiteralPrefix(); strings.HasPrefix(lit, "/") {
+			prefix = lit
+		}
+	}
+	return &pathPattern{raw: expr, re: re, prefix: prefix}, nil
+}
+
+func parseInodeType(s string) (pb.INodeSection_INode_Type, error) {
+	switch strings.ToLower(s) {
+	case "f", "file":
+		return pb.INodeSection_INode_FILE, nil
+	case "d", "dir", "directory":
+		return pb.INodeSection_INode_DIRECTORY, nil
+	case "l", "link", "symlink":
+		return pb.INodeSection_INode_SYMLINK, nil
+	}
+	return 0, fmt.Errorf("unknown inode type %q (want file, dir or symlink)", s)
+}
+
+// parseSize accepts plain byte counts and binary K/M/G/T/P suffixes.
+func parseSize(s string) (uint64, error) {
+	s = strings.TrimSuffix(strings.ToUpper(strings.TrimSpace(s)), "B")
+	mult := uint64(1)
+	if n := len(s); n > 0 {
+		switch s[n-1] {
+		case 'K':
+			mult = 1 << 10
+		case 'M':
+			mult = 1 << 20
+		case 'G':
+			mult = 1 << 30
+		case 'T':
+			mult = 1 << 40
+		case 'P':
+			mult = 1 << 50
+		}
+		if mult > 1 {
+			s = s[:n-1]
+		}
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil || v < 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return uint64(v * float64(mult)), nil
+}
+
+// parseTimeBound converts an absolute date ("2024-01-31",
+// "2024-01-31 12:00:00") or an age ("90d", "12h") into epoch millis.
+// An empty string yields 0, meaning "no bound".
+func parseTimeBound(s string, now time.Time) (uint64, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, nil
+	}
+	for _, layout := range []string{"2006-01-02 15:04:05", "2006-01-02T15:04:05", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, s, time.UTC); err == nil {
+			return uint64(t.UnixMilli()), nil
+		}
+	}
+	if strings.HasSuffix(s, "d") {
+		days, err := strconv.ParseFloat(strings.TrimSuffix(s, "d"), 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid age %q", s)
+		}
+		return uint64(now.Add(-time.Duration(days * float64(24*time.Hour))).UnixMilli()), nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q (want YYYY-MM-DD or an age like 90d)", s)
+	}
+	return uint64(now.Add(-d).UnixMilli()), nil
+}
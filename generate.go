@@ -0,0 +1,694 @@
+package main
+
+import (
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"maps"
+	"math"
+	"math/rand/v2"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	hd "hdfs-fsimage-parse-go/pkg/hadoop_hdfs"
+	pb "hdfs-fsimage-parse-go/pkg/hadoop_hdfs_fsimage"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// Counters the namenode starts from, see HdfsServerConstants and
+// SequentialBlockGroupIdGenerator.
+const (
+	lastReservedBlockId  = 1 << 30
+	lastReservedGenstamp = 1000
+	blocksInStripedGroup = 16
+	// currentStateId is Snapshot.CURRENT_STATE_ID, the snapshot id of a
+	// rename target outside any snapshottable directory.
+	currentStateId = math.MaxInt32 - 1
+	// serialMaskBits is SerialNumberManager.getMaskBits(): the top three
+	// bits of a STRING_TABLE id select users, groups or xattr names.
+	serialMaskBits = 3
+)
+
+type ecPolicy struct {
+	id             uint32
+	name, codec    string
+	data, parity   uint32
+	cellSize       uint32
+	enabledDefault bool
+}
+
+// systemECPolicies are SystemErasureCodingPolicies; RS-6-3-1024k is the
+// only one enabled by default and the one generated EC files use.
+var systemECPolicies = []ecPolicy{
+	{1, "RS-6-3-1024k", "rs", 6, 3, 1 << 20, true},
+	{2, "RS-3-2-1024k", "rs", 3, 2, 1 << 20, false},
+	{3, "RS-LEGACY-6-3-1024k", "rs-legacy", 6, 3, 1 << 20, false},
+	{4, "XOR-2-1-1024k", "xor", 2, 1, 1 << 20, false},
+	{5, "RS-10-4-1024k", "rs", 10, 4, 1 << 20, false},
+}
+
+var (
+	generatedExtensions = []string{"csv", "parquet", "orc", "json", "log", "txt", "avro"}
+	generatedXAttrNames = []string{"checksum", "origin", "retention", "owner-team"}
+)
+
+// GenerateOptions shape a synthetic namespace. Ratios are per inode.
+type GenerateOptions struct {
+	Seed              uint64
+	Depth             int
+	Fanout            int
+	Files             int
+	FileSize          string
+	BlockSize         string
+	Users             int
+	Groups            int
+	AclRatio          float64
+	XAttrRatio        float64
+	SymlinkRatio      float64
+	ECRatio           float64
+	Snapshottable     int
+	Snapshots         int
+	UnderConstruction int
+	Tokens            int
+	CacheDirectives   int
+	TxId              uint64
+	Time              string
+}
+
+// runGenerate implements the `generate` subcommand.
+func runGenerate(args []string) {
+	fs := flag.NewFlagSet("generate", flag.ExitOnError)
+	var opts GenerateOptions
+	fs.Uint64Var(&opts.Seed, "seed", 1, "random seed; the same seed and flags give the same image")
+	fs.IntVar(&opts.Depth, "depth", 3, "directory levels below the root")
+	fs.IntVar(&opts.Fanout, "fanout", 4, "subdirectories per directory")
+	fs.IntVar(&opts.Files, "files", 8, "files per directory below the root")
+	fs.StringVar(&opts.FileSize, "file-size", "lognormal:8M:2.5",
+		"file size distribution: fixed:SIZE, uniform:MIN:MAX or lognormal:MEDIAN:SIGMA")
+	fs.StringVar(&opts.BlockSize, "block-size", "128M", "preferred block size")
+	fs.IntVar(&opts.Users, "users", 10, "owners besides hdfs")
+	fs.IntVar(&opts.Groups, "groups", 4, "groups besides supergroup")
+	fs.Float64Var(&opts.AclRatio, "acl-ratio", 0.05, "fraction of files and directories with an ACL")
+	fs.Float64Var(&opts.XAttrRatio, "xattr-ratio", 0.05, "fraction of files and directories with user xattrs")
+	fs.Float64Var(&opts.SymlinkRatio, "symlink-ratio", 0.02, "fraction of files generated as symlinks instead")
+	fs.Float64Var(&opts.ECRatio, "ec-ratio", 0.05, "fraction of files striped with RS-6-3-1024k")
+	fs.IntVar(&opts.Snapshottable, "snapshottable", 1, "top-level directories made snapshottable")
+	fs.IntVar(&opts.Snapshots, "snapshots", 2, "snapshots per snapshottable directory, with diffs and a rename")
+	fs.IntVar(&opts.UnderConstruction, "under-construction", 1, "files left open for write")
+	fs.IntVar(&opts.Tokens, "tokens", 4, "delegation tokens in SECRET_MANAGER")
+	fs.IntVar(&opts.CacheDirectives, "cache-directives", 2, "cache directives in CACHE_MANAGER")
+	fs.Uint64Var(&opts.TxId, "txid", 1000, "transaction id of the image")
+	fs.StringVar(&opts.Time, "time", "2024-01-01", "time the image is saved at; times in the image lie before it")
+	registerLogFlags(fs)
+	fs.Usage = commandUsage(fs, "[flags] <output>",
+		"Writes a synthetic fsimage covering every section type, and its .md5 sidecar.")
+	parseArgs(fs, args, 1)
+
+	g, err := newGenerator(opts)
+	logIfErr(err)
+	img := g.generate()
+	logIfErr(writeImageFile(fs.Arg(0), img))
+	infof("wrote %s: %d dirs, %d files, %d symlinks, %d blocks, %d snapshots",
+		fs.Arg(0), g.dirs, g.files, g.symlinks, g.blocks, g.snapshotCounter)
+}
+
+// generator builds the namespace into inodeData and stringMap.
+type generator struct {
+	opts      GenerateOptions
+	rng       *rand.Rand
+	fileSize  func() uint64
+	blockSize uint64
+	now       uint64
+
+	nextInode       uint64
+	lastBlockId     uint64
+	lastStripedId   int64
+	genstamp        uint64
+	children        map[uint64][]uint64
+	refChildren     map[uint64][]uint32
+	refs            []proto.Message
+	lastFile        string // symlink target
+	openFiles       reservoir
+	cachePaths      reservoir
+	topDirs         []uint64
+	snapshotCounter uint32
+
+	dirs, files, symlinks, blocks int
+}
+
+func newGenerator(opts GenerateOptions) (*generator, error) {
+	switch {
+	case opts.Depth < 0 || opts.Fanout < 0 || opts.Files < 0 || opts.Users < 0 || opts.Groups < 0:
+		return nil, fmt.Errorf("-depth, -fanout, -files, -users and -groups must not be negative")
+	case opts.Snapshottable < 0 || opts.Snapshots < 0 || opts.UnderConstruction < 0 || opts.Tokens < 0 || opts.CacheDirectives < 0:
+		return nil, fmt.Errorf("-snapshottable, -snapshots, -under-construction, -tokens and -cache-directives must not be negative")
+	}
+	for _, r := range []float64{opts.AclRatio, opts.XAttrRatio, opts.SymlinkRatio, opts.ECRatio} {
+		if r < 0 || r > 1 {
+			return nil, fmt.Errorf("ratios must be between 0 and 1")
+		}
+	}
+	g := &generator{
+		opts:          opts,
+		rng:           rand.New(rand.NewPCG(opts.Seed, opts.Seed^0x9e3779b97f4a7c15)),
+		nextInode:     ROOT_INODE_ID,
+		lastBlockId:   lastReservedBlockId,
+		lastStripedId: math.MinInt64,
+		genstamp:      lastReservedGenstamp,
+		children:      make(map[uint64][]uint64),
+		refChildren:   make(map[uint64][]uint32),
+		openFiles:     reservoir{n: opts.UnderConstruction},
+		cachePaths:    reservoir{n: opts.CacheDirectives},
+	}
+	var err error
+	if g.fileSize, err = parseSizeDistribution(opts.FileSize, g.rng); err != nil {
+		return nil, err
+	}
+	if g.blockSize, err = parseSize(opts.BlockSize); err != nil {
+		return nil, err
+	}
+	if g.blockSize == 0 {
+		return nil, fmt.Errorf("-block-size must be positive")
+	}
+	if g.now, err = parseTimeBound(opts.Time, time.Now()); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+// parseSizeDistribution parses fixed:SIZE, uniform:MIN:MAX or
+// lognormal:MEDIAN:SIGMA into a sampler.
+func parseSizeDistribution(spec string, rng *rand.Rand) (func() uint64, error) {
+	parts := strings.Split(spec, ":")
+	bad := fmt.Errorf("invalid size distribution %q (want fixed:SIZE, uniform:MIN:MAX or lognormal:MEDIAN:SIGMA)", spec)
+	switch {
+	case parts[0] == "fixed" && len(parts) == 2:
+		size, err := parseSize(parts[1])
+		if err != nil {
+			return nil, err
+		}
+		return func() uint64 { return size }, nil
+	case parts[0] == "uniform" && len(parts) == 3:
+		lo, err := parseSize(parts[1])
+		if err != nil {
+			return nil, err
+		}
+		hi, err := parseSize(parts[2])
+		if err != nil {
+			return nil, err
+		}
+		if hi < lo {
+			return nil, bad
+		}
+		return func() uint64 { return lo + rng.Uint64N(hi-lo+1) }, nil
+	case parts[0] == "lognormal" && len(parts) == 3:
+		median, err := parseSize(parts[1])
+		if err != nil {
+			return nil, err
+		}
+		sigma, err := strconv.ParseFloat(parts[2], 64)
+		if err != nil || sigma < 0 {
+			return nil, bad
+		}
+		mu := math.Log(float64(max(median, 1)))
+		return func() uint64 {
+			// capped at 1 PiB
+			return uint64(min(math.Exp(mu+sigma*rng.NormFloat64()), 1<<50))
+		}, nil
+	}
+	return nil, bad
+}
+
+// reservoir keeps a uniform sample of n of the inodes offered to it.
+type reservoir struct {
+	n     int
+	seen  int
+	ids   []uint64
+	paths []string
+}
+
+func (r *reservoir) offer(rng *rand.Rand, id uint64, path string) {
+	r.seen++
+	if len(r.ids) < r.n {
+		r.ids = append(r.ids, id)
+		r.paths = append(r.paths, path)
+	} else if i := rng.IntN(r.seen); i < r.n {
+		r.ids[i], r.paths[i] = id, path
+	}
+}
+
+// user and group serial numbers: 1 is hdfs and supergroup, then
+// user01... and group01...
+func (g *generator) randomUser() uint64  { return 2 + g.rng.Uint64N(uint64(max(g.opts.Users, 1))) }
+func (g *generator) randomGroup() uint64 { return 2 + g.rng.Uint64N(uint64(max(g.opts.Groups, 1))) }
+
+func (g *generator) fillStringTable() {
+	stringMap[1|0x20000000] = "hdfs"
+	stringMap[1|0x40000000] = "supergroup"
+	for i := 1; i <= max(g.opts.Users, 1); i++ {
+		stringMap[uint32(i+1)|0x20000000] = fmt.Sprintf("user%02d", i)
+	}
+	for i := 1; i <= max(g.opts.Groups, 1); i++ {
+		stringMap[uint32(i+1)|0x40000000] = fmt.Sprintf("group%02d", i)
+	}
+	for i, name := range generatedXAttrNames {
+		stringMap[uint32(i+1)|0x60000000] = name
+	}
+}
+
+// pastTime is a time within the year before the image was saved.
+func (g *generator) pastTime() uint64 {
+	const year = 365 * 24 * 3600 * 1000
+	return g.now - g.rng.Uint64N(min(g.now, year))
+}
+
+func (g *generator) allocInode() uint64 {
+	id := g.nextInode
+	g.nextInode++
+	return id
+}
+
+// generate builds the whole image. The tree is generated depth first,
+// so inode ids follow path order.
+func (g *generator) generate() *Image {
+	g.fillStringTable()
+
+	root := g.newDir(0, "", 0)
+	root.GetDirectory().NsQuota = proto.Uint64(math.MaxInt64)
+	root.GetDirectory().Permission = proto.Uint64(1<<40 | 1<<16 | 0o755)
+	g.fillDir(root.GetId(), "", 0)
+
+	img := newImage()
+	img.Records = append(img.Records, RecordSection{"ERASURE_CODING", []proto.Message{g.erasureCodingSection()}})
+	img.Records = append(img.Records, g.snapshotSections()...)
+	img.Records = append(img.Records,
+		g.underConstructionSection(),
+		RecordSection{"INODE_REFERENCE", g.refs},
+		g.secretManagerSection(),
+		g.cacheManagerSection())
+
+	parents := slices.Collect(maps.Keys(g.children))
+	for parent := range g.refChildren {
+		if _, ok := g.children[parent]; !ok {
+			parents = append(parents, parent)
+		}
+	}
+	slices.Sort(parents)
+	// children sorted by name, as INodeDirectory keeps them
+	for _, parent := range parents {
+		children := g.children[parent]
+		sort.Slice(children, func(i, j int) bool {
+			return string(inodeData[children[i]].GetName()) < string(inodeData[children[j]].GetName())
+		})
+		img.Namespace.addDirEntry(parent, children, g.refChildren[parent])
+	}
+	img.Namespace.finish()
+
+	img.LastInodeId = g.nextInode - 1
+	img.StringMaskBits = serialMaskBits
+	img.NsInfo = &pb.NameSystemSection{
+		NamespaceId:                 proto.Uint32(g.rng.Uint32()),
+		GenstampV1:                  proto.Uint64(lastReservedGenstamp),
+		GenstampV2:                  proto.Uint64(g.genstamp),
+		GenstampV1Limit:             proto.Uint64(0),
+		LastAllocatedBlockId:        proto.Uint64(g.lastBlockId),
+		LastAllocatedStripedBlockId: proto.Uint64(uint64(g.lastStripedId)),
+		TransactionId:               proto.Uint64(g.opts.TxId),
+	}
+	return img
+}
+
+func (g *generator) newDir(parent uint64, name string, level int) *pb.INodeSection_INode {
+	id := g.allocInode()
+	dir := &pb.INodeSection_INodeDirectory{
+		ModificationTime: proto.Uint64(g.pastTime()),
+		NsQuota:          proto.Uint64(math.MaxUint64),
+		DsQuota:          proto.Uint64(math.MaxUint64),
+		Permission:       proto.Uint64(g.randomUser()<<40 | g.randomGroup()<<16 | 0o755),
+	}
+	inode := &pb.INodeSection_INode{Type: pb.INodeSection_INode_DIRECTORY.Enum(), Id: proto.Uint64(id), Name: []byte(name), Directory: dir}
+	if level > 0 {
+		dir.Acl, dir.XAttrs = g.features(true, dir.Permission)
+		g.children[parent] = append(g.children[parent], id)
+	}
+	inodeData[id] = inode
+	g.dirs++
+	return inode
+}
+
+// fillDir generates the files and subdirectories of a directory.
+func (g *generator) fillDir(id uint64, path string, level int) {
+	if level > 0 {
+		for i := 0; i < g.opts.Files; i++ {
+			name := fmt.Sprintf("file%d.%s", i, generatedExtensions[g.rng.IntN(len(generatedExtensions))])
+			if g.rng.Float64() < g.opts.SymlinkRatio && g.lastFile != "" {
+				g.newSymlink(id, "link"+strconv.Itoa(i))
+				continue
+			}
+			g.newFile(id, path+"/"+name, name)
+		}
+	}
+	if level >= g.opts.Depth {
+		return
+	}
+	for i := 0; i < g.opts.Fanout; i++ {
+		name := fmt.Sprintf("dir%d", i)
+		dir := g.newDir(id, name, level+1)
+		if level == 0 {
+			g.topDirs = append(g.topDirs, dir.GetId())
+		}
+		g.cachePaths.offer(g.rng, dir.GetId(), path+"/"+name)
+		g.fillDir(dir.GetId(), path+"/"+name, level+1)
+	}
+}
+
+func (g *generator) newFile(parent uint64, path, name string) *pb.INodeSection_INode {
+	id := g.allocInode()
+	mtime := g.pastTime()
+	file := &pb.INodeSection_INodeFile{
+		ModificationTime:   proto.Uint64(mtime),
+		AccessTime:         proto.Uint64(mtime + g.rng.Uint64N(g.now-mtime+1)),
+		PreferredBlockSize: proto.Uint64(g.blockSize),
+		Permission:         proto.Uint64(g.randomUser()<<40 | g.randomGroup()<<16 | 0o644),
+	}
+	striped := g.rng.Float64() < g.opts.ECRatio
+	if striped {
+		file.BlockType = hd.BlockTypeProto_STRIPED.Enum()
+		file.ErasureCodingPolicyID = proto.Uint32(systemECPolicies[0].id)
+	} else {
+		file.Replication = proto.Uint32(3)
+	}
+	file.Blocks = g.allocBlocks(g.fileSize(), striped)
+	file.Acl, file.XAttrs = g.features(false, file.Permission)
+
+	inode := &pb.INodeSection_INode{Type: pb.INodeSection_INode_FILE.Enum(), Id: proto.Uint64(id), Name: []byte(name), File: file}
+	inodeData[id] = inode
+	if parent != 0 {
+		g.children[parent] = append(g.children[parent], id)
+		g.lastFile = path
+		if !striped {
+			g.openFiles.offer(g.rng, id, path)
+		}
+		g.cachePaths.offer(g.rng, id, path)
+	}
+	g.files++
+	return inode
+}
+
+// allocBlocks splits size into blocks, block groups of six data blocks
+// for striped files.
+func (g *generator) allocBlocks(size uint64, striped bool) []*hd.BlockProto {
+	capacity := g.blockSize
+	if striped {
+		capacity *= uint64(systemECPolicies[0].data)
+	}
+	var blocks []*hd.BlockProto
+	for size > 0 {
+		n := min(size, capacity)
+		size -= n
+		g.genstamp++
+		var id uint64
+		if striped {
+			g.lastStripedId += blocksInStripedGroup
+			id = uint64(g.lastStripedId)
+		} else {
+			g.lastBlockId++
+			id = g.lastBlockId
+		}
+		blocks = append(blocks, &hd.BlockProto{BlockId: proto.Uint64(id), GenStamp: proto.Uint64(g.genstamp), NumBytes: proto.Uint64(n)})
+		g.blocks++
+	}
+	return blocks
+}
+
+func (g *generator) newSymlink(parent uint64, name string) {
+	id := g.allocInode()
+	mtime := g.pastTime()
+	inodeData[id] = &pb.INodeSection_INode{
+		Type: pb.INodeSection_INode_SYMLINK.Enum(),
+		Id:   proto.Uint64(id),
+		Name: []byte(name),
+		Symlink: &pb.INodeSection_INodeSymlink{
+			Permission:       proto.Uint64(g.randomUser()<<40 | g.randomGroup()<<16 | 0o777),
+			Target:           []byte(g.lastFile),
+			ModificationTime: proto.Uint64(mtime),
+			AccessTime:       proto.Uint64(mtime),
+		},
+	}
+	g.children[parent] = append(g.children[parent], id)
+	g.symlinks++
+}
+
+// features draws an ACL and user xattrs for a file or directory. With
+// an ACL the group bits of the permission hold the mask, as in HDFS.
+func (g *generator) features(isDir bool, permission *uint64) (*pb.INodeSection_AclFeatureProto, *pb.INodeSection_XAttrFeatureProto) {
+	var acl *pb.INodeSection_AclFeatureProto
+	if g.rng.Float64() < g.opts.AclRatio {
+		const (
+			access, dflt             = 0, 1
+			user, group, mask, other = 0, 1, 2, 3
+		)
+		entry := func(scope, typ, name, perm uint32) uint32 {
+			return name<<6 | scope<<5 | typ<<3 | perm
+		}
+		named := uint32(g.randomUser())
+		acl = &pb.INodeSection_AclFeatureProto{Entries: []uint32{
+			entry(access, user, named, 7),
+			entry(access, group, 0, 5),
+		}}
+		if isDir {
+			acl.Entries = append(acl.Entries,
+				entry(dflt, user, 0, 7), entry(dflt, user, named, 7), entry(dflt, group, 0, 5),
+				entry(dflt, mask, 0, 7), entry(dflt, other, 0, 5))
+		}
+		*permission = *permission&^0o070 | 0o070
+	}
+
+	var xattrs *pb.INodeSection_XAttrFeatureProto
+	if g.rng.Float64() < g.opts.XAttrRatio {
+		xattrs = &pb.INodeSection_XAttrFeatureProto{}
+		for _, i := range g.rng.Perm(len(generatedXAttrNames))[:1+g.rng.IntN(2)] {
+			value := make([]byte, 8)
+			for j := range value {
+				value[j] = byte(g.rng.Uint32())
+			}
+			// user namespace, name id in bits 6-29
+			xattrs.XAttrs = append(xattrs.XAttrs, &pb.INodeSection_XAttrCompactProto{
+				Name:  proto.Uint32(uint32(i+1) << 6),
+				Value: []byte(hex.EncodeToString(value)),
+			})
+		}
+	}
+	return acl, xattrs
+}
+
+func (g *generator) erasureCodingSection() *pb.ErasureCodingSection {
+	section := &pb.ErasureCodingSection{}
+	for _, p := range systemECPolicies {
+		state := hd.ErasureCodingPolicyState_DISABLED
+		if p.enabledDefault {
+			state = hd.ErasureCodingPolicyState_ENABLED
+		}
+		section.Policies = append(section.Policies, &hd.ErasureCodingPolicyProto{
+			Name:     proto.String(p.name),
+			Schema:   &hd.ECSchemaProto{CodecName: proto.String(p.codec), DataUnits: proto.Uint32(p.data), ParityUnits: proto.Uint32(p.parity)},
+			CellSize: proto.Uint32(p.cellSize),
+			Id:       proto.Uint32(p.id),
+			State:    state.Enum(),
+		})
+	}
+	return section
+}
+
+// snapshotSections takes -snapshots snapshots of the first
+// -snapshottable top-level directories. Changes after each snapshot
+// are recorded in SNAPSHOT_DIFF: a file deleted after every snapshot,
+// and after the last one a file created, a file appended to and a file
+// renamed to the root through INODE_REFERENCE.
+func (g *generator) snapshotSections() []RecordSection {
+	snapshottable := g.topDirs[:min(g.opts.Snapshottable, len(g.topDirs))]
+	if g.opts.Snapshots == 0 {
+		snapshottable = nil
+	}
+	header := &pb.SnapshotSection{SnapshottableDir: snapshottable}
+	snapshots := []proto.Message{header}
+	var diffs []proto.Message
+
+	for _, dirId := range snapshottable {
+		dir := inodeData[dirId]
+		var files []uint64
+		for _, child := range g.children[dirId] {
+			f := inodeData[child].GetFile()
+			if f != nil && f.GetBlockType() != hd.BlockTypeProto_STRIPED && !slices.Contains(g.openFiles.ids, child) {
+				files = append(files, child)
+			}
+		}
+
+		ids := make([]uint32, g.opts.Snapshots)
+		for i := range ids {
+			ids[i] = g.snapshotCounter
+			g.snapshotCounter++
+			taken := g.now - uint64(g.opts.Snapshots-i)*24*3600*1000
+			root := proto.Clone(dir).(*pb.INodeSection_INode)
+			root.Name = []byte("s" + time.UnixMilli(int64(taken)).UTC().Format("20060102-150405.000"))
+			root.GetDirectory().ModificationTime = proto.Uint64(taken)
+			snapshots = append(snapshots, &pb.SnapshotSection_Snapshot{SnapshotId: proto.Uint32(ids[i]), Root: root})
+		}
+
+		latest := len(ids) - 1
+		dirDiffs := make([]*pb.SnapshotDiffSection_DirectoryDiff, len(ids))
+		for i := range dirDiffs {
+			deleted := g.newFile(0, "", fmt.Sprintf("deleted-%d.dat", i))
+			dirDiffs[i] = &pb.SnapshotDiffSection_DirectoryDiff{
+				SnapshotId:     proto.Uint32(ids[i]),
+				IsSnapshotRoot: proto.Bool(true),
+				DeletedINode:   []uint64{deleted.GetId()},
+			}
+		}
+		var created [][]byte
+		if len(files) > 0 {
+			created = append(created, inodeData[files[0]].GetName())
+		}
+		var fileDiff []proto.Message
+		if len(files) > 1 {
+			f := inodeData[files[1]]
+			fileDiff = []proto.Message{
+				&pb.SnapshotDiffSection_DiffEntry{Type: pb.SnapshotDiffSection_DiffEntry_FILEDIFF.Enum(), InodeId: proto.Uint64(f.GetId()), NumOfDiff: proto.Uint32(1)},
+				&pb.SnapshotDiffSection_FileDiff{SnapshotId: proto.Uint32(ids[latest]), FileSize: proto.Uint64(getFileSize(f.GetFile()) / 2), Name: f.GetName()},
+			}
+		}
+		renamed := 0
+		if len(files) > 2 {
+			f := inodeData[files[2]]
+			g.children[dirId] = removeId(g.children[dirId], f.GetId())
+			g.refs = append(g.refs,
+				&pb.INodeReferenceSection_INodeReference{ReferredId: proto.Uint64(f.GetId()), DstSnapshotId: proto.Uint32(currentStateId)},
+				&pb.INodeReferenceSection_INodeReference{ReferredId: proto.Uint64(f.GetId()), Name: f.GetName(), LastSnapshotId: proto.Uint32(ids[latest])})
+			g.refChildren[ROOT_INODE_ID] = append(g.refChildren[ROOT_INODE_ID], uint32(len(g.refs)-2))
+			dirDiffs[latest].DeletedINodeRef = []uint32{uint32(len(g.refs) - 1)}
+			f.Name = []byte(fmt.Sprintf("%s-renamed", f.GetName()))
+			renamed = 1
+		}
+		dirDiffs[latest].CreatedListSize = proto.Uint32(uint32(len(created)))
+
+		// children at each snapshot: the current ones without the
+		// created file, plus the later deletions and the renamed file
+		current := len(g.children[dirId])
+		for i, d := range dirDiffs {
+			d.ChildrenSize = proto.Uint32(uint32(current - len(created) + len(dirDiffs) - i + renamed))
+		}
+
+		// newest diff first, as the namenode saves them
+		diffs = append(diffs, &pb.SnapshotDiffSection_DiffEntry{
+			Type: pb.SnapshotDiffSection_DiffEntry_DIRECTORYDIFF.Enum(), InodeId: proto.Uint64(dirId), NumOfDiff: proto.Uint32(uint32(len(dirDiffs))),
+		})
+		for i := latest; i >= 0; i-- {
+			diffs = append(diffs, dirDiffs[i])
+			if i == latest {
+				for _, name := range created {
+					diffs = append(diffs, &pb.SnapshotDiffSection_CreatedListEntry{Name: name})
+				}
+			}
+		}
+		diffs = append(diffs, fileDiff...)
+	}
+	header.SnapshotCounter = proto.Uint32(g.snapshotCounter)
+	header.NumSnapshots = proto.Uint32(g.snapshotCounter)
+	return []RecordSection{{"SNAPSHOT", snapshots}, {"SNAPSHOT_DIFF", diffs}}
+}
+
+func removeId(ids []uint64, id uint64) []uint64 {
+	for i, v := range ids {
+		if v == id {
+			return append(ids[:i], ids[i+1:]...)
+		}
+	}
+	return ids
+}
+
+func (g *generator) underConstructionSection() RecordSection {
+	var records []proto.Message
+	for i, id := range g.openFiles.ids {
+		file := inodeData[id].GetFile()
+		file.FileUC = &pb.INodeSection_FileUnderConstructionFeature{
+			ClientName:    proto.String(fmt.Sprintf("DFSClient_NONMAPREDUCE_%d_1", g.rng.Int32())),
+			ClientMachine: proto.String(fmt.Sprintf("10.0.%d.%d", g.rng.IntN(256), 1+g.rng.IntN(254))),
+		}
+		records = append(records, &pb.FilesUnderConstructionSection_FileUnderConstructionEntry{
+			InodeId:  proto.Uint64(id),
+			FullPath: proto.String(g.openFiles.paths[i]),
+		})
+	}
+	return RecordSection{"FILES_UNDERCONSTRUCTION", records}
+}
+
+func (g *generator) secretManagerSection() RecordSection {
+	const day = 24 * 3600 * 1000
+	header := &pb.SecretManagerSection{
+		CurrentId:           proto.Uint32(2),
+		TokenSequenceNumber: proto.Uint32(uint32(g.opts.Tokens)),
+		NumKeys:             proto.Uint32(2),
+		NumTokens:           proto.Uint32(uint32(g.opts.Tokens)),
+	}
+	records := []proto.Message{header}
+	for id := uint32(1); id <= 2; id++ {
+		key := make([]byte, 20)
+		for i := range key {
+			key[i] = byte(g.rng.Uint32())
+		}
+		records = append(records, &pb.SecretManagerSection_DelegationKey{
+			Id: proto.Uint32(id), ExpiryDate: proto.Uint64(g.now + uint64(id)*day), Key: key,
+		})
+	}
+	for seq := 1; seq <= g.opts.Tokens; seq++ {
+		issued := g.now - g.rng.Uint64N(day)
+		records = append(records, &pb.SecretManagerSection_PersistToken{
+			Version:        proto.Uint32(0),
+			Owner:          proto.String(lookupUser(uint32(g.randomUser())) + "@EXAMPLE.COM"),
+			Renewer:        proto.String("yarn"),
+			RealUser:       proto.String(""),
+			IssueDate:      proto.Uint64(issued),
+			MaxDate:        proto.Uint64(issued + 7*day),
+			SequenceNumber: proto.Uint32(uint32(seq)),
+			MasterKeyId:    proto.Uint32(2),
+			ExpiryDate:     proto.Uint64(issued + day),
+		})
+	}
+	return RecordSection{"SECRET_MANAGER", records}
+}
+
+func (g *generator) cacheManagerSection() RecordSection {
+	header := &pb.CacheManagerSection{
+		NextDirectiveId: proto.Uint64(uint64(len(g.cachePaths.paths)) + 1),
+		NumDirectives:   proto.Uint32(uint32(len(g.cachePaths.paths))),
+	}
+	records := []proto.Message{header}
+	if len(g.cachePaths.paths) > 0 {
+		header.NumPools = proto.Uint32(1)
+		records = append(records, &hd.CachePoolInfoProto{
+			PoolName:           proto.String("pool1"),
+			OwnerName:          proto.String("hdfs"),
+			GroupName:          proto.String("supergroup"),
+			Mode:               proto.Int32(0o755),
+			Limit:              proto.Int64(cacheLimitUnlimited),
+			MaxRelativeExpiry:  proto.Int64(cacheExpiryNever),
+			DefaultReplication: proto.Uint32(1),
+		})
+	} else {
+		header.NumPools = proto.Uint32(0)
+	}
+	for i, path := range g.cachePaths.paths {
+		records = append(records, &hd.CacheDirectiveInfoProto{
+			Id:          proto.Int64(int64(i + 1)),
+			Path:        proto.String(path),
+			Replication: proto.Uint32(1),
+			Pool:        proto.String("pool1"),
+			Expiration:  &hd.CacheDirectiveInfoExpirationProto{Millis: proto.Int64(int64(g.now) + cacheExpiryNever), IsRelative: proto.Bool(false)},
+		})
+	}
+	return RecordSection{"CACHE_MANAGER", records}
+}
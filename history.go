@@ -0,0 +1,204 @@
+package main
+
+import (
+	"database/sql"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// historySchema keeps one row per recorded image in checkpoints and its
+// aggregates in usage, quotas and type_quotas, keyed by transaction id.
+// Times are epoch millis, quotas -1 when unset. CREATE ... IF NOT EXISTS lets
+// every run open the same file.
+const historySchema = `
+CREATE TABLE IF NOT EXISTS checkpoints (
+	txid            INTEGER PRIMARY KEY,
+	image           TEXT NOT NULL,
+	checkpoint_time INTEGER NOT NULL,
+	recorded_time   INTEGER NOT NULL,
+	namespace_id    INTEGER,
+	files           INTEGER,
+	dirs            INTEGER,
+	symlinks        INTEGER,
+	blocks          INTEGER,
+	bytes           INTEGER,
+	raw_bytes       INTEGER,
+	small_files     INTEGER
+);
+CREATE TABLE IF NOT EXISTS usage (
+	txid        INTEGER NOT NULL,
+	kind        TEXT NOT NULL,
+	key         TEXT NOT NULL,
+	files       INTEGER,
+	dirs        INTEGER,
+	bytes       INTEGER,
+	raw_bytes   INTEGER,
+	small_files INTEGER,
+	PRIMARY KEY (txid, kind, key)
+);
+CREATE TABLE IF NOT EXISTS quotas (
+	txid       INTEGER NOT NULL,
+	path       TEXT NOT NULL,
+	ns_quota   INTEGER,
+	ns_used    INTEGER,
+	ds_quota   INTEGER,
+	space_used INTEGER,
+	PRIMARY KEY (txid, path)
+);
+CREATE TABLE IF NOT EXISTS type_quotas (
+	txid         INTEGER NOT NULL,
+	path         TEXT NOT NULL,
+	storage_type TEXT NOT NULL,
+	quota        INTEGER,
+	used         INTEGER,
+	PRIMARY KEY (txid, path, storage_type)
+);
+CREATE INDEX IF NOT EXISTS usage_kind_key ON usage(kind, key);
+CREATE INDEX IF NOT EXISTS quotas_path ON quotas(path);
+CREATE INDEX IF NOT EXISTS type_quotas_path ON type_quotas(path, storage_type);
+`
+
+// Kinds of usage rows.
+const (
+	usageDir           = "dir"
+	usageUser          = "user"
+	usageStoragePolicy = "storage_policy"
+	usageECPolicy      = "ec_policy"
+)
+
+var usageKinds = []string{usageDir, usageUser, usageStoragePolicy, usageECPolicy}
+
+func openHistory(fileName string) (*sql.DB, error) {
+	db, err := sql.Open("sqlite", fileName)
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec(`PRAGMA journal_mode = WAL; PRAGMA busy_timeout = 10000;` + historySchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("%s: %w", fileName, err)
+	}
+	return db, nil
+}
+
+// historyHas reports whether an image with txId is already recorded.
+func historyHas(db *sql.DB, txId uint64) (bool, error) {
+	var n int
+	err := db.QueryRow(`SELECT count(*) FROM checkpoints WHERE txid = ?`, int64(txId)).Scan(&n)
+	return n > 0, err
+}
+
+// recordUsage appends the aggregates of one image in a single
+// transaction, so a checkpoint is recorded completely or not at all.
+func recordUsage(db *sql.DB, u *imageUsage) error {
+	txId := int64(u.nsInfo.GetTransactionId())
+	batch, err := newSQLBatch(db,
+		`INSERT INTO checkpoints VALUES (?,?,?,?,?,?,?,?,?,?,?,?)`,
+		`INSERT INTO usage VALUES (?,?,?,?,?,?,?,?)`,
+		`INSERT INTO quotas VALUES (?,?,?,?,?,?)`,
+		`INSERT INTO type_quotas VALUES (?,?,?,?,?)`,
+	)
+	if err != nil {
+		return err
+	}
+	err = batch.Exec(0, txId, filepath.Base(u.fileName), u.fInfo.ModTime().UnixMilli(), time.Now().UnixMilli(),
+		int64(u.nsInfo.GetNamespaceId()), int64(u.total.files), int64(u.total.dirs), int64(u.symlinks),
+		int64(u.blocks), int64(u.total.bytes), int64(u.total.rawBytes), int64(u.total.smallFiles))
+	for i, m := range []map[string]*usageCounts{u.dirs, u.users, u.storagePolicies, u.ecPolicies} {
+		for key, c := range m {
+			if err == nil {
+				err = batch.Exec(1, txId, usageKinds[i], key, int64(c.files), int64(c.dirs),
+					int64(c.bytes), int64(c.rawBytes), int64(c.smallFiles))
+			}
+			if err == nil {
+				err = batch.Row()
+			}
+		}
+	}
+	for _, q := range u.quotas {
+		if err == nil {
+			err = batch.Exec(2, txId, q.path, q.nsQuota, int64(q.nsUsed), q.dsQuota, int64(q.spaceUsed))
+		}
+		if err == nil {
+			err = batch.Row()
+		}
+		for _, t := range q.typeQuotas {
+			if err == nil {
+				err = batch.Exec(3, txId, q.path, t.GetStorageType().String(), int64(t.GetQuota()), int64(q.typeUsed[t.GetStorageType()]))
+			}
+			if err == nil {
+				err = batch.Row()
+			}
+		}
+	}
+	if err != nil {
+		batch.Rollback()
+		return fmt.Errorf("recording transaction %d: %w", txId, err)
+	}
+	return batch.Commit()
+}
+
+// imageTxId reads the transaction id from NS_INFO without loading the
+// namespace.
+func imageTxId(fileName string) (uint64, error) {
+	f, sectionMap, err := openImage(fileName)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	nsInfo, err := parseNameSystemSection(sectionMap["NS_INFO"], f)
+	if err != nil {
+		return 0, err
+	}
+	return nsInfo.GetTransactionId(), nil
+}
+
+// runHistory implements the `history` subcommand: it appends the
+// aggregates of each image to a history database for `trend`.
+func runHistory(args []string) {
+	fs := flag.NewFlagSet("history", flag.ExitOnError)
+	depth := fs.Int("depth", 2, "path components of the directories usage is recorded for")
+	smallFileSize := fs.String("small-file-size", "1M", "files below this size count as small")
+	registerParseFlags(fs)
+	registerLogFlags(fs)
+	fs.Usage = commandUsage(fs, "[flags] <history.db> <fsimage>...",
+		"Images already recorded, by transaction id, are skipped.")
+	parseArgs(fs, args, 2)
+
+	db, err := openHistory(fs.Arg(0))
+	logIfErr(err)
+	defer db.Close()
+	incomplete := 0
+	for _, image := range fs.Args()[1:] {
+		txId, err := imageTxId(image)
+		logIfErr(err)
+		recorded, err := historyHas(db, txId)
+		logIfErr(err)
+		if recorded {
+			infof("%s: transaction %d already recorded", image, txId)
+			continue
+		}
+		resetNamespace()
+		u, err := loadImageUsage(image, *depth, *smallFileSize)
+		logIfErr(err)
+		logIfErr(recordUsage(db, u))
+		infof("%s: recorded transaction %d", image, txId)
+		if parseReport.Total() > 0 {
+			parseReport.Log()
+			incomplete++
+		}
+	}
+	if incomplete > 0 {
+		// what was read is recorded, the exit status says it is incomplete
+		log.Printf("warning: %d images recorded with corrupt records skipped", incomplete)
+		db.Close()
+		os.Exit(exitIncomplete)
+	}
+	parseReport.reset()
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+
+	hd "hdfs-fsimage-parse-go/pkg/hadoop_hdfs"
+)
+
+// TestHistoryTypeQuotas records an image with the storage type quota the
+// test edits set on /t, and checks trend projects it.
+func TestHistoryTypeQuotas(t *testing.T) {
+	fileName := writeTestImage(t, testGenerateOptions())
+	editsDir := t.TempDir()
+	writeTestEdits(t, editsDir, testEditOps())
+	editsOptions = EditsOptions{Paths: []string{editsDir}}
+	t.Cleanup(func() { editsOptions = EditsOptions{} })
+
+	u, err := loadImageUsage(fileName, 2, "1M")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := openHistory(filepath.Join(t.TempDir(), "history.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if err := recordUsage(db, u); err != nil {
+		t.Fatal(err)
+	}
+	r, err := buildTrendReport(db, "30d", usageKinds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ssd := hd.StorageTypeProto_SSD.String()
+	for _, q := range r.Quotas {
+		if q.Path == "/t" && q.Quota == ssd {
+			if q.Limit != 1<<20 || q.Samples != 1 {
+				t.Errorf("/t %s quota is %+v, want limit %d from 1 sample", ssd, q, 1<<20)
+			}
+			return
+		}
+	}
+	t.Errorf("no trend for the %s quota of /t in %+v", ssd, r.Quotas)
+}
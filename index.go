@@ -0,0 +1,255 @@
+package main
+
+import (
+	"bufio"
+	"encoding/gob"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	pb "hdfs-fsimage-parse-go/pkg/hadoop_hdfs_fsimage"
+)
+
+// PathIndex maps inode ids and block ids to full paths. All slices are
+// sorted so lookups are binary searches; it is gob encoded when saved.
+type PathIndex struct {
+	TransactionId uint64
+	InodeIds      []uint64 // sorted
+	Paths         []string // Paths[i] belongs to InodeIds[i]
+	ByPath        []uint32 // indexes into Paths, in path order
+	BlockIds      []int64  // sorted
+	BlockInodes   []uint64 // BlockInodes[i] owns BlockIds[i]
+}
+
+// stripedBlockIndexMask selects the internal block index inside a
+// striped block group id.
+const stripedBlockIndexMask = 0xF
+
+func runLookup(args []string) {
+	fs := flag.NewFlagSet("lookup", flag.ExitOnError)
+	indexPath := fs.String("index", "", "read a saved index instead of an fsimage")
+	savePath := fs.String("save", "", "save the index built from the fsimage to this file")
+	prefix := fs.Bool("prefix", false, "list every path under path keys instead of an exact match")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s lookup [-save file] <fsimage> [key...]\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "       %s lookup -index file [key...]\n", os.Args[0])
+		fmt.Fprintln(os.Stderr, "Keys: blk_<id>, inode:<id> or <id>, /path. Keys are read from stdin when none are given.")
+		fs.PrintDefaults()
+	}
+	registerEditsFlags(fs)
+	registerParseFlags(fs)
+	registerLogFlags(fs)
+	parseArgs(fs, args, 0)
+
+	var idx *PathIndex
+	keys := fs.Args()
+	if *indexPath != "" {
+		var err error
+		idx, err = loadPathIndex(*indexPath)
+		logIfErr(err)
+	} else {
+		if fs.NArg() < 1 {
+			fs.Usage()
+			os.Exit(exitUsage)
+		}
+		f, sectionMap, err := openImage(fs.Arg(0))
+		logIfErr(err)
+		ns, err := loadNamespace(f, sectionMap)
+		logIfErr(err)
+		nsInfo, err := parseNameSystemSection(sectionMap["NS_INFO"], f)
+		logIfErr(err)
+		f.Close()
+		idx = buildPathIndex(ns)
+		idx.TransactionId = nsInfo.GetTransactionId()
+		keys = keys[1:]
+
+		if *savePath != "" {
+			logIfErr(idx.Save(*savePath))
+			if len(keys) == 0 {
+				return
+			}
+		}
+	}
+
+	writer := bufio.NewWriter(os.Stdout)
+	defer writer.Flush()
+	if len(keys) > 0 {
+		for _, key := range keys {
+			idx.lookupKey(writer, key, *prefix)
+		}
+		return
+	}
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		if key := strings.TrimSpace(scanner.Text()); key != "" {
+			idx.lookupKey(writer, key, *prefix)
+		}
+	}
+	logIfErr(scanner.Err())
+}
+
+// lookupKey prints "key\tinodeId\tpath" for every match, or
+// "key\t-\tnot found".
+func (idx *PathIndex) lookupKey(w *bufio.Writer, key string, prefix bool) {
+	found := false
+	emit := func(inodeId uint64, path string) {
+		found = true
+		fmt.Fprintf(w, "%s\t%d\t%s\n", key, inodeId, convertSpecialSymbols(path))
+	}
+
+	switch {
+	case strings.HasPrefix(key, "/"):
+		if prefix {
+			idx.ListPrefix(key, emit)
+		} else if id, ok := idx.InodeByPath(key); ok {
+			emit(id, key)
+		}
+	case strings.HasPrefix(key, "blk_"):
+		blockId, err := strconv.ParseInt(strings.SplitN(key[4:], "_", 2)[0], 10, 64)
+		if err == nil {
+			if id, ok := idx.InodeByBlock(blockId); ok {
+				path, _ := idx.PathByInode(id)
+				emit(id, path)
+			}
+		}
+	default:
+		id, err := strconv.ParseUint(strings.TrimPrefix(key, "inode:"), 10, 64)
+		if err == nil {
+			if path, ok := idx.PathByInode(id); ok {
+				emit(id, path)
+			}
+		}
+	}
+	if !found {
+		fmt.Fprintf(w, "%s\t-\tnot found\n", key)
+	}
+}
+
+func buildPathIndex(ns *Namespace) *PathIndex {
+	type entry struct {
+		id   uint64
+		path string
+	}
+	type block struct {
+		id    int64
+		inode uint64
+	}
+	entries := make([]entry, 0, len(inodeData))
+	var blocks []block
+	ns.Walk(nil, func(inode *pb.INodeSection_INode, path string) {
+		entries = append(entries, entry{inode.GetId(), path})
+		for _, b := range inode.GetFile().GetBlocks() {
+			blocks = append(blocks, block{int64(b.GetBlockId()), inode.GetId()})
+		}
+	})
+	sort.Slice(entries, func(i, j int) bool { return entries[i].id < entries[j].id })
+	sort.Slice(blocks, func(i, j int) bool { return blocks[i].id < blocks[j].id })
+
+	idx := &PathIndex{
+		InodeIds:    make([]uint64, len(entries)),
+		Paths:       make([]string, len(entries)),
+		ByPath:      make([]uint32, len(entries)),
+		BlockIds:    make([]int64, len(blocks)),
+		BlockInodes: make([]uint64, len(blocks)),
+	}
+	for i, e := range entries {
+		idx.InodeIds[i] = e.id
+		idx.Paths[i] = e.path
+		idx.ByPath[i] = uint32(i)
+	}
+	sort.Slice(idx.ByPath, func(i, j int) bool { return idx.Paths[idx.ByPath[i]] < idx.Paths[idx.ByPath[j]] })
+	for i, b := range blocks {
+		idx.BlockIds[i] = b.id
+		idx.BlockInodes[i] = b.inode
+	}
+	return idx
+}
+
+func (idx *PathIndex) PathByInode(id uint64) (string, bool) {
+	i := sort.Search(len(idx.InodeIds), func(i int) bool { return idx.InodeIds[i] >= id })
+	if i < len(idx.InodeIds) && idx.InodeIds[i] == id {
+		return idx.Paths[i], true
+	}
+	return "", false
+}
+
+// InodeByBlock finds the file owning a block. Internal blocks of a
+// striped group (as reported by datanodes) resolve to their group.
+func (idx *PathIndex) InodeByBlock(blockId int64) (uint64, bool) {
+	find := func(id int64) (uint64, bool) {
+		i := sort.Search(len(idx.BlockIds), func(i int) bool { return idx.BlockIds[i] >= id })
+		if i < len(idx.BlockIds) && idx.BlockIds[i] == id {
+			return idx.BlockInodes[i], true
+		}
+		return 0, false
+	}
+	if id, ok := find(blockId); ok {
+		return id, true
+	}
+	if blockId < 0 {
+		return find(blockId &^ stripedBlockIndexMask)
+	}
+	return 0, false
+}
+
+func (idx *PathIndex) InodeByPath(path string) (uint64, bool) {
+	i := idx.searchPath(path)
+	if i < len(idx.ByPath) && idx.Paths[idx.ByPath[i]] == path {
+		return idx.InodeIds[idx.ByPath[i]], true
+	}
+	return 0, false
+}
+
+// ListPrefix calls fn for the directory at prefix and everything below
+// it, in path order.
+func (idx *PathIndex) ListPrefix(prefix string, fn func(inodeId uint64, path string)) {
+	dir := strings.TrimSuffix(prefix, "/")
+	if id, ok := idx.InodeByPath(dir); ok && dir != "" {
+		fn(id, dir)
+	}
+	for i := idx.searchPath(dir + "/"); i < len(idx.ByPath); i++ {
+		n := idx.ByPath[i]
+		if !strings.HasPrefix(idx.Paths[n], dir+"/") {
+			break
+		}
+		fn(idx.InodeIds[n], idx.Paths[n])
+	}
+}
+
+func (idx *PathIndex) searchPath(path string) int {
+	return sort.Search(len(idx.ByPath), func(i int) bool { return idx.Paths[idx.ByPath[i]] >= path })
+}
+
+func (idx *PathIndex) Save(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	if err := gob.NewEncoder(w).Encode(idx); err != nil {
+		f.Close()
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func loadPathIndex(path string) (*PathIndex, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	idx := &PathIndex{}
+	if err := gob.NewDecoder(bufio.NewReader(f)).Decode(idx); err != nil {
+		return nil, fmt.Errorf("%s: not a lookup index: %w", path, err)
+	}
+	infof("loaded index of %d inodes, %d blocks (txid %d)", len(idx.InodeIds), len(idx.BlockIds), idx.TransactionId)
+	return idx, nil
+}
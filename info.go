@@ -0,0 +1,90 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+
+	pb "hdfs-fsimage-parse-go/pkg/hadoop_hdfs_fsimage"
+)
+
+// runInfo implements the `info` subcommand: the FileSummary header,
+// NS_INFO and totals over INODE, without building the directory tree.
+func runInfo(args []string) {
+	fs := flag.NewFlagSet("info", flag.ExitOnError)
+	fs.Usage = commandUsage(fs, "[flags] <fsimage>")
+	registerParseFlags(fs)
+	registerLogFlags(fs)
+	parseArgs(fs, args, 1)
+
+	fileName := fs.Arg(0)
+	f, err := os.Open(fileName)
+	logIfErr(err)
+	defer f.Close()
+	fInfo, err := f.Stat()
+	logIfErr(err)
+	summary, _, err := readFileSummary(f, fInfo.Size())
+	if err != nil {
+		log.Fatalf("%s: %v", fileName, err)
+	}
+	sectionMap := make(map[string]*pb.FileSummary_Section)
+	for _, s := range summary.GetSections() {
+		sectionMap[s.GetName()] = s
+	}
+
+	nsInfo, err := parseNameSystemSection(sectionMap["NS_INFO"], f)
+	logIfErr(err)
+	logIfErr(parseStringTable(sectionMap["STRING_TABLE"], f))
+	logIfErr(parseInodeSection(sectionMap["INODE"], f))
+	snapshots, err := parseSnapshotSection(sectionMap["SNAPSHOT"], f)
+	logIfErr(err)
+
+	var files, dirs, symlinks, blocks, underConstruction int
+	var bytes, rawBytes uint64
+	for _, inode := range inodeData {
+		switch inode.GetType() {
+		case pb.INodeSection_INode_FILE:
+			files++
+			file := inode.GetFile()
+			blocks += len(file.GetBlocks())
+			bytes += getFileSize(file)
+			rawBytes += fileRawBytes(file)
+			if file.GetFileUC() != nil {
+				underConstruction++
+			}
+		case pb.INodeSection_INode_DIRECTORY:
+			dirs++
+		case pb.INodeSection_INode_SYMLINK:
+			symlinks++
+		}
+	}
+
+	codec := summary.GetCodec()
+	if codec == "" {
+		codec = "none"
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(w, "Image:\t%s\n", fileName)
+	fmt.Fprintf(w, "Size:\t%d bytes\n", fInfo.Size())
+	fmt.Fprintf(w, "On-disk version:\t%d\n", summary.GetOndiskVersion())
+	fmt.Fprintf(w, "Layout version:\t%d\n", int32(summary.GetLayoutVersion()))
+	fmt.Fprintf(w, "Codec:\t%s\n", codec)
+	fmt.Fprintf(w, "Sections:\t%d\n", len(summary.GetSections()))
+	fmt.Fprintf(w, "Namespace id:\t%d\n", nsInfo.GetNamespaceId())
+	fmt.Fprintf(w, "Transaction id:\t%d\n", nsInfo.GetTransactionId())
+	fmt.Fprintf(w, "Generation stamp:\t%d\n", nsInfo.GetGenstampV2())
+	fmt.Fprintf(w, "Last block id:\t%d\n", nsInfo.GetLastAllocatedBlockId())
+	fmt.Fprintf(w, "Last striped block id:\t%d\n", int64(nsInfo.GetLastAllocatedStripedBlockId()))
+	fmt.Fprintf(w, "Strings:\t%d\n", len(stringMap))
+	fmt.Fprintf(w, "Inodes:\t%d\n", len(inodeData))
+	fmt.Fprintf(w, "Files:\t%d (%d under construction)\n", files, underConstruction)
+	fmt.Fprintf(w, "Directories:\t%d\n", dirs)
+	fmt.Fprintf(w, "Symlinks:\t%d\n", symlinks)
+	fmt.Fprintf(w, "Blocks:\t%d\n", blocks)
+	fmt.Fprintf(w, "Bytes:\t%d (%s)\n", bytes, formatSize(bytes))
+	fmt.Fprintf(w, "Raw bytes:\t%d (%s)\n", rawBytes, formatSize(rawBytes))
+	fmt.Fprintf(w, "Snapshots:\t%d\n", len(snapshots))
+	logIfErr(w.Flush())
+}
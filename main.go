@@ -4,14 +4,16 @@ import (
 	"bufio"
 	"bytes"
 	"encoding/binary"
+	"flag"
 	"fmt"
 	"io"
 	"log"
 	"os"
+	"path/filepath"
 	"strings"
 	"time"
 
-	pb "main/pkg/hadoop_hdfs_fsimage"
+	pb "hdfs-fsimage-parse-go/pkg/hadoop_hdfs_fsimage"
 
 	"google.golang.org/protobuf/proto"
 )
@@ -26,6 +28,14 @@ var (
 	stringMap = make(map[uint32]string)
 )
 
+// resetNamespace empties inodeData, stringMap and the parse report
+// before another image is loaded by the same process.
+func resetNamespace() {
+	clear(inodeData)
+	clear(stringMap)
+	parseReport.reset()
+}
+
 type PermissionStatus struct {
 	Permission string
 	UserName   string
@@ -54,59 +64,182 @@ func logIfErr(err error) {
 }
 
 func main() {
-	if len(os.Args) < 2 {
-		fmt.Fprintf(os.Stderr, "Usage: %s [output.tsv]\n", os.Args[0])
-		os.Exit(1)
+	args := os.Args[1:]
+	if len(args) == 0 {
+		usage()
+		os.Exit(exitUsage)
+	}
+	switch args[0] {
+	case "-h", "-help", "--help", "help":
+		usage()
+		return
+	}
+
+	cmd, ok := findCommand(args[0])
+	switch {
+	case ok:
+		args = args[1:]
+	case !strings.HasPrefix(args[0], "-") && !fileExists(args[0]):
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n", args[0])
+		usage()
+		os.Exit(exitUsage)
+	default:
+		// the old `main [flags] <fsimage> [output]` form runs export
+		cmd, _ = findCommand("export")
 	}
+	cmd.run(args)
 
-	fileName := os.Args[1]
-	outputPath := ""
-	if len(os.Args) > 2 {
-		outputPath = os.Args[2]
+	if parseReport.Total() > 0 {
+		parseReport.Log()
+		os.Exit(exitIncomplete)
 	}
+}
+
+func fileExists(name string) bool {
+	_, err := os.Stat(name)
+	return err == nil
+}
 
-	fInfo, err := os.Stat(fileName)
+// runExport implements the `export` subcommand, one row per inode.
+func runExport(args []string) {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	output := fs.String("o", "", "output file (default: stdout, or the second argument)")
+	verify := fs.Bool("verify", false, "verify the .md5 sidecar and section layout before parsing")
+	format := fs.String("format", "", "output format: tsv or sqlite (default: from the output extension, else tsv)")
+	var outOpts OutputOptions
+	registerOutputFlags(fs, &outOpts)
+	var splitOpts SplitOptions
+	registerSplitFlags(fs, &splitOpts)
+	var fOpts FilterOptions
+	registerFilterFlags(fs, &fOpts)
+	registerEditsFlags(fs)
+	registerParseFlags(fs)
+	registerLogFlags(fs)
+	fs.Usage = commandUsage(fs, "[flags] <fsimage> [output.tsv|output.tsv.gz|output.db|output-dir]",
+		"With -split-rows, -split-size or -partition-by the output is a directory of part files.")
+	parseArgs(fs, args, 1)
+
+	fileName := fs.Arg(0)
+	outputPath := *output
+	if outputPath == "" {
+		outputPath = fs.Arg(1)
+	}
+
+	filter, err := NewFilter(fOpts, time.Now())
 	logIfErr(err)
-	f, err := os.Open(fileName)
+
+	if *verify {
+		if err := verifyImage(fileName, false); err != nil {
+			log.Fatalf("%s: %v", fileName, err)
+		}
+	}
+
+	f, sectionMap, err := openImage(fileName)
 	logIfErr(err)
 	defer f.Close()
+	ns, err := loadNamespace(f, sectionMap)
+	logIfErr(err)
+
+	if splitOpts.enabled() {
+		if outputPath == "" {
+			log.Fatal("split output needs an output directory")
+		}
+		if *format != "" && *format != "tsv" {
+			log.Fatalf("split output is only available as tsv")
+		}
+		writeTSVSplit(ns, filter, outputPath, fileName, splitOpts, outOpts)
+		return
+	}
+	if *format == "" {
+		*format = formatFromExtension(trimCompressionExt(outputPath))
+	}
+	switch *format {
+	case "sqlite":
+		if outputPath == "" {
+			log.Fatal("sqlite output needs an output path")
+		}
+		if c, err := outOpts.compression(outputPath); err != nil || c != compressNone {
+			log.Fatal("sqlite output cannot be compressed")
+		}
+		writeSQLite(outputPath, f, sectionMap, ns, filter)
+	case "tsv":
+		writeTSV(ns, filter, outputPath, outOpts)
+	default:
+		log.Fatalf("unknown format %q (want tsv or sqlite)", *format)
+	}
+}
+
+func formatFromExtension(outputPath string) string {
+	switch strings.ToLower(filepath.Ext(outputPath)) {
+	case ".db", ".sqlite", ".sqlite3":
+		return "sqlite"
+	}
+	return "tsv"
+}
 
-	fileLength := fInfo.Size()
-	fSummaryLength := decodeFileSummaryLength(fileLength, f)
-	sectionMap := parseFileSummary(f, fileLength, fSummaryLength)
+// openImage opens an fsimage and indexes its sections by name.
+func openImage(fileName string) (*os.File, map[string]*pb.FileSummary_Section, error) {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return nil, nil, err
+	}
+	fInfo, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
 
+	sectionMap, err := parseFileSummary(f, fInfo.Size())
+	if err != nil {
+		f.Close()
+		return nil, nil, fmt.Errorf("%s: %w", fileName, err)
+	}
+	return f, sectionMap, nil
+}
+
+// loadNamespace fills stringMap and inodeData and returns the directory
+// structure from INODE_DIR, with the edits selected by -edits replayed
+// onto it.
+func loadNamespace(f *os.File, sectionMap map[string]*pb.FileSummary_Section) (*Namespace, error) {
 	// ИСПРАВЛЕНИЕ 1: Правильное имя секции
 	if sec, ok := sectionMap["STRING_TABLE"]; ok {
-		parseStringTable(sec, f)
-		fmt.Printf("Loaded %d strings\n", len(stringMap))
+		if err := parseStringTable(sec, f); err != nil {
+			return nil, err
+		}
+		infof("loaded %d strings", len(stringMap))
 	} else {
 		// Попробуем альтернативные имена, если вдруг версия Hadoop странная
 		if sec, ok := sectionMap["STRINGTABLE"]; ok {
-			parseStringTable(sec, f)
+			if err := parseStringTable(sec, f); err != nil {
+				return nil, err
+			}
 		} else {
-			fmt.Println("Warning: STRING_TABLE section not found!")
+			log.Print("warning: STRING_TABLE section not found, user and group names are numeric")
+		}
+	}
+
+	for _, name := range []string{"INODE", "INODE_DIR"} {
+		if sectionMap[name] == nil {
+			return nil, fmt.Errorf("section %s not found", name)
 		}
 	}
 
 	inodeSectionInfo := sectionMap["INODE"]
-	parseInodeSection(inodeSectionInfo, f)
+	if err := parseInodeSection(inodeSectionInfo, f); err != nil {
+		return nil, err
+	}
+	infof("loaded %d inodes", len(inodeData))
 
 	inodeDirectorySectionInfo := sectionMap["INODE_DIR"]
-	parChildrenMap := parseInodeDirectorySection(inodeDirectorySectionInfo, f)
-
-	rootTreeNode := findChildren(parChildrenMap, ROOT_INODE_ID)
-	rows := make([]Row, 0, 10000)
-
-	if rootInode, exists := inodeData[ROOT_INODE_ID]; exists {
-		rootRow := buildRowForINode(rootInode, "/")
-		rows = append(rows, rootRow)
+	ns, err := parseInodeDirectorySection(inodeDirectorySectionInfo, f)
+	if err != nil || len(editsOptions.Paths) == 0 {
+		return ns, err
 	}
-
-	for _, child := range rootTreeNode {
-		collectRows(child, "/", &rows)
+	nsInfo, err := parseNameSystemSection(sectionMap["NS_INFO"], f)
+	if err != nil {
+		return nil, err
 	}
-
-	writeTSV(rows, outputPath)
+	return replayEdits(ns, int64(nsInfo.GetTransactionId()))
 }
 
 func buildRowForINode(inode *pb.INodeSection_INode, path string) Row {
@@ -150,32 +283,6 @@ func buildRowForINode(inode *pb.INodeSection_INode, path string) Row {
 	return row
 }
 
-func collectRows(node *INodeTree, parentPath string, rows *[]Row) {
-	if node == nil {
-		return
-	}
-
-	inode := node.Inode
-	nodeNameStr := string(inode.Name)
-	currentPath := parentPath
-	if parentPath != "/" {
-		currentPath = parentPath + "/" + nodeNameStr
-	} else {
-		currentPath = "/" + nodeNameStr
-	}
-
-	if inodeProto, exists := inodeData[inode.Id]; exists {
-		row := buildRowForINode(inodeProto, currentPath)
-		*rows = append(*rows, row)
-	}
-
-	if node.Children != nil {
-		for _, child := range node.Children {
-			collectRows(child, currentPath, rows)
-		}
-	}
-}
-
 func convertSpecialSymbols(input string) string {
 	replacements := map[string]string{
 		"\x00": "\\x00",
@@ -394,205 +501,254 @@ func formatPermissionBits(mode uint16) string {
 // ... И функции parseFileSummary, parseStringTable и т.д. должны быть здесь же или в util.go
 // Для целостности приведу их тут же, замените весь файл.
 
-func decodeFileSummaryLength(fileLength int64, imageFile *os.File) int32 {
+func decodeFileSummaryLength(fileLength int64, imageFile io.ReaderAt) (int32, error) {
 	var fSummaryLength int32
 	fileSummaryLengthStart := fileLength - FILE_SUM_BYTES
 	fSumLenBytes := make([]byte, FILE_SUM_BYTES)
 	_, err := imageFile.ReadAt(fSumLenBytes, fileSummaryLengthStart)
 	if err != nil && err != io.EOF {
-		log.Fatal(err)
+		return 0, fmt.Errorf("reading summary length at offset %d: %w", fileSummaryLengthStart, err)
 	}
 	bReader := bytes.NewReader(fSumLenBytes)
 	if err = binary.Read(bReader, binary.BigEndian, &fSummaryLength); err != nil {
-		log.Fatal(err)
+		return 0, fmt.Errorf("reading summary length at offset %d: %w", fileSummaryLengthStart, err)
 	}
-	return fSummaryLength
+	return fSummaryLength, nil
 }
 
-func parseFileSummary(imageFile *os.File, fileLength int64, fSummaryLength int32) map[string]*pb.FileSummary_Section {
-	sectionMap := make(map[string]*pb.FileSummary_Section)
-	fileSummary := &pb.FileSummary{}
-	fSummaryLength64 := int64(fSummaryLength)
-	readAt := fileLength - fSummaryLength64 - FILE_SUM_BYTES
-	fSummaryBytes := make([]byte, fSummaryLength)
-	_, err := imageFile.ReadAt(fSummaryBytes, readAt)
-	if err != nil && err != io.EOF {
-		log.Fatal(err)
-	}
-	length, c := binary.Uvarint(fSummaryBytes)
-	if c <= 0 {
-		log.Fatal("buf too small(0) or overflows(-1): ", c)
-	}
-	fSummaryBytes = fSummaryBytes[c:]
-	if err = proto.Unmarshal(fSummaryBytes[:length], fileSummary); err != nil {
-		log.Fatal(err)
+func parseFileSummary(imageFile io.ReaderAt, fileLength int64) (map[string]*pb.FileSummary_Section, error) {
+	fileSummary, summaryStart, err := readFileSummary(imageFile, fileLength)
+	if err != nil {
+		return nil, err
 	}
+	sectionMap := make(map[string]*pb.FileSummary_Section)
 	for _, value := range fileSummary.GetSections() {
+		// a corrupt summary must not make a section read past the file
+		if err := checkSectionBounds(value, int64(len(imageMagic)), summaryStart); err != nil {
+			err := &SectionError{Section: value.GetName(), Offset: int64(value.GetOffset()), Record: -1, Err: err}
+			if err := parseReport.add(err); err != nil {
+				return nil, err
+			}
+			continue
+		}
 		sectionMap[value.GetName()] = value
 	}
-	return sectionMap
+	return sectionMap, nil
 }
 
-func parseStringTable(info *pb.FileSummary_Section, imageFile *os.File) {
+func parseNameSystemSection(info *pb.FileSummary_Section, imageFile *os.File) (*pb.NameSystemSection, error) {
+	nsInfo := &pb.NameSystemSection{}
 	if info == nil {
-		return
+		return nsInfo, nil
 	}
 
-	stringTableBytes := make([]byte, info.GetLength())
-	_, err := imageFile.ReadAt(stringTableBytes, int64(info.GetOffset()))
-	logIfErr(err)
-
-	// Пропускаем header секции
-	headerLen, c := binary.Uvarint(stringTableBytes)
-	if c <= 0 {
-		log.Fatal("StringTable header error")
+	r, err := readSection(info, imageFile)
+	if err != nil {
+		return nsInfo, err
 	}
+	record, err := r.next()
+	if err == nil {
+		err = proto.Unmarshal(record, nsInfo)
+	}
+	if err != nil && err != io.EOF {
+		return nsInfo, asSectionError(r, err)
+	}
+	return nsInfo, nil
+}
 
-	stringTableBytes = stringTableBytes[c+int(headerLen):]
-
-	// Читаем записи
-	for len(stringTableBytes) > 0 {
-		msgLen, c := binary.Uvarint(stringTableBytes)
-		if c <= 0 {
-			break
+func parseStringTable(info *pb.FileSummary_Section, imageFile *os.File) error {
+	return forEachRecord(info, imageFile, &pb.StringTableSection{}, func(entryBytes []byte) error {
+		entry := &pb.StringTableSection_Entry{}
+		if err := proto.Unmarshal(entryBytes, entry); err != nil {
+			return err
 		}
-		stringTableBytes = stringTableBytes[c:]
+		stringMap[entry.GetId()] = entry.GetStr()
+		return nil
+	})
+}
 
-		if uint64(len(stringTableBytes)) < msgLen {
-			break
+func parseInodeSection(info *pb.FileSummary_Section, imageFile *os.File) error {
+	return forEachRecord(info, imageFile, &pb.INodeSection{}, func(inodeBytes []byte) error {
+		inode := &pb.INodeSection_INode{}
+		if err := proto.Unmarshal(inodeBytes, inode); err != nil {
+			return err
 		}
-		entryBytes := stringTableBytes[:msgLen]
-		stringTableBytes = stringTableBytes[msgLen:]
+		inodeData[inode.GetId()] = inode
+		return nil
+	})
+}
 
-		entry := &pb.StringTableSection_Entry{}
-		if err = proto.Unmarshal(entryBytes, entry); err == nil {
-			stringMap[entry.GetId()] = entry.GetStr()
+func parseInodeDirectorySection(info *pb.FileSummary_Section, imageFile *os.File) (*Namespace, error) {
+	ns := &Namespace{}
+	err := forEachRecord(info, imageFile, nil, func(entryBytes []byte) error {
+		dirEntry := &pb.INodeDirectorySection_DirEntry{}
+		if err := proto.Unmarshal(entryBytes, dirEntry); err != nil {
+			return err
 		}
-	}
-	fmt.Println("DEBUG: String Table Content:")
-	for id, str := range stringMap {
-		fmt.Printf("ID %d -> %s\n", id, str)
-	}
+		ns.addDirEntry(dirEntry.GetParent(), dirEntry.GetChildren(), dirEntry.GetRefChildren())
+		return nil
+	})
+	ns.finish()
+	return ns, err
 }
 
-func parseInodeSection(info *pb.FileSummary_Section, imageFile *os.File) {
-	inodeSectionBytes := make([]byte, info.GetLength())
-	_, err := imageFile.ReadAt(inodeSectionBytes, int64(info.GetOffset()))
-	logIfErr(err)
-
-	headerLen, c := binary.Uvarint(inodeSectionBytes)
-	if c <= 0 {
-		log.Fatal("Inode header error")
+// readDelimited splits one varint length-prefixed record off buf.
+func readDelimited(buf []byte) (record []byte, rest []byte, ok bool) {
+	msgLen, c := binary.Uvarint(buf)
+	if c <= 0 || uint64(len(buf)-c) < msgLen {
+		return nil, buf, false
 	}
-	inodeSectionBytes = inodeSectionBytes[c+int(headerLen):]
-
-	for len(inodeSectionBytes) > 0 {
-		msgLen, c := binary.Uvarint(inodeSectionBytes)
-		if c <= 0 {
-			break
-		}
-		inodeSectionBytes = inodeSectionBytes[c:]
+	return buf[c : c+int(msgLen)], buf[c+int(msgLen):], true
+}
 
-		if uint64(len(inodeSectionBytes)) < msgLen {
-			break
+// parseINodeReferenceSection returns the INODE_REFERENCE records; the
+// refChildren of INODE_DIR entries index into this slice.
+func parseINodeReferenceSection(info *pb.FileSummary_Section, imageFile *os.File) ([]*pb.INodeReferenceSection_INodeReference, error) {
+	var refs []*pb.INodeReferenceSection_INodeReference
+	err := forEachRecord(info, imageFile, nil, func(entryBytes []byte) error {
+		ref := &pb.INodeReferenceSection_INodeReference{}
+		if err := proto.Unmarshal(entryBytes, ref); err != nil {
+			// keep the slot, refChildren index into this slice
+			refs = append(refs, ref)
+			return err
 		}
-		inodeBytes := inodeSectionBytes[:msgLen]
-		inodeSectionBytes = inodeSectionBytes[msgLen:]
+		refs = append(refs, ref)
+		return nil
+	})
+	return refs, err
+}
 
-		inode := &pb.INodeSection_INode{}
-		if err = proto.Unmarshal(inodeBytes, inode); err == nil {
-			inodeData[inode.GetId()] = inode
-		}
-	}
+// SnapshotDiffs is the part of SNAPSHOT_DIFF needed to tell inodes kept
+// alive by snapshots from real orphans.
+type SnapshotDiffs struct {
+	Deleted     map[uint64]bool   // inodes removed from a directory but kept by a snapshot
+	DeletedRefs []uint32          // same, for reference nodes
+	FileSizes   map[uint64]uint64 // largest fileSize recorded by any FileDiff of a file
 }
 
-func parseInodeDirectorySection(info *pb.FileSummary_Section, imageFile *os.File) map[uint64][]uint64 {
-	parChildrenMap := make(map[uint64][]uint64)
-	dirSectionBytes := make([]byte, info.GetLength())
-	_, err := imageFile.ReadAt(dirSectionBytes, int64(info.GetOffset()))
-	logIfErr(err)
+func parseSnapshotDiffSection(info *pb.FileSummary_Section, imageFile *os.File) (*SnapshotDiffs, error) {
+	diffs := &SnapshotDiffs{Deleted: make(map[uint64]bool), FileSizes: make(map[uint64]uint64)}
+	if info == nil {
+		return diffs, nil
+	}
 
-	for len(dirSectionBytes) > 0 {
-		msgLen, c := binary.Uvarint(dirSectionBytes)
-		if c <= 0 {
-			break
+	r, err := readSection(info, imageFile)
+	if err != nil {
+		return diffs, parseReport.add(sectionError(info, err))
+	}
+	// every DiffEntry is followed by numOfDiff diffs, so a bad record
+	// loses the rest of the section
+	fail := func(err error) (*SnapshotDiffs, error) {
+		return diffs, parseReport.add(asSectionError(r, err))
+	}
+	for {
+		entryBytes, err := r.next()
+		if err == io.EOF {
+			return diffs, nil
+		} else if err != nil {
+			return fail(err)
 		}
-		dirSectionBytes = dirSectionBytes[c:]
 
-		if uint64(len(dirSectionBytes)) < msgLen {
-			break
+		entry := &pb.SnapshotDiffSection_DiffEntry{}
+		if err = proto.Unmarshal(entryBytes, entry); err != nil {
+			return fail(err)
 		}
-		entryBytes := dirSectionBytes[:msgLen]
-		dirSectionBytes = dirSectionBytes[msgLen:]
-
-		dirEntry := &pb.INodeDirectorySection_DirEntry{}
-		if err = proto.Unmarshal(entryBytes, dirEntry); err == nil {
-			parChildrenMap[dirEntry.GetParent()] = dirEntry.GetChildren()
+		for i := uint32(0); i < entry.GetNumOfDiff(); i++ {
+			diffBytes, err := r.next()
+			if err == io.EOF {
+				return fail(errTruncatedRecord)
+			} else if err != nil {
+				return fail(err)
+			}
+
+			switch entry.GetType() {
+			case pb.SnapshotDiffSection_DiffEntry_FILEDIFF:
+				fileDiff := &pb.SnapshotDiffSection_FileDiff{}
+				if err = proto.Unmarshal(diffBytes, fileDiff); err != nil {
+					return fail(err)
+				}
+				if fileDiff.GetFileSize() > diffs.FileSizes[entry.GetInodeId()] {
+					diffs.FileSizes[entry.GetInodeId()] = fileDiff.GetFileSize()
+				}
+			case pb.SnapshotDiffSection_DiffEntry_DIRECTORYDIFF:
+				dirDiff := &pb.SnapshotDiffSection_DirectoryDiff{}
+				if err = proto.Unmarshal(diffBytes, dirDiff); err != nil {
+					return fail(err)
+				}
+				for _, id := range dirDiff.GetDeletedINode() {
+					diffs.Deleted[id] = true
+				}
+				diffs.DeletedRefs = append(diffs.DeletedRefs, dirDiff.GetDeletedINodeRef()...)
+				// the created list follows the diff as separate records
+				for j := uint32(0); j < dirDiff.GetCreatedListSize(); j++ {
+					if _, err := r.next(); err != nil {
+						if err == io.EOF {
+							err = errTruncatedRecord
+						}
+						return fail(err)
+					}
+				}
+			}
 		}
 	}
-	return parChildrenMap
 }
 
-type INodeTree struct {
-	Inode    INode
-	Children []*INodeTree
+type Snapshot struct {
+	Id    uint32
+	DirId uint64
+	Name  string
+	Mtime uint64
 }
 
-type INode struct {
-	Name []byte
-	Id   uint64
-	Type int
+func parseSnapshotSection(info *pb.FileSummary_Section, imageFile *os.File) ([]Snapshot, error) {
+	var snapshots []Snapshot
+	err := forEachRecord(info, imageFile, &pb.SnapshotSection{}, func(entryBytes []byte) error {
+		entry := &pb.SnapshotSection_Snapshot{}
+		if err := proto.Unmarshal(entryBytes, entry); err != nil {
+			return err
+		}
+		root := entry.GetRoot()
+		snapshots = append(snapshots, Snapshot{
+			Id:    entry.GetSnapshotId(),
+			DirId: root.GetId(),
+			Name:  string(root.GetName()),
+			Mtime: root.GetDirectory().GetModificationTime(),
+		})
+		return nil
+	})
+	return snapshots, err
 }
 
-func findChildren(parChildrenMap map[uint64][]uint64, curInodeId uint64) []*INodeTree {
-	children, ok := parChildrenMap[curInodeId]
-	if !ok || len(children) == 0 {
-		return nil
-	}
+const tsvHeader = "Path\tReplication\tModificationTime\tAccessTime\tPreferredBlockSize\tBlocksCount\tFileSize\tNSQUOTA\tDSQUOTA\tPermission\tUserName\tGroupName\n"
 
-	refs := make([]*INodeTree, len(children))
-	for i, child := range children {
-		inode := INode{Id: child}
-		if inodeProto, exists := inodeData[child]; exists {
-			inode.Name = inodeProto.GetName()
-		}
+// writeTSV streams one row per visited inode straight to the output.
+func writeTSV(ns *Namespace, filter *Filter, outputPath string, outOpts OutputOptions) {
+	out, err := createOutput(outputPath, outOpts)
+	logIfErr(err)
+	writer := bufio.NewWriterSize(out, 1<<20)
 
-		subChildren := findChildren(parChildrenMap, child)
-		refs[i] = &INodeTree{inode, subChildren}
-	}
-	return refs
+	writer.WriteString(tsvHeader)
+
+	ns.Walk(filter, func(inode *pb.INodeSection_INode, path string) {
+		writeTSVRow(writer, buildRowForINode(inode, path))
+	})
+	logIfErr(writer.Flush())
+	logIfErr(out.Close())
 }
 
-func writeTSV(rows []Row, outputPath string) {
-	var writer *bufio.Writer
-	if outputPath == "" {
-		writer = bufio.NewWriter(os.Stdout)
-	} else {
-		f, err := os.Create(outputPath)
-		logIfErr(err)
-		defer f.Close()
-		writer = bufio.NewWriter(f)
-	}
-
-	header := "Path\tReplication\tModificationTime\tAccessTime\tPreferredBlockSize\tBlocksCount\tFileSize\tNSQUOTA\tDSQUOTA\tPermission\tUserName\tGroupName\n"
-	writer.WriteString(header)
-
-	for _, row := range rows {
-		line := fmt.Sprintf("%s\t%d\t%s\t%s\t%d\t%d\t%d\t%d\t%d\t%s\t%s\t%s\n",
-			row.Path,
-			row.Replication,
-			row.ModificationTime,
-			row.AccessTime,
-			row.PreferredBlockSize,
-			row.BlocksCount,
-			row.FileSize,
-			row.NsQuota,
-			row.DsQuota,
-			row.Permission,
-			row.UserName,
-			row.GroupName,
-		)
-		writer.WriteString(line)
-	}
-	writer.Flush()
+func writeTSVRow(writer io.Writer, row Row) {
+	fmt.Fprintf(writer, "%s\t%d\t%s\t%s\t%d\t%d\t%d\t%d\t%d\t%s\t%s\t%s\n",
+		row.Path,
+		row.Replication,
+		row.ModificationTime,
+		row.AccessTime,
+		row.PreferredBlockSize,
+		row.BlocksCount,
+		row.FileSize,
+		row.NsQuota,
+		row.DsQuota,
+		row.Permission,
+		row.UserName,
+		row.GroupName,
+	)
 }
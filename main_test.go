@@ -0,0 +1,59 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+func TestMain(m *testing.M) {
+	flag.Parse()
+	if !testing.Verbose() {
+		verbosity = 0
+	}
+	os.Exit(m.Run())
+}
+
+// checkGolden compares got with testdata/name, or rewrites it with
+// -update.
+func checkGolden(t *testing.T, name string, got []byte) {
+	t.Helper()
+	golden := filepath.Join("testdata", name)
+	if *update {
+		if err := os.WriteFile(golden, got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("output differs from %s, run go test -update to see the difference in git diff", golden)
+	}
+}
+
+func TestExportGolden(t *testing.T) {
+	fileName := writeTestImage(t, testGenerateOptions())
+	f, sectionMap, err := openImage(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	ns, err := loadNamespace(f, sectionMap)
+	if err != nil {
+		t.Fatal(err)
+	}
+	output := filepath.Join(t.TempDir(), "export.tsv")
+	writeTSV(ns, nil, output, OutputOptions{})
+	got, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkGolden(t, "export.tsv", got)
+}
@@ -0,0 +1,385 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const metricsPrefix = "hdfs_fsimage_"
+
+// otherLabel collects the users and directories beyond the cardinality
+// limits, so the per-label series still add up to the totals.
+const otherLabel = "_other"
+
+// fileSizeBuckets are the upper bounds of the file size histogram.
+var fileSizeBuckets = []uint64{0, 1 << 10, 64 << 10, 1 << 20, 16 << 20, 128 << 20, 1 << 30, 16 << 30, 256 << 30}
+
+// MetricsOptions select the labelled series computed from the namespace.
+type MetricsOptions struct {
+	Depth         int
+	SmallFileSize string
+	MaxUsers      int
+	MaxDirs       int
+	MaxQuotas     int
+}
+
+func registerMetricsFlags(fs *flag.FlagSet, opts *MetricsOptions) {
+	fs.IntVar(&opts.Depth, "depth", 1, "path components of the directories usage is reported for")
+	fs.StringVar(&opts.SmallFileSize, "small-file-size", "1M", "files below this size count as small")
+	fs.IntVar(&opts.MaxUsers, "max-users", 100, "users with their own series, the rest are summed under user=\""+otherLabel+"\" (0 for all)")
+	fs.IntVar(&opts.MaxDirs, "max-dirs", 100, "directories with their own series, the rest are summed under path=\""+otherLabel+"\" (0 for all)")
+	fs.IntVar(&opts.MaxQuotas, "max-quotas", 100, "quota directories with their own series, closest to their limit first (0 for all)")
+}
+
+// metricFamily is one metric with its samples, in the Prometheus text
+// exposition format. Labels are name, value pairs.
+type metricFamily struct {
+	name    string
+	help    string
+	typ     string // gauge, counter, histogram or info
+	samples []metricSample
+}
+
+type metricSample struct {
+	suffix string
+	labels []string
+	value  float64
+}
+
+func (m *metricFamily) add(value float64, labels ...string) {
+	m.samples = append(m.samples, metricSample{labels: labels, value: value})
+}
+
+// ImageMetrics are the gauges of one image.
+type ImageMetrics struct {
+	Image         string
+	Families      []metricFamily
+	TransactionId uint64
+}
+
+// collectMetrics turns the usage of an image into gauges.
+func collectMetrics(u *imageUsage, opts MetricsOptions) *ImageMetrics {
+	nsInfo, total := u.nsInfo, u.total
+	m := &ImageMetrics{Image: filepath.Base(u.fileName), TransactionId: nsInfo.GetTransactionId()}
+	gauge := func(name, help string, value float64, labels ...string) {
+		f := metricFamily{name: metricsPrefix + name, help: help, typ: "gauge"}
+		f.add(value, labels...)
+		m.Families = append(m.Families, f)
+	}
+	info := metricFamily{name: metricsPrefix + "image", help: "The image the metrics were computed from.", typ: "info"}
+	info.add(1, "image", m.Image, "layout_version", strconv.Itoa(int(int32(u.layoutVersion))),
+		"namespace_id", strconv.FormatUint(uint64(nsInfo.GetNamespaceId()), 10))
+	m.Families = append(m.Families, info)
+	gauge("transaction_id", "Last transaction id included in the image.", float64(nsInfo.GetTransactionId()))
+	gauge("timestamp_seconds", "Modification time of the image file.", float64(u.fInfo.ModTime().UnixMilli())/1000)
+	gauge("last_modification_timestamp_seconds", "Newest modification time of a file or directory in the image.", float64(u.lastModified)/1000)
+	gauge("size_bytes", "Size of the image file.", float64(u.fInfo.Size()))
+	gauge("load_duration_seconds", "Time taken to load the namespace from the image.", u.loadTime.Seconds())
+	gauge("skipped_records", "Corrupt records skipped while parsing the image.", float64(parseReport.Total()))
+	gauge("files", "Files in the namespace.", float64(total.files))
+	gauge("directories", "Directories in the namespace, the root included.", float64(total.dirs))
+	gauge("symlinks", "Symlinks in the namespace.", float64(u.symlinks))
+	gauge("files_under_construction", "Files open for writing.", float64(u.underConstruction))
+	gauge("blocks", "Blocks of all files.", float64(u.blocks))
+	gauge("file_bytes", "Size of all files.", float64(total.bytes))
+	gauge("raw_bytes", "Replicated size of all files; striped files count their data only.", float64(total.rawBytes))
+	gauge("small_files", fmt.Sprintf("Files smaller than %d bytes.", u.smallFileSize), float64(total.smallFiles))
+
+	hist := metricFamily{name: metricsPrefix + "file_size_bytes", help: "Distribution of file sizes.", typ: "histogram"}
+	cumulative := uint64(0)
+	for i, le := range fileSizeBuckets {
+		cumulative += u.sizeCounts[i]
+		hist.samples = append(hist.samples, metricSample{suffix: "_bucket", labels: []string{"le", strconv.FormatUint(le, 10)}, value: float64(cumulative)})
+	}
+	cumulative += u.sizeCounts[len(fileSizeBuckets)]
+	hist.samples = append(hist.samples,
+		metricSample{suffix: "_bucket", labels: []string{"le", "+Inf"}, value: float64(cumulative)},
+		metricSample{suffix: "_sum", value: float64(total.bytes)},
+		metricSample{suffix: "_count", value: float64(cumulative)})
+	m.Families = append(m.Families, hist)
+
+	m.Families = append(m.Families, usageFamilies("user", "user", "owned by the user", u.users, opts.MaxUsers)...)
+	m.Families = append(m.Families, usageFamilies("directory", "path", "under the directory", u.dirs, opts.MaxDirs)...)
+	m.Families = append(m.Families, quotaFamilies(u.quotas, opts.MaxQuotas)...)
+	return m
+}
+
+// usageFamilies returns the per-label usage series, keeping the limit
+// largest keys by bytes and summing the rest under otherLabel.
+func usageFamilies(prefix, label, what string, usage map[string]*usageCounts, limit int) []metricFamily {
+	keys := make([]string, 0, len(usage))
+	for k := range usage {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if a, b := usage[keys[i]].bytes, usage[keys[j]].bytes; a != b {
+			return a > b
+		}
+		return keys[i] < keys[j]
+	})
+	counts := make([]*usageCounts, len(keys))
+	for i, k := range keys {
+		counts[i] = usage[k]
+	}
+	// the rest is summed here, not into usage, which watch also records
+	if limit > 0 && len(keys) > limit {
+		other := &usageCounts{}
+		for _, k := range keys[limit:] {
+			u := usage[k]
+			other.files += u.files
+			other.dirs += u.dirs
+			other.smallFiles += u.smallFiles
+			other.bytes += u.bytes
+			other.rawBytes += u.rawBytes
+		}
+		debugf("%d %s label values summed under %q", len(keys)-limit, label, otherLabel)
+		keys = append(keys[:limit:limit], otherLabel)
+		counts = append(counts[:limit:limit], other)
+	}
+
+	families := []metricFamily{
+		{name: metricsPrefix + prefix + "_files", help: "Files " + what + ".", typ: "gauge"},
+		{name: metricsPrefix + prefix + "_file_bytes", help: "Size of the files " + what + ".", typ: "gauge"},
+		{name: metricsPrefix + prefix + "_raw_bytes", help: "Replicated size of the files " + what + ".", typ: "gauge"},
+		{name: metricsPrefix + prefix + "_small_files", help: "Small files " + what + ".", typ: "gauge"},
+	}
+	if prefix == "directory" {
+		families = append(families, metricFamily{name: metricsPrefix + prefix + "_directories", help: "Directories " + what + ", itself included.", typ: "gauge"})
+	}
+	for i, k := range keys {
+		u := counts[i]
+		families[0].add(float64(u.files), label, k)
+		families[1].add(float64(u.bytes), label, k)
+		families[2].add(float64(u.rawBytes), label, k)
+		families[3].add(float64(u.smallFiles), label, k)
+		if len(families) > 4 {
+			families[4].add(float64(u.dirs), label, k)
+		}
+	}
+	return families
+}
+
+// quotaFamilies returns the limits and usage of the limit quota
+// directories closest to (or furthest over) their limits, and counts
+// over all of them.
+func quotaFamilies(quotas map[string]*quotaUsage, limit int) []metricFamily {
+	list := make([]*quotaUsage, 0, len(quotas))
+	over := 0
+	for _, q := range quotas {
+		list = append(list, q)
+		if q.ratio() > 1 {
+			over++
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if a, b := list[i].ratio(), list[j].ratio(); a != b {
+			return a > b
+		}
+		return list[i].path < list[j].path
+	})
+	if limit > 0 && len(list) > limit {
+		debugf("%d quota directories without series", len(list)-limit)
+		list = list[:limit]
+	}
+
+	count := metricFamily{name: metricsPrefix + "quota_directories", help: "Directories with a quota.", typ: "gauge"}
+	count.add(float64(len(quotas)))
+	overCount := metricFamily{name: metricsPrefix + "quota_directories_over", help: "Directories using more than one of their quotas.", typ: "gauge"}
+	overCount.add(float64(over))
+	nsLimit := metricFamily{name: metricsPrefix + "quota_namespace_limit", help: "Namespace quota of the directory.", typ: "gauge"}
+	nsUsed := metricFamily{name: metricsPrefix + "quota_namespace_used", help: "Files, directories and symlinks counted against the namespace quota.", typ: "gauge"}
+	dsLimit := metricFamily{name: metricsPrefix + "quota_space_limit_bytes", help: "Space quota of the directory.", typ: "gauge"}
+	dsUsed := metricFamily{name: metricsPrefix + "quota_space_used_bytes", help: "Replicated size, with parity for striped files, counted against the space quota.", typ: "gauge"}
+	typeLimit := metricFamily{name: metricsPrefix + "quota_storage_type_limit_bytes", help: "Storage type quota of the directory.", typ: "gauge"}
+	typeUsed := metricFamily{name: metricsPrefix + "quota_storage_type_used_bytes", help: "Space on the storage type counted against its quota.", typ: "gauge"}
+	for _, q := range list {
+		if q.nsQuota >= 0 {
+			nsLimit.add(float64(q.nsQuota), "path", q.path)
+		}
+		nsUsed.add(float64(q.nsUsed), "path", q.path)
+		if q.dsQuota >= 0 {
+			dsLimit.add(float64(q.dsQuota), "path", q.path)
+		}
+		dsUsed.add(float64(q.spaceUsed), "path", q.path)
+		for _, t := range q.typeQuotas {
+			typeLimit.add(float64(t.GetQuota()), "path", q.path, "storage_type", t.GetStorageType().String())
+			typeUsed.add(float64(q.typeUsed[t.GetStorageType()]), "path", q.path, "storage_type", t.GetStorageType().String())
+		}
+	}
+	return []metricFamily{count, overCount, nsLimit, nsUsed, dsLimit, dsUsed, typeLimit, typeUsed}
+}
+
+// writeMetrics writes families in the Prometheus text format, or in
+// OpenMetrics, which differs in the info type and the closing # EOF.
+func writeMetrics(w io.Writer, families []metricFamily, openMetrics bool) error {
+	var buf bytes.Buffer
+	for _, f := range families {
+		if len(f.samples) == 0 {
+			continue
+		}
+		// OpenMetrics names info and counter families without the
+		// suffix their samples carry, the text format has no info type
+		name, typ, sampleName := f.name, f.typ, f.name
+		switch f.typ {
+		case "info":
+			sampleName += "_info"
+		case "counter":
+			sampleName += "_total"
+		}
+		if !openMetrics {
+			name = sampleName
+			if typ == "info" {
+				typ = "gauge"
+			}
+		}
+		fmt.Fprintf(&buf, "# HELP %s %s\n# TYPE %s %s\n", name, escapeMetricText(f.help, false), name, typ)
+		name = sampleName
+		for _, s := range f.samples {
+			buf.WriteString(name + s.suffix)
+			if len(s.labels) > 0 {
+				buf.WriteByte('{')
+				for i := 0; i < len(s.labels); i += 2 {
+					if i > 0 {
+						buf.WriteByte(',')
+					}
+					fmt.Fprintf(&buf, "%s=\"%s\"", s.labels[i], escapeMetricText(s.labels[i+1], true))
+				}
+				buf.WriteByte('}')
+			}
+			buf.WriteByte(' ')
+			buf.WriteString(formatMetricValue(s.value))
+			buf.WriteByte('\n')
+		}
+	}
+	if openMetrics {
+		buf.WriteString("# EOF\n")
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// escapeMetricText escapes backslashes and newlines, and in label values
+// double quotes.
+func escapeMetricText(s string, quoted bool) string {
+	r := strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	if quoted {
+		r = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+	}
+	return r.Replace(s)
+}
+
+// formatMetricValue prints integral values without an exponent.
+func formatMetricValue(v float64) string {
+	if v == math.Trunc(v) && math.Abs(v) < 1e15 {
+		return strconv.FormatInt(int64(v), 10)
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// metricsHandler serves the latest metrics on /metrics. OpenMetrics is
+// served to scrapers that ask for it in Accept.
+type metricsHandler struct {
+	mu      sync.RWMutex
+	metrics *ImageMetrics
+}
+
+func (h *metricsHandler) set(m *ImageMetrics) {
+	h.mu.Lock()
+	h.metrics = m
+	h.mu.Unlock()
+}
+
+func (h *metricsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mu.RLock()
+	m := h.metrics
+	h.mu.RUnlock()
+	if m == nil {
+		http.Error(w, "no image loaded yet", http.StatusServiceUnavailable)
+		return
+	}
+	openMetrics := strings.Contains(r.Header.Get("Accept"), "application/openmetrics-text")
+	if openMetrics {
+		w.Header().Set("Content-Type", "application/openmetrics-text; version=1.0.0; charset=utf-8")
+	} else {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	}
+	if err := writeMetrics(w, m.Families, openMetrics); err != nil {
+		debugf("%s: %v", r.RemoteAddr, err)
+	}
+}
+
+// writeMetricsFile replaces path with the metrics through a rename, so
+// node_exporter's textfile collector never reads a partial file.
+func writeMetricsFile(name string, m *ImageMetrics) error {
+	tmp, err := os.CreateTemp(filepath.Dir(name), "."+filepath.Base(name)+".*")
+	if err != nil {
+		return err
+	}
+	err = writeMetrics(tmp, m.Families, false)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), 0o644)
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), name)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
+
+// loadImageMetrics loads an image and computes its metrics.
+func loadImageMetrics(fileName string, opts MetricsOptions) (*ImageMetrics, error) {
+	u, err := loadImageUsage(fileName, opts.Depth, opts.SmallFileSize)
+	if err != nil {
+		return nil, err
+	}
+	return collectMetrics(u, opts), nil
+}
+
+// runMetrics implements the `metrics` subcommand: namespace gauges for
+// Prometheus, written once or served on /metrics.
+func runMetrics(args []string) {
+	fs := flag.NewFlagSet("metrics", flag.ExitOnError)
+	output := fs.String("o", "", "write a textfile collector .prom file instead of stdout")
+	listen := fs.String("listen", "", "serve the metrics on http://<addr>/metrics, e.g. :9799")
+	var opts MetricsOptions
+	registerMetricsFlags(fs, &opts)
+	registerParseFlags(fs)
+	registerLogFlags(fs)
+	fs.Usage = commandUsage(fs, "[flags] <fsimage>",
+		"Without -o or -listen the metrics are printed in the Prometheus text format.")
+	parseArgs(fs, args, 1)
+
+	m, err := loadImageMetrics(fs.Arg(0), opts)
+	logIfErr(err)
+	if *output != "" {
+		logIfErr(writeMetricsFile(*output, m))
+		infof("wrote %s", *output)
+	}
+	switch {
+	case *listen != "":
+		h := &metricsHandler{}
+		h.set(m)
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", h)
+		infof("serving metrics of %s on %s/metrics", m.Image, *listen)
+		log.Fatal(http.ListenAndServe(*listen, mux))
+	case *output == "":
+		logIfErr(writeMetrics(os.Stdout, m.Families, false))
+	}
+}
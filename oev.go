@@ -0,0 +1,1301 @@
+package main
+
+import (
+	"bufio"
+	"cmp"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	hd "hdfs-fsimage-parse-go/pkg/hadoop_hdfs"
+)
+
+// rpcInvalidCallId is RpcConstants.INVALID_CALL_ID, logged by ops
+// that did not come from a client call.
+const rpcInvalidCallId = -2
+
+// renameOptionNames are the Options.Rename values by code.
+var renameOptionNames = []string{"NONE", "OVERWRITE", "TO_TRASH"}
+
+// xmlNode is an element of OfflineEditsViewer XML, kept generic so ops
+// can bind their fields to it by element name in either direction.
+type xmlNode struct {
+	XMLName xml.Name
+	Value   string    `xml:",chardata"`
+	Nodes   []xmlNode `xml:",any"`
+}
+
+// xmlEditRecord is a RECORD of OfflineEditsViewer XML.
+type xmlEditRecord struct {
+	XMLName xml.Name `xml:"RECORD"`
+	Opcode  string   `xml:"OPCODE"`
+	Data    xmlNode  `xml:"DATA"`
+}
+
+// editXML binds op fields to the children of an element, as the toXml
+// and fromXml methods of FSEditLogOp do. Writing, every call appends an
+// element; reading, it parses the element with that name into the
+// field. A missing element is an error unless the op checks for it
+// with want first. The first error sticks.
+type editXML struct {
+	node    *xmlNode
+	reading bool
+	err     error
+}
+
+func (x *editXML) fail(err error) {
+	if x.err == nil {
+		x.err = err
+	}
+}
+
+func (x *editXML) find(name string) *xmlNode {
+	for i := range x.node.Nodes {
+		if x.node.Nodes[i].XMLName.Local == name {
+			return &x.node.Nodes[i]
+		}
+	}
+	return nil
+}
+
+func (x *editXML) count(name string) int {
+	n := 0
+	for i := range x.node.Nodes {
+		if x.node.Nodes[i].XMLName.Local == name {
+			n++
+		}
+	}
+	return n
+}
+
+// want reports whether an optional element is there: writing, whether
+// the field is set, reading, whether the element is present.
+func (x *editXML) want(name string, set bool) bool {
+	if !x.reading {
+		return set
+	}
+	return x.find(name) != nil
+}
+
+// value writes s as the text of a new element, or returns the text of
+// the element when reading.
+func (x *editXML) value(name, s string) (string, bool) {
+	if !x.reading {
+		x.node.Nodes = append(x.node.Nodes, xmlNode{XMLName: xml.Name{Local: name}, Value: mangleXML(s)})
+		return s, true
+	}
+	n := x.find(name)
+	if n == nil {
+		x.fail(fmt.Errorf("missing <%s>", name))
+		return "", false
+	}
+	s, err := unmangleXML(n.Value)
+	if err != nil {
+		x.fail(fmt.Errorf("<%s>: %w", name, err))
+		return "", false
+	}
+	return s, true
+}
+
+func (x *editXML) str(name string, v *string) {
+	if s, ok := x.value(name, *v); ok && x.reading {
+		*v = s
+	}
+}
+
+// optStr binds an optional string, nil when absent.
+func (x *editXML) optStr(name string, v **string) {
+	if !x.want(name, *v != nil) {
+		return
+	}
+	if x.reading {
+		*v = new(string)
+	}
+	x.str(name, *v)
+}
+
+// bool parses like Boolean.parseBoolean: anything but "true" is false.
+func (x *editXML) bool(name string, v *bool) {
+	if s, ok := x.value(name, strconv.FormatBool(*v)); ok && x.reading {
+		*v = strings.EqualFold(s, "true")
+	}
+}
+
+// bytes binds a byte string in the encoding of XAttrCodec: "0x" and
+// hex when writing; hex, "0s" and base64, or quoted text when reading.
+func (x *editXML) bytes(name string, v *[]byte) {
+	s, ok := x.value(name, "0x"+hex.EncodeToString(*v))
+	if !ok || !x.reading {
+		return
+	}
+	b, err := decodeXAttrValue(s)
+	if err != nil {
+		x.fail(fmt.Errorf("<%s>: %w", name, err))
+		return
+	}
+	*v = b
+}
+
+func decodeXAttrValue(s string) ([]byte, error) {
+	switch {
+	case len(s) >= 2 && s[0] == '0' && (s[1] == 'x' || s[1] == 'X'):
+		return hex.DecodeString(s[2:])
+	case len(s) >= 2 && s[0] == '0' && (s[1] == 's' || s[1] == 'S'):
+		return base64.StdEncoding.DecodeString(s[2:])
+	case len(s) >= 2 && s[0] == '"' && s[len(s)-1] == '"':
+		return []byte(s[1 : len(s)-1]), nil
+	}
+	return []byte(s), nil
+}
+
+// length writes the LENGTH element FSEditLogOp still prints for ops
+// that had one before op lengths were framed; it is ignored when read.
+func (x *editXML) length() {
+	if !x.reading {
+		x.value("LENGTH", "0")
+	}
+}
+
+type xmlInteger interface {
+	~int8 | ~int16 | ~int32 | ~int64 | ~uint16 | ~uint32
+}
+
+func xmlNumber[T xmlInteger](x *editXML, name string, v *T) {
+	s, ok := x.value(name, strconv.FormatInt(int64(*v), 10))
+	if !ok || !x.reading {
+		return
+	}
+	n, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+	if err == nil && int64(T(n)) != n {
+		err = fmt.Errorf("%d is out of range", n)
+	}
+	if err != nil {
+		x.fail(fmt.Errorf("<%s>: %w", name, err))
+		return
+	}
+	*v = T(n)
+}
+
+// xmlOptNumber binds an optional number, nil when absent.
+func xmlOptNumber[T xmlInteger](x *editXML, name string, v **T) {
+	if !x.want(name, *v != nil) {
+		return
+	}
+	if x.reading {
+		*v = new(T)
+	}
+	xmlNumber(x, name, *v)
+}
+
+type protoEnum interface {
+	~int32
+	String() string
+}
+
+// xmlEnum binds a protobuf enum by its value name, which matches the
+// Java enum constant for the ACL and xattr enums.
+func xmlEnum[T protoEnum](x *editXML, name string, v **T, values map[string]int32) {
+	var s string
+	if *v != nil {
+		s = (**v).String()
+	}
+	s, ok := x.value(name, s)
+	if !ok || !x.reading {
+		return
+	}
+	n, found := values[s]
+	if !found {
+		x.fail(fmt.Errorf("<%s>: unknown value %q", name, s))
+		return
+	}
+	e := T(n)
+	*v = &e
+}
+
+// each binds n elements named name, or when reading every element with
+// that name, calling fn with each in turn as the current node.
+func (x *editXML) each(name string, n int, fn func(i int)) {
+	parent := x.node
+	defer func() { x.node = parent }()
+	if !x.reading {
+		for i := range n {
+			parent.Nodes = append(parent.Nodes, xmlNode{XMLName: xml.Name{Local: name}})
+			x.node = &parent.Nodes[len(parent.Nodes)-1]
+			fn(i)
+		}
+		return
+	}
+	i := 0
+	for j := range parent.Nodes {
+		if parent.Nodes[j].XMLName.Local == name {
+			x.node = &parent.Nodes[j]
+			fn(i)
+			i++
+		}
+	}
+}
+
+// group binds the children of a single required element.
+func (x *editXML) group(name string, fn func()) {
+	if x.reading && x.find(name) == nil {
+		x.fail(fmt.Errorf("missing <%s>", name))
+		return
+	}
+	x.each(name, 1, func(int) { fn() })
+}
+
+func (x *editXML) blocks(v *[]EditBlock) {
+	if x.reading {
+		*v = make([]EditBlock, x.count("BLOCK"))
+	}
+	x.each("BLOCK", len(*v), func(i int) {
+		b := &(*v)[i]
+		xmlNumber(x, "BLOCK_ID", &b.Id)
+		xmlNumber(x, "NUM_BYTES", &b.NumBytes)
+		xmlNumber(x, "GENSTAMP", &b.GenStamp)
+	})
+}
+
+func (x *editXML) permission(v **EditPermission) {
+	if x.reading {
+		*v = &EditPermission{}
+	}
+	p := *v
+	if p == nil {
+		p = &EditPermission{}
+	}
+	x.group("PERMISSION_STATUS", func() {
+		x.str("USERNAME", &p.User)
+		x.str("GROUPNAME", &p.Group)
+		xmlNumber(x, "MODE", &p.Mode)
+	})
+}
+
+// acl binds the ENTRY elements of appendAclEntriesToXml; PERM is the
+// FsAction symbol, e.g. "r-x".
+func (x *editXML) acl(v *[]*hd.AclEntryProto) {
+	if x.reading {
+		*v = make([]*hd.AclEntryProto, x.count("ENTRY"))
+		for i := range *v {
+			(*v)[i] = &hd.AclEntryProto{}
+		}
+	}
+	x.each("ENTRY", len(*v), func(i int) {
+		e := (*v)[i]
+		xmlEnum(x, "SCOPE", &e.Scope, hd.AclEntryProto_AclEntryScopeProto_value)
+		xmlEnum(x, "TYPE", &e.Type, hd.AclEntryProto_AclEntryTypeProto_value)
+		x.optStr("NAME", &e.Name)
+		perm := formatPermissionBits(uint16(e.GetPermissions()))[6:]
+		x.str("PERM", &perm)
+		if !x.reading {
+			return
+		}
+		action, err := parseFsAction(perm)
+		if err != nil {
+			x.fail(fmt.Errorf("<PERM>: %w", err))
+			return
+		}
+		e.Permissions = action.Enum()
+	})
+}
+
+func parseFsAction(s string) (hd.AclEntryProto_FsActionProto, error) {
+	if len(s) != 3 {
+		return 0, fmt.Errorf("invalid permission %q", s)
+	}
+	var action hd.AclEntryProto_FsActionProto
+	for i, c := range []byte(s) {
+		switch {
+		case c == "rwx"[i]:
+			action |= 4 >> i
+		case c != '-':
+			return 0, fmt.Errorf("invalid permission %q", s)
+		}
+	}
+	return action, nil
+}
+
+func (x *editXML) xattrs(v *[]*hd.XAttrProto) {
+	if x.reading {
+		*v = make([]*hd.XAttrProto, x.count("XATTR"))
+		for i := range *v {
+			(*v)[i] = &hd.XAttrProto{}
+		}
+	}
+	x.each("XATTR", len(*v), func(i int) {
+		a := (*v)[i]
+		xmlEnum(x, "NAMESPACE", &a.Namespace, hd.XAttrProto_XAttrNamespaceProto_value)
+		name := a.GetName()
+		x.str("NAME", &name)
+		if x.reading {
+			a.Name = &name
+		}
+		if x.want("VALUE", a.Value != nil) {
+			x.bytes("VALUE", &a.Value)
+		}
+	})
+}
+
+// rpcIds binds RPC_CLIENTID and RPC_CALLID; without them the op gets
+// the ids of a call that did not come from a client.
+func (x *editXML) rpcIds(op *EditOp) {
+	if !x.want("RPC_CLIENTID", true) {
+		op.RpcClientId, op.RpcCallId = nil, rpcInvalidCallId
+		return
+	}
+	id := formatClientId(op.RpcClientId)
+	x.str("RPC_CLIENTID", &id)
+	if x.reading {
+		b, err := hex.DecodeString(strings.ReplaceAll(id, "-", ""))
+		if err != nil {
+			x.fail(fmt.Errorf("<RPC_CLIENTID>: %w", err))
+		}
+		op.RpcClientId = b
+	}
+	if x.want("RPC_CALLID", true) {
+		xmlNumber(x, "RPC_CALLID", &op.RpcCallId)
+	} else {
+		op.RpcCallId = rpcInvalidCallId
+	}
+}
+
+// formatClientId prints an RPC client id as ClientId.toString does, as
+// a UUID; ids of another length are printed in hex.
+func formatClientId(id []byte) string {
+	h := hex.EncodeToString(id)
+	if len(id) != 16 {
+		return h
+	}
+	return h[:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:]
+}
+
+func (x *editXML) token(v **EditToken) {
+	if x.reading {
+		*v = &EditToken{}
+	}
+	t := *v
+	if t == nil {
+		t = &EditToken{}
+	}
+	x.group("DELEGATION_TOKEN_IDENTIFIER", func() {
+		kind := "HDFS_DELEGATION_TOKEN"
+		x.str("KIND", &kind)
+		xmlNumber(x, "SEQUENCE_NUMBER", &t.SequenceNumber)
+		x.str("OWNER", &t.Owner)
+		x.str("RENEWER", &t.Renewer)
+		x.str("REALUSER", &t.RealUser)
+		xmlNumber(x, "ISSUE_DATE", &t.IssueDate)
+		xmlNumber(x, "MAX_DATE", &t.MaxDate)
+		xmlNumber(x, "MASTER_KEY_ID", &t.MasterKeyId)
+	})
+}
+
+func (x *editXML) key(v **EditKey) {
+	if x.reading {
+		*v = &EditKey{}
+	}
+	k := *v
+	if k == nil {
+		k = &EditKey{}
+	}
+	x.group("DELEGATION_KEY", func() {
+		xmlNumber(x, "KEY_ID", &k.Id)
+		xmlNumber(x, "EXPIRY_DATE", &k.ExpiryDate)
+		if !x.want("KEY", k.Key != nil) {
+			return
+		}
+		s := hex.EncodeToString(k.Key)
+		x.str("KEY", &s)
+		if x.reading {
+			b, err := hex.DecodeString(s)
+			if err != nil {
+				x.fail(fmt.Errorf("<KEY>: %w", err))
+			}
+			k.Key = b
+		}
+	})
+}
+
+// directive binds the elements of writeCacheDirectiveInfo, written
+// into DATA itself. Only the id is required.
+func (x *editXML) directive(v **hd.CacheDirectiveInfoProto) {
+	if x.reading {
+		*v = &hd.CacheDirectiveInfoProto{}
+	}
+	d := *v
+	id := d.GetId()
+	xmlNumber(x, "ID", &id)
+	if x.reading {
+		d.Id = &id
+	}
+	x.optStr("PATH", &d.Path)
+	xmlOptNumber(x, "REPLICATION", &d.Replication)
+	x.optStr("POOL", &d.Pool)
+	if x.want("EXPIRATION", d.Expiration != nil) {
+		millis := d.GetExpiration().GetMillis()
+		xmlNumber(x, "EXPIRATION", &millis)
+		if x.reading {
+			d.Expiration = &hd.CacheDirectiveInfoExpirationProto{Millis: &millis, IsRelative: new(bool)}
+		}
+	}
+}
+
+// pool binds the elements of writeCachePoolInfo, written into DATA
+// itself. Only the name is required.
+func (x *editXML) pool(v **hd.CachePoolInfoProto) {
+	if x.reading {
+		*v = &hd.CachePoolInfoProto{}
+	}
+	p := *v
+	name := p.GetPoolName()
+	x.str("POOLNAME", &name)
+	if x.reading {
+		p.PoolName = &name
+	}
+	x.optStr("OWNERNAME", &p.OwnerName)
+	x.optStr("GROUPNAME", &p.GroupName)
+	xmlOptNumber(x, "MODE", &p.Mode)
+	xmlOptNumber(x, "LIMIT", &p.Limit)
+	xmlOptNumber(x, "MAXRELATIVEEXPIRY", &p.MaxRelativeExpiry)
+	xmlOptNumber(x, "DEFAULTREPLICATION", &p.DefaultReplication)
+}
+
+// bindXML binds the fields of op to the elements of its DATA under the
+// names its FSEditLogOp subclass uses. Elements a layout version does
+// not have are only written for versions that have them.
+func (op *EditOp) bindXML(x *editXML, version int32) {
+	switch op.Code {
+	case opAdd, opClose:
+		x.length()
+		xmlNumber(x, "INODEID", &op.InodeId)
+		x.str("PATH", &op.Path)
+		xmlNumber(x, "REPLICATION", &op.Replication)
+		xmlNumber(x, "MTIME", &op.Mtime)
+		xmlNumber(x, "ATIME", &op.Atime)
+		xmlNumber(x, "BLOCKSIZE", &op.BlockSize)
+		x.str("CLIENT_NAME", &op.ClientName)
+		x.str("CLIENT_MACHINE", &op.ClientMachine)
+		if x.want("OVERWRITE", true) {
+			x.bool("OVERWRITE", &op.Overwrite)
+		}
+		if x.want("STORAGE_POLICY_ID", op.Code == opAdd && version <= layoutBlockStoragePolicy) {
+			xmlNumber(x, "STORAGE_POLICY_ID", &op.StoragePolicy)
+		}
+		if x.want("ERASURE_CODING_POLICY_ID", op.Code == opAdd && version <= layoutErasureCoding) {
+			xmlNumber(x, "ERASURE_CODING_POLICY_ID", &op.ECPolicy)
+		}
+		x.blocks(&op.Blocks)
+		x.permission(&op.Permissions)
+		if op.Code == opAdd {
+			x.acl(&op.Acl)
+			x.xattrs(&op.XAttrs)
+			x.rpcIds(op)
+		}
+	case opMkdir:
+		x.length()
+		xmlNumber(x, "INODEID", &op.InodeId)
+		x.str("PATH", &op.Path)
+		xmlNumber(x, "TIMESTAMP", &op.Mtime)
+		if x.reading {
+			// the atime logged is the timestamp again
+			op.Atime = op.Mtime
+		}
+		x.permission(&op.Permissions)
+		x.acl(&op.Acl)
+		x.xattrs(&op.XAttrs)
+	case opSymlink:
+		x.length()
+		xmlNumber(x, "INODEID", &op.InodeId)
+		x.str("PATH", &op.Path)
+		x.str("VALUE", &op.Dst)
+		xmlNumber(x, "MTIME", &op.Mtime)
+		xmlNumber(x, "ATIME", &op.Atime)
+		x.permission(&op.Permissions)
+		x.rpcIds(op)
+	case opDelete:
+		x.length()
+		x.str("PATH", &op.Path)
+		xmlNumber(x, "TIMESTAMP", &op.Mtime)
+		x.rpcIds(op)
+	case opRenameOld, opRename:
+		x.length()
+		x.str("SRC", &op.Path)
+		x.str("DST", &op.Dst)
+		xmlNumber(x, "TIMESTAMP", &op.Mtime)
+		if op.Code == opRename {
+			options := formatRenameOptions(op.RenameOptions)
+			x.str("OPTIONS", &options)
+			if x.reading {
+				b, err := parseRenameOptions(options)
+				if err != nil {
+					x.fail(fmt.Errorf("<OPTIONS>: %w", err))
+				}
+				op.RenameOptions = b
+			}
+		}
+		x.rpcIds(op)
+	case opConcatDelete:
+		x.length()
+		x.str("TRG", &op.Path)
+		xmlNumber(x, "TIMESTAMP", &op.Mtime)
+		x.group("SOURCES", func() {
+			if x.reading {
+				op.Srcs = nil
+				for i := 1; x.find(fmt.Sprintf("SOURCE%d", i)) != nil; i++ {
+					op.Srcs = append(op.Srcs, "")
+				}
+			}
+			for i := range op.Srcs {
+				x.str(fmt.Sprintf("SOURCE%d", i+1), &op.Srcs[i])
+			}
+		})
+		x.rpcIds(op)
+	case opSetReplication:
+		x.str("PATH", &op.Path)
+		xmlNumber(x, "REPLICATION", &op.Replication)
+	case opSetPermissions:
+		x.str("SRC", &op.Path)
+		xmlNumber(x, "MODE", &op.Mode)
+	case opSetOwner:
+		x.str("SRC", &op.Path)
+		if x.want("USERNAME", op.User != "") {
+			x.str("USERNAME", &op.User)
+		}
+		if x.want("GROUPNAME", op.Group != "") {
+			x.str("GROUPNAME", &op.Group)
+		}
+	case opTimes:
+		x.length()
+		x.str("PATH", &op.Path)
+		xmlNumber(x, "MTIME", &op.Mtime)
+		xmlNumber(x, "ATIME", &op.Atime)
+	case opSetNSQuota:
+		x.str("SRC", &op.Path)
+		xmlNumber(x, "NSQUOTA", &op.NsQuota)
+	case opClearNSQuota:
+		x.str("SRC", &op.Path)
+	case opSetQuota:
+		x.str("SRC", &op.Path)
+		xmlNumber(x, "NSQUOTA", &op.NsQuota)
+		xmlNumber(x, "DSQUOTA", &op.DsQuota)
+	case opSetQuotaByStorageType:
+		x.str("SRC", &op.Path)
+		types := storageTypes(version)
+		i := int32(slices.Index(types, op.StorageType))
+		xmlNumber(x, "STORAGETYPE", &i)
+		if x.reading {
+			if i < 0 || int(i) >= len(types) {
+				x.fail(fmt.Errorf("<STORAGETYPE>: unknown storage type %d", i))
+			} else {
+				op.StorageType = types[i]
+			}
+		}
+		xmlNumber(x, "DSQUOTA", &op.DsQuota)
+	case opReassignLease:
+		x.str("LEASEHOLDER", &op.LeaseHolder)
+		x.str("PATH", &op.Path)
+		x.str("NEWHOLDER", &op.ClientName)
+	case opAddBlock, opUpdateBlocks:
+		x.str("PATH", &op.Path)
+		x.blocks(&op.Blocks)
+		x.rpcIds(op)
+	case opTruncate:
+		x.str("SRC", &op.Path)
+		x.str("CLIENTNAME", &op.ClientName)
+		x.str("CLIENTMACHINE", &op.ClientMachine)
+		xmlNumber(x, "NEWLENGTH", &op.NewLength)
+		xmlNumber(x, "TIMESTAMP", &op.Mtime)
+		x.blocks(&op.Blocks)
+	case opAppend:
+		x.str("PATH", &op.Path)
+		x.str("CLIENT_NAME", &op.ClientName)
+		x.str("CLIENT_MACHINE", &op.ClientMachine)
+		x.bool("NEWBLOCK", &op.NewBlock)
+		x.rpcIds(op)
+	case opSetStoragePolicy:
+		x.str("PATH", &op.Path)
+		xmlNumber(x, "POLICYID", &op.StoragePolicy)
+	case opSetAcl:
+		x.str("SRC", &op.Path)
+		x.acl(&op.Acl)
+	case opSetXAttr, opRemoveXAttr:
+		x.str("SRC", &op.Path)
+		x.xattrs(&op.XAttrs)
+		x.rpcIds(op)
+	case opAllowSnapshot, opDisallowSnapshot:
+		x.str("SNAPSHOTROOT", &op.Path)
+	case opCreateSnapshot, opDeleteSnapshot, opRenameSnapshot:
+		x.str("SNAPSHOTROOT", &op.Path)
+		if op.Code == opRenameSnapshot {
+			x.str("SNAPSHOTOLDNAME", &op.SnapshotName)
+			x.str("SNAPSHOTNEWNAME", &op.NewName)
+		} else {
+			x.str("SNAPSHOTNAME", &op.SnapshotName)
+		}
+		if x.want("MTIME", version <= layoutSnapshotModificationTime) {
+			xmlNumber(x, "MTIME", &op.Mtime)
+		}
+		x.rpcIds(op)
+	case opSetGenstampV1:
+		xmlNumber(x, "GENSTAMP", &op.Value)
+	case opSetGenstampV2:
+		xmlNumber(x, "GENSTAMPV2", &op.Value)
+	case opAllocateBlockId:
+		xmlNumber(x, "BLOCK_ID", &op.Value)
+	case opRollingUpgradeStart:
+		xmlNumber(x, "STARTTIME", &op.Value)
+	case opRollingUpgradeFinalize:
+		xmlNumber(x, "FINALIZETIME", &op.Value)
+	case opGetDelegationToken, opRenewDelegationToken:
+		x.token(&op.Token)
+		xmlNumber(x, "EXPIRY_TIME", &op.Value)
+	case opCancelDelegationToken:
+		x.token(&op.Token)
+	case opUpdateMasterKey:
+		x.key(&op.Key)
+	case opAddCacheDirective, opModifyCacheDirective:
+		x.directive(&op.Directive)
+		x.rpcIds(op)
+	case opRemoveCacheDirective:
+		if x.reading {
+			op.Directive = &hd.CacheDirectiveInfoProto{}
+		}
+		id := op.Directive.GetId()
+		xmlNumber(x, "ID", &id)
+		if x.reading {
+			op.Directive.Id = &id
+		}
+		x.rpcIds(op)
+	case opAddCachePool, opModifyCachePool:
+		x.pool(&op.Pool)
+		x.rpcIds(op)
+	case opRemoveCachePool:
+		if x.reading {
+			op.Pool = &hd.CachePoolInfoProto{}
+		}
+		name := op.Pool.GetPoolName()
+		x.str("POOLNAME", &name)
+		if x.reading {
+			op.Pool.PoolName = &name
+		}
+		x.rpcIds(op)
+	case opEnableErasureCodingPolicy, opDisableErasureCodingPolicy, opRemoveErasureCodingPolicy:
+		x.str("POLICYNAME", &op.PolicyName)
+		x.rpcIds(op)
+	case opStartLogSegment, opEndLogSegment:
+	default:
+		// not decoded, kept as is; Hadoop cannot read this back
+		x.bytes("BODY", &op.Body)
+	}
+}
+
+func formatRenameOptions(options []byte) string {
+	names := make([]string, len(options))
+	for i, o := range options {
+		if int(o) < len(renameOptionNames) {
+			names[i] = renameOptionNames[o]
+		} else {
+			names[i] = strconv.Itoa(int(o))
+		}
+	}
+	return strings.Join(names, "|")
+}
+
+func parseRenameOptions(s string) ([]byte, error) {
+	if s == "" {
+		return nil, nil
+	}
+	var options []byte
+	for _, name := range strings.Split(s, "|") {
+		if i := slices.Index(renameOptionNames, name); i >= 0 {
+			options = append(options, byte(i))
+		} else if n, err := strconv.ParseUint(name, 10, 8); err == nil {
+			options = append(options, byte(n))
+		} else {
+			return nil, fmt.Errorf("unknown rename option %q", name)
+		}
+	}
+	return options, nil
+}
+
+// mangleXML escapes what XML 1.0 cannot carry, and the backslash used
+// for it, as XMLUtils.mangleXmlString does: "\" + hex code point + ";".
+func mangleXML(s string) string {
+	if !strings.ContainsFunc(s, mustMangle) {
+		return s
+	}
+	var b strings.Builder
+	for _, c := range s {
+		if mustMangle(c) {
+			fmt.Fprintf(&b, "\\%x;", c)
+		} else {
+			b.WriteRune(c)
+		}
+	}
+	return b.String()
+}
+
+func mustMangle(c rune) bool {
+	return c == '\\' || (c < 0x20 && c != '\t' && c != '\n' && c != '\r') ||
+		(c >= 0xd800 && c <= 0xdfff) || c == 0xfffe || c == 0xffff
+}
+
+func unmangleXML(s string) (string, error) {
+	if !strings.Contains(s, `\`) {
+		return s, nil
+	}
+	var b strings.Builder
+	for {
+		i := strings.IndexByte(s, '\\')
+		if i < 0 {
+			b.WriteString(s)
+			return b.String(), nil
+		}
+		b.WriteString(s[:i])
+		end := strings.IndexByte(s[i:], ';')
+		if end < 0 {
+			return "", fmt.Errorf("unterminated escape in %q", s)
+		}
+		c, err := strconv.ParseUint(s[i+1:i+end], 16, 32)
+		if err != nil {
+			return "", fmt.Errorf("invalid escape %q", s[i:i+end+1])
+		}
+		b.WriteRune(rune(c))
+		s = s[i+end+1:]
+	}
+}
+
+func parseEditOpCode(name string) (editOpCode, bool) {
+	for code, n := range editOpNames {
+		if n == name {
+			return code, true
+		}
+	}
+	if n, err := strconv.ParseInt(strings.TrimPrefix(name, "OP_"), 10, 8); err == nil {
+		return editOpCode(n), true
+	}
+	return 0, false
+}
+
+func newXMLEditRecord(op *EditOp, version int32) *xmlEditRecord {
+	rec := &xmlEditRecord{Opcode: op.Code.String()}
+	x := &editXML{node: &rec.Data}
+	xmlNumber(x, "TXID", &op.TxId)
+	op.bindXML(x, version)
+	return rec
+}
+
+func (rec *xmlEditRecord) op(version int32) (*EditOp, error) {
+	code, ok := parseEditOpCode(rec.Opcode)
+	if !ok {
+		return nil, fmt.Errorf("unknown opcode %q", rec.Opcode)
+	}
+	op := &EditOp{Code: code}
+	x := &editXML{node: &rec.Data, reading: true}
+	xmlNumber(x, "TXID", &op.TxId)
+	op.bindXML(x, version)
+	if x.err != nil {
+		return nil, fmt.Errorf("%s txid %d: %w", code, op.TxId, x.err)
+	}
+	return op, nil
+}
+
+// readEditsXML reads OfflineEditsViewer XML, calling start with the
+// EDITS_VERSION and fn with the op of every RECORD. Records that do not
+// bind are skipped and recorded in parseReport like corrupt ops; XML
+// that does not parse ends the file.
+func readEditsXML(fileName string, start func(version int32) error, fn func(op *EditOp) error) error {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	d := xml.NewDecoder(bufio.NewReaderSize(f, 1<<20))
+	section := filepath.Base(fileName)
+
+	var version int32
+	started := false
+	for index := 0; ; {
+		offset := d.InputOffset()
+		tok, err := d.Token()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return fmt.Errorf("%s: %w", fileName, err)
+		}
+		se, ok := tok.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		switch se.Name.Local {
+		case "EDITS":
+		case "EDITS_VERSION":
+			var s string
+			if err := d.DecodeElement(&s, &se); err != nil {
+				return fmt.Errorf("%s: %w", fileName, err)
+			}
+			v, err := strconv.ParseInt(strings.TrimSpace(s), 10, 32)
+			if err != nil {
+				return fmt.Errorf("%s: invalid EDITS_VERSION %q", fileName, s)
+			}
+			version, started = int32(v), true
+			if err := start(version); err != nil {
+				return err
+			}
+		case "RECORD":
+			if !started {
+				return fmt.Errorf("%s: RECORD before EDITS_VERSION", fileName)
+			}
+			var rec xmlEditRecord
+			if err := d.DecodeElement(&rec, &se); err != nil {
+				return fmt.Errorf("%s: %w", fileName, err)
+			}
+			op, err := rec.op(version)
+			index++
+			if err != nil {
+				if err := parseReport.add(&SectionError{Section: section, Offset: offset, Record: index - 1, Err: err}); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := fn(op); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("%s: unexpected element <%s>", fileName, se.Name.Local)
+		}
+	}
+	if !started {
+		return fmt.Errorf("%s: no EDITS_VERSION", fileName)
+	}
+	return nil
+}
+
+// readEditsBinary reads an edits segment like readEditLog, calling
+// start with its layout version first.
+func readEditsBinary(fileName string, start func(version int32) error, fn func(op *EditOp) error) error {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return err
+	}
+	version, err := readEditLogHeader(f, fileName)
+	f.Close()
+	if err != nil {
+		return err
+	}
+	if err := start(version); err != nil {
+		return err
+	}
+	_, err = readEditLog(fileName, fn)
+	return err
+}
+
+// editsProcessor is an output of `oev`.
+type editsProcessor interface {
+	start(version int32) error
+	op(op *EditOp) error
+	finish() error
+}
+
+type xmlEditsWriter struct {
+	out     io.Writer
+	enc     *xml.Encoder
+	version int32
+}
+
+func (w *xmlEditsWriter) start(version int32) error {
+	w.version = version
+	if _, err := io.WriteString(w.out, xml.Header); err != nil {
+		return err
+	}
+	w.enc = xml.NewEncoder(w.out)
+	w.enc.Indent("", "  ")
+	if err := w.enc.EncodeToken(xml.StartElement{Name: xml.Name{Local: "EDITS"}}); err != nil {
+		return err
+	}
+	return w.enc.EncodeElement(version, xml.StartElement{Name: xml.Name{Local: "EDITS_VERSION"}})
+}
+
+func (w *xmlEditsWriter) op(op *EditOp) error {
+	return w.enc.Encode(newXMLEditRecord(op, w.version))
+}
+
+func (w *xmlEditsWriter) finish() error {
+	if w.enc == nil {
+		return nil
+	}
+	if err := w.enc.EncodeToken(xml.EndElement{Name: xml.Name{Local: "EDITS"}}); err != nil {
+		return err
+	}
+	if err := w.enc.Flush(); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w.out, "\n")
+	return err
+}
+
+type binaryEditsWriter struct {
+	out io.Writer
+	w   *EditLogWriter
+}
+
+func (w *binaryEditsWriter) start(version int32) (err error) {
+	w.w, err = NewEditLogWriter(w.out, version)
+	return err
+}
+
+func (w *binaryEditsWriter) op(op *EditOp) error {
+	return w.w.WriteOp(op)
+}
+
+func (w *binaryEditsWriter) finish() error {
+	if w.w == nil {
+		return nil
+	}
+	return w.w.Flush()
+}
+
+// EditRecord is an op in the JSON Lines output of `oev`. Fields the op
+// does not have are left out; times are in milliseconds.
+type EditRecord struct {
+	TxId               int64       `json:"txid"`
+	Op                 string      `json:"op"`
+	InodeId            int64       `json:"inode_id,omitempty"`
+	Path               string      `json:"path,omitempty"`
+	Dst                string      `json:"dst,omitempty"`
+	Srcs               []string    `json:"srcs,omitempty"`
+	SnapshotName       string      `json:"snapshot_name,omitempty"`
+	NewName            string      `json:"new_name,omitempty"`
+	Replication        int16       `json:"replication,omitempty"`
+	Mtime              int64       `json:"mtime,omitempty"`
+	Atime              int64       `json:"atime,omitempty"`
+	BlockSize          int64       `json:"block_size,omitempty"`
+	Blocks             []EditBlock `json:"blocks,omitempty"`
+	User               string      `json:"user,omitempty"`
+	Group              string      `json:"group,omitempty"`
+	Permission         string      `json:"permission,omitempty"`
+	Acl                []AclEntry  `json:"acl,omitempty"`
+	XAttrs             []XAttr     `json:"xattrs,omitempty"`
+	ClientName         string      `json:"client_name,omitempty"`
+	ClientMachine      string      `json:"client_machine,omitempty"`
+	LeaseHolder        string      `json:"lease_holder,omitempty"`
+	Overwrite          bool        `json:"overwrite,omitempty"`
+	NewBlock           bool        `json:"new_block,omitempty"`
+	StoragePolicy      int8        `json:"storage_policy,omitempty"`
+	ECPolicy           int8        `json:"ec_policy,omitempty"`
+	NsQuota            *int64      `json:"ns_quota,omitempty"`
+	DsQuota            *int64      `json:"ds_quota,omitempty"`
+	StorageType        string      `json:"storage_type,omitempty"`
+	RenameOptions      string      `json:"rename_options,omitempty"`
+	NewLength          *int64      `json:"new_length,omitempty"`
+	GenStamp           int64       `json:"genstamp,omitempty"`
+	BlockId            int64       `json:"block_id,omitempty"`
+	Time               int64       `json:"time,omitempty"` // rolling upgrade start or finalize
+	Token              *EditToken  `json:"token,omitempty"`
+	ExpiryTime         int64       `json:"expiry_time,omitempty"`
+	KeyId              *int32      `json:"key_id,omitempty"`
+	KeyExpiryDate      int64       `json:"key_expiry_date,omitempty"`
+	DirectiveId        *int64      `json:"directive_id,omitempty"`
+	Pool               string      `json:"pool,omitempty"`
+	Expiration         *int64      `json:"expiration,omitempty"`
+	Limit              *int64      `json:"limit,omitempty"`
+	MaxRelativeExpiry  *int64      `json:"max_relative_expiry_ms,omitempty"`
+	DefaultReplication *uint32     `json:"default_replication,omitempty"`
+	PolicyName         string      `json:"policy_name,omitempty"`
+	RpcClientId        string      `json:"rpc_client_id,omitempty"`
+	RpcCallId          *int32      `json:"rpc_call_id,omitempty"`
+	Body               string      `json:"body,omitempty"` // hex, ops that are not decoded
+}
+
+// newEditRecord flattens op for JSON. Master key bytes are left out.
+func newEditRecord(op *EditOp) *EditRecord {
+	r := &EditRecord{
+		TxId: op.TxId, Op: op.Code.String(), InodeId: op.InodeId, Path: op.Path, Dst: op.Dst, Srcs: op.Srcs,
+		SnapshotName: op.SnapshotName, NewName: op.NewName, Replication: op.Replication, Mtime: op.Mtime,
+		Atime: op.Atime, BlockSize: op.BlockSize, Blocks: op.Blocks, User: op.User, Group: op.Group,
+		ClientName: op.ClientName, ClientMachine: op.ClientMachine, LeaseHolder: op.LeaseHolder,
+		Overwrite: op.Overwrite, NewBlock: op.NewBlock, StoragePolicy: op.StoragePolicy, ECPolicy: op.ECPolicy,
+		Token: op.Token, PolicyName: op.PolicyName,
+	}
+	if p := op.Permissions; p != nil {
+		r.User, r.Group, r.Permission = p.User, p.Group, formatPermissionBits(p.Mode)
+	}
+	for _, e := range op.Acl {
+		r.Acl = append(r.Acl, AclEntry{
+			Scope:      aclScopes[e.GetScope()],
+			Type:       aclTypes[e.GetType()],
+			Name:       e.GetName(),
+			Permission: formatPermissionBits(uint16(e.GetPermissions()))[6:],
+		})
+	}
+	for _, x := range op.XAttrs {
+		r.XAttrs = append(r.XAttrs, XAttr{Namespace: xattrNamespaces[x.GetNamespace()], Name: x.GetName(), Value: x.GetValue()})
+	}
+	switch op.Code {
+	case opSetPermissions:
+		r.Permission = formatPermissionBits(op.Mode)
+	case opSetNSQuota:
+		r.NsQuota = &op.NsQuota
+	case opSetQuota:
+		r.NsQuota, r.DsQuota = &op.NsQuota, &op.DsQuota
+	case opSetQuotaByStorageType:
+		r.DsQuota, r.StorageType = &op.DsQuota, op.StorageType.String()
+	case opRename:
+		r.RenameOptions = formatRenameOptions(op.RenameOptions)
+	case opTruncate:
+		r.NewLength = &op.NewLength
+	case opSetGenstampV1, opSetGenstampV2:
+		r.GenStamp = op.Value
+	case opAllocateBlockId:
+		r.BlockId = op.Value
+	case opRollingUpgradeStart, opRollingUpgradeFinalize:
+		r.Time = op.Value
+	case opGetDelegationToken, opRenewDelegationToken:
+		r.ExpiryTime = op.Value
+	case opUpdateMasterKey:
+		r.KeyId, r.KeyExpiryDate = &op.Key.Id, op.Key.ExpiryDate
+	}
+	if d := op.Directive; d != nil {
+		r.DirectiveId, r.Path, r.Pool = d.Id, d.GetPath(), d.GetPool()
+		r.Replication = int16(d.GetReplication())
+		if d.Expiration != nil {
+			r.Expiration = d.Expiration.Millis
+		}
+	}
+	if p := op.Pool; p != nil {
+		r.Pool, r.User, r.Group = p.GetPoolName(), p.GetOwnerName(), p.GetGroupName()
+		if p.Mode != nil {
+			r.Permission = formatPermissionBits(uint16(p.GetMode()))
+		}
+		r.Limit, r.MaxRelativeExpiry, r.DefaultReplication = p.Limit, p.MaxRelativeExpiry, p.DefaultReplication
+	}
+	if len(op.RpcClientId) > 0 {
+		r.RpcClientId, r.RpcCallId = formatClientId(op.RpcClientId), &op.RpcCallId
+	}
+	if op.Body != nil {
+		r.Body = hex.EncodeToString(op.Body)
+	}
+	return r
+}
+
+type jsonEditsWriter struct {
+	enc *json.Encoder
+}
+
+func (w *jsonEditsWriter) start(int32) error {
+	return nil
+}
+
+func (w *jsonEditsWriter) op(op *EditOp) error {
+	return w.enc.Encode(newEditRecord(op))
+}
+
+func (w *jsonEditsWriter) finish() error {
+	return nil
+}
+
+// editStats counts ops by opcode, user, client and path prefix. The
+// edit log records the user only where it sets an owner (OP_ADD,
+// OP_MKDIR, OP_SYMLINK) or issues a token, and the client name only for
+// writes; other ops are attributed through their RPC client id to the
+// user and client last seen with it, once the whole log is read.
+type editStats struct {
+	out     io.Writer
+	depth   int
+	top     int
+	version int32
+
+	first, last int64
+	ops         int
+	codes       map[editOpCode]int
+	users       map[string]int
+	clients     map[string]int
+	prefixes    map[string]int
+
+	// ops whose user or client is known only by their RPC client id
+	rpcUserOps   map[string]int
+	rpcClientOps map[string]int
+	rpcUsers     map[string]string
+	rpcClients   map[string]string
+}
+
+func newEditStats(out io.Writer, depth, top int) *editStats {
+	return &editStats{
+		out: out, depth: depth, top: top, first: -1,
+		codes: map[editOpCode]int{}, users: map[string]int{}, clients: map[string]int{}, prefixes: map[string]int{},
+		rpcUserOps: map[string]int{}, rpcClientOps: map[string]int{}, rpcUsers: map[string]string{}, rpcClients: map[string]string{},
+	}
+}
+
+func (s *editStats) start(version int32) error {
+	s.version = version
+	return nil
+}
+
+func (s *editStats) op(op *EditOp) error {
+	if s.first < 0 {
+		s.first = op.TxId
+	}
+	s.last = op.TxId
+	s.ops++
+	s.codes[op.Code]++
+
+	var user string
+	switch {
+	case op.Permissions != nil:
+		user = op.Permissions.User
+	case op.Token != nil:
+		user = op.Token.Owner
+	}
+	rpcId := ""
+	if len(op.RpcClientId) > 0 {
+		rpcId = formatClientId(op.RpcClientId)
+		if user != "" {
+			s.rpcUsers[rpcId] = user
+		}
+		if op.ClientName != "" {
+			s.rpcClients[rpcId] = op.ClientName
+		}
+	}
+	switch {
+	case user != "":
+		s.users[user]++
+	case rpcId != "":
+		s.rpcUserOps[rpcId]++
+	default:
+		s.users["-"]++
+	}
+	switch {
+	case op.ClientName != "":
+		s.clients[op.ClientName]++
+	case rpcId != "":
+		s.rpcClientOps[rpcId]++
+	default:
+		s.clients["-"]++
+	}
+
+	path := op.Path
+	if op.Directive != nil {
+		path = op.Directive.GetPath()
+	}
+	if path != "" {
+		s.prefixes[pathPrefix(path, s.depth)]++
+	}
+	return nil
+}
+
+// pathPrefix keeps the first depth components of p.
+func pathPrefix(p string, depth int) string {
+	parts := strings.Split(strings.Trim(p, "/"), "/")
+	if len(parts) > depth {
+		parts = parts[:depth]
+	}
+	return "/" + strings.Join(parts, "/")
+}
+
+func (s *editStats) finish() error {
+	for rpcId, n := range s.rpcUserOps {
+		s.users[cmp.Or(s.rpcUsers[rpcId], "-")] += n
+	}
+	for rpcId, n := range s.rpcClientOps {
+		s.clients[cmp.Or(s.rpcClients[rpcId], rpcId)] += n
+	}
+
+	w := tabwriter.NewWriter(s.out, 0, 8, 2, ' ', 0)
+	if s.ops == 0 {
+		fmt.Fprintf(w, "Edits version %d, no transactions\n", s.version)
+		return w.Flush()
+	}
+	fmt.Fprintf(w, "Edits version %d, transactions %d to %d, %d ops\n\n", s.version, s.first, s.last, s.ops)
+	fmt.Fprintf(w, "Op\tCode\tCount\n")
+	codes := make([]editOpCode, 0, len(s.codes))
+	for code := range s.codes {
+		codes = append(codes, code)
+	}
+	slices.Sort(codes)
+	for _, code := range codes {
+		fmt.Fprintf(w, "%s\t%d\t%d\n", code, code, s.codes[code])
+	}
+	for _, table := range []struct {
+		title  string
+		counts map[string]int
+	}{{"User", s.users}, {"Client", s.clients}, {"Path prefix", s.prefixes}} {
+		fmt.Fprintf(w, "\n%s\tOps\n", table.title)
+		keys := make([]string, 0, len(table.counts))
+		for k := range table.counts {
+			keys = append(keys, k)
+		}
+		sort.Slice(keys, func(i, j int) bool {
+			if a, b := table.counts[keys[i]], table.counts[keys[j]]; a != b {
+				return a > b
+			}
+			return keys[i] < keys[j]
+		})
+		if s.top > 0 && len(keys) > s.top {
+			keys = keys[:s.top]
+		}
+		for _, k := range keys {
+			fmt.Fprintf(w, "%s\t%d\n", convertSpecialSymbols(k), table.counts[k])
+		}
+	}
+	return w.Flush()
+}
+
+// runOev implements the `oev` subcommand, a converter between edits
+// segments, the XML of Hadoop's OfflineEditsViewer, JSON Lines and
+// statistics.
+func runOev(args []string) {
+	fs := flag.NewFlagSet("oev", flag.ExitOnError)
+	processor := fs.String("p", "xml", "output: xml, jsonl, stats or binary")
+	output := fs.String("o", "", "write to this file instead of stdout")
+	depth := fs.Int("prefix-depth", 2, "path components of the prefixes counted by -p stats")
+	top := fs.Int("top", 20, "users, clients and prefixes listed by -p stats (0 for all)")
+	registerParseFlags(fs)
+	registerLogFlags(fs)
+	fs.Usage = commandUsage(fs, "[flags] <edits or edits.xml>",
+		"Input ending in .xml is read as OfflineEditsViewer XML, anything else as an edits segment.")
+	parseArgs(fs, args, 1)
+
+	out, err := createOutput(*output, OutputOptions{})
+	logIfErr(err)
+	var p editsProcessor
+	switch *processor {
+	case "xml":
+		p = &xmlEditsWriter{out: out}
+	case "jsonl":
+		p = &jsonEditsWriter{enc: json.NewEncoder(out)}
+	case "stats":
+		p = newEditStats(out, *depth, *top)
+	case "binary":
+		p = &binaryEditsWriter{out: out}
+	default:
+		log.Fatalf("unknown processor %q (want xml, jsonl, stats or binary)", *processor)
+	}
+
+	input := fs.Arg(0)
+	read := readEditsBinary
+	if strings.HasSuffix(strings.ToLower(input), ".xml") {
+		read = readEditsXML
+	}
+	n := 0
+	err = read(input, p.start, func(op *EditOp) error {
+		n++
+		return p.op(op)
+	})
+	logIfErr(err)
+	logIfErr(p.finish())
+	logIfErr(out.Close())
+	infof("converted %d ops", n)
+}
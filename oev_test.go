@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// convertEdits runs an oev conversion of input through p.
+func convertEdits(t *testing.T, input string, p editsProcessor) {
+	t.Helper()
+	read := readEditsBinary
+	if filepath.Ext(input) == ".xml" {
+		read = readEditsXML
+	}
+	if err := read(input, p.start, p.op); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.finish(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestOevRoundTrip converts a segment to XML and back, which must give
+// the segment again.
+func TestOevRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	segment := writeTestEdits(t, dir, testEditOps())
+	want, err := os.ReadFile(segment)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var xml bytes.Buffer
+	convertEdits(t, segment, &xmlEditsWriter{out: &xml})
+	checkGolden(t, "edits.xml", xml.Bytes())
+	xmlFile := filepath.Join(dir, "edits.xml")
+	if err := os.WriteFile(xmlFile, xml.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var got bytes.Buffer
+	convertEdits(t, xmlFile, &binaryEditsWriter{out: &got})
+	if !bytes.Equal(got.Bytes(), want) {
+		t.Errorf("segment converted to XML and back differs: %d bytes, want %d", got.Len(), len(want))
+	}
+}
+
+// TestOevHadoopFixture converts editsStored, the segment Hadoop's own
+// TestOfflineEditsViewer reads, and compares it with editsStored.xml,
+// the `hdfs oev` output for it. Both are copied from
+// hadoop-hdfs-project/hadoop-hdfs/src/test/resources.
+func TestOevHadoopFixture(t *testing.T) {
+	segment := filepath.Join("testdata", "editsStored")
+	want, err := os.ReadFile(segment)
+	if os.IsNotExist(err) {
+		t.Skip("testdata/editsStored is missing, see the Test section of README.md")
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantXML, err := os.ReadFile(segment + ".xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var xml bytes.Buffer
+	convertEdits(t, segment, &xmlEditsWriter{out: &xml})
+	if !bytes.Equal(xml.Bytes(), wantXML) {
+		t.Errorf("editsStored converts to XML unlike hdfs oev: %d bytes, want %d", xml.Len(), len(wantXML))
+	}
+	var got bytes.Buffer
+	convertEdits(t, segment+".xml", &binaryEditsWriter{out: &got})
+	if !bytes.Equal(got.Bytes(), want) {
+		t.Errorf("editsStored.xml converts to a different segment: %d bytes, want %d", got.Len(), len(want))
+	}
+}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+
+	"github.com/dsnet/compress/bzip2"
+	"github.com/klauspost/compress/zstd"
+	"github.com/klauspost/pgzip"
+)
+
+// Output compressions.
+const (
+	compressNone  = "none"
+	compressGzip  = "gzip"
+	compressZstd  = "zstd"
+	compressBzip2 = "bzip2"
+)
+
+var compressionExtensions = map[string]string{
+	".gz":   compressGzip,
+	".gzip": compressGzip,
+	".zst":  compressZstd,
+	".zstd": compressZstd,
+	".bz2":  compressBzip2,
+}
+
+// OutputOptions select how output files are compressed.
+type OutputOptions struct {
+	Compression string // "" picks it from the output extension
+	Level       int    // 0 for the codec's default
+	Threads     int
+}
+
+func registerOutputFlags(fs *flag.FlagSet, opts *OutputOptions) {
+	fs.StringVar(&opts.Compression, "compress", "", "compress output: none, gzip, zstd or bzip2 (default: from the output extension .gz, .zst, .bz2)")
+	fs.IntVar(&opts.Level, "compress-level", 0, "compression level, 0 for the codec default (gzip 1-9, zstd 1-22, bzip2 1-9)")
+	fs.IntVar(&opts.Threads, "compress-threads", runtime.GOMAXPROCS(0), "number of blocks compressed in parallel")
+}
+
+// compression resolves the codec for outputPath.
+func (o OutputOptions) compression(outputPath string) (string, error) {
+	switch o.Compression {
+	case "":
+		if c, ok := compressionExtensions[strings.ToLower(filepath.Ext(outputPath))]; ok {
+			return c, nil
+		}
+		return compressNone, nil
+	case compressNone, compressGzip, compressZstd, compressBzip2:
+		return o.Compression, nil
+	}
+	return "", fmt.Errorf("unknown compression %q (want none, gzip, zstd or bzip2)", o.Compression)
+}
+
+// compressionExt is the file extension for a compression.
+func compressionExt(compression string) string {
+	switch compression {
+	case compressGzip:
+		return ".gz"
+	case compressZstd:
+		return ".zst"
+	case compressBzip2:
+		return ".bz2"
+	}
+	return ""
+}
+
+// trimCompressionExt strips a compression extension, so out.tsv.gz is
+// recognised as TSV.
+func trimCompressionExt(outputPath string) string {
+	if _, ok := compressionExtensions[strings.ToLower(filepath.Ext(outputPath))]; ok {
+		return strings.TrimSuffix(outputPath, filepath.Ext(outputPath))
+	}
+	return outputPath
+}
+
+// outputFile closes its compressor before the file under it.
+type outputFile struct {
+	io.Writer
+	closers []io.Closer
+}
+
+func (o *outputFile) Close() error {
+	var first error
+	for _, c := range o.closers {
+		if err := c.Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// createOutput creates outputPath, or uses stdout when it is empty, and
+// wraps it in the selected compressor. Close must be called to flush it.
+func createOutput(outputPath string, opts OutputOptions) (io.WriteCloser, error) {
+	compression, err := opts.compression(outputPath)
+	if err != nil {
+		return nil, err
+	}
+
+	out := &outputFile{Writer: os.Stdout}
+	if outputPath != "" {
+		f, err := os.Create(outputPath)
+		if err != nil {
+			return nil, err
+		}
+		out.Writer = f
+		out.closers = append(out.closers, f)
+	}
+
+	var c io.WriteCloser
+	threads := max(opts.Threads, 1)
+	switch compression {
+	case compressNone:
+		return out, nil
+	case compressGzip:
+		level := pgzip.DefaultCompression
+		if opts.Level != 0 {
+			level = opts.Level
+		}
+		z, err := pgzip.NewWriterLevel(out.Writer, level)
+		if err == nil {
+			err = z.SetConcurrency(1<<20, threads)
+		}
+		if err != nil {
+			out.Close()
+			return nil, err
+		}
+		c = z
+	case compressZstd:
+		zopts := []zstd.EOption{zstd.WithEncoderConcurrency(threads)}
+		if opts.Level != 0 {
+			zopts = append(zopts, zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(opts.Level)))
+		}
+		z, err := zstd.NewWriter(out.Writer, zopts...)
+		if err != nil {
+			out.Close()
+			return nil, err
+		}
+		c = z
+	case compressBzip2:
+		level := bzip2.DefaultCompression
+		if opts.Level != 0 {
+			level = opts.Level
+		}
+		if level < bzip2.BestSpeed || level > bzip2.BestCompression {
+			out.Close()
+			return nil, fmt.Errorf("bzip2 level %d out of range (%d-%d)", level, bzip2.BestSpeed, bzip2.BestCompression)
+		}
+		c = newParallelBzip2Writer(out.Writer, level, threads)
+	}
+	out.Writer = c
+	out.closers = append([]io.Closer{c}, out.closers...)
+	return out, nil
+}
+
+// bzip2ChunkSize is the input compressed by one goroutine into one
+// bzip2 stream.
+const bzip2ChunkSize = 4 << 20
+
+type bzip2Chunk struct {
+	data []byte
+	err  error
+}
+
+// parallelBzip2Writer compresses chunks of input concurrently, each as a
+// separate bzip2 stream, and writes the streams in order. Concatenated
+// streams are valid bzip2 (pbzip2 does the same) and are read by bzip2,
+// Go's compress/bzip2 and Hadoop's BZip2Codec.
+type parallelBzip2Writer struct {
+	w       io.Writer
+	level   int
+	buf     []byte
+	chunks  int
+	pending chan chan bzip2Chunk // in write order, bounds chunks in flight
+	done    chan error
+
+	mu  sync.Mutex
+	err error
+}
+
+func newParallelBzip2Writer(w io.Writer, level, threads int) *parallelBzip2Writer {
+	z := &parallelBzip2Writer{
+		w:       w,
+		level:   level,
+		pending: make(chan chan bzip2Chunk, threads),
+		done:    make(chan error, 1),
+	}
+	go z.drain()
+	return z
+}
+
+func (z *parallelBzip2Writer) Write(p []byte) (int, error) {
+	if err := z.error(); err != nil {
+		return 0, err
+	}
+	n := len(p)
+	for len(p) > 0 {
+		if z.buf == nil {
+			z.buf = make([]byte, 0, bzip2ChunkSize)
+		}
+		k := min(len(p), bzip2ChunkSize-len(z.buf))
+		z.buf = append(z.buf, p[:k]...)
+		p = p[k:]
+		if len(z.buf) == bzip2ChunkSize {
+			z.flushChunk()
+		}
+	}
+	return n, nil
+}
+
+func (z *parallelBzip2Writer) flushChunk() {
+	chunk := z.buf
+	z.buf = nil
+	z.chunks++
+	result := make(chan bzip2Chunk, 1)
+	z.pending <- result
+	go func() {
+		var out bytes.Buffer
+		w, err := bzip2.NewWriter(&out, &bzip2.WriterConfig{Level: z.level})
+		if err == nil {
+			_, err = w.Write(chunk)
+		}
+		if err == nil {
+			err = w.Close()
+		}
+		result <- bzip2Chunk{out.Bytes(), err}
+	}()
+}
+
+func (z *parallelBzip2Writer) drain() {
+	var err error
+	for result := range z.pending {
+		chunk := <-result
+		if err == nil {
+			err = chunk.err
+		}
+		if err == nil {
+			_, err = z.w.Write(chunk.data)
+		}
+		if err != nil {
+			z.mu.Lock()
+			z.err = err
+			z.mu.Unlock()
+		}
+	}
+	z.done <- err
+}
+
+func (z *parallelBzip2Writer) error() error {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	return z.err
+}
+
+func (z *parallelBzip2Writer) Close() error {
+	// an empty input still gets one (empty) stream
+	if len(z.buf) > 0 || z.chunks == 0 {
+		z.flushChunk()
+	}
+	close(z.pending)
+	return <-z.done
+}
@@ -24,7 +24,7 @@
 // versions:
 // 	protoc-gen-go v1.36.11
 // 	protoc        v6.33.4
-// source: common/Security.proto
+// source: Security.proto
 
 package hadoop_common
 
@@ -57,7 +57,7 @@ type TokenProto struct {
 
 func (x *TokenProto) Reset() {
 	*x = TokenProto{}
-	mi := &file_common_Security_proto_msgTypes[0]
+	mi := &file_Security_proto_msgTypes[0]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -69,7 +69,7 @@ func (x *TokenProto) String() string {
 func (*TokenProto) ProtoMessage() {}
 
 func (x *TokenProto) ProtoReflect() protoreflect.Message {
-	mi := &file_common_Security_proto_msgTypes[0]
+	mi := &file_Security_proto_msgTypes[0]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -82,7 +82,7 @@ func (x *TokenProto) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use TokenProto.ProtoReflect.Descriptor instead.
 func (*TokenProto) Descriptor() ([]byte, []int) {
-	return file_common_Security_proto_rawDescGZIP(), []int{0}
+	return file_Security_proto_rawDescGZIP(), []int{0}
 }
 
 func (x *TokenProto) GetIdentifier() []byte {
@@ -124,7 +124,7 @@ type CredentialsKVProto struct {
 
 func (x *CredentialsKVProto) Reset() {
 	*x = CredentialsKVProto{}
-	mi := &file_common_Security_proto_msgTypes[1]
+	mi := &file_Security_proto_msgTypes[1]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -136,7 +136,7 @@ func (x *CredentialsKVProto) String() string {
 func (*CredentialsKVProto) ProtoMessage() {}
 
 func (x *CredentialsKVProto) ProtoReflect() protoreflect.Message {
-	mi := &file_common_Security_proto_msgTypes[1]
+	mi := &file_Security_proto_msgTypes[1]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -149,7 +149,7 @@ func (x *CredentialsKVProto) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use CredentialsKVProto.ProtoReflect.Descriptor instead.
 func (*CredentialsKVProto) Descriptor() ([]byte, []int) {
-	return file_common_Security_proto_rawDescGZIP(), []int{1}
+	return file_Security_proto_rawDescGZIP(), []int{1}
 }
 
 func (x *CredentialsKVProto) GetAlias() string {
@@ -183,7 +183,7 @@ type CredentialsProto struct {
 
 func (x *CredentialsProto) Reset() {
 	*x = CredentialsProto{}
-	mi := &file_common_Security_proto_msgTypes[2]
+	mi := &file_Security_proto_msgTypes[2]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -195,7 +195,7 @@ func (x *CredentialsProto) String() string {
 func (*CredentialsProto) ProtoMessage() {}
 
 func (x *CredentialsProto) ProtoReflect() protoreflect.Message {
-	mi := &file_common_Security_proto_msgTypes[2]
+	mi := &file_Security_proto_msgTypes[2]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -208,7 +208,7 @@ func (x *CredentialsProto) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use CredentialsProto.ProtoReflect.Descriptor instead.
 func (*CredentialsProto) Descriptor() ([]byte, []int) {
-	return file_common_Security_proto_rawDescGZIP(), []int{2}
+	return file_Security_proto_rawDescGZIP(), []int{2}
 }
 
 func (x *CredentialsProto) GetTokens() []*CredentialsKVProto {
@@ -234,7 +234,7 @@ type GetDelegationTokenRequestProto struct {
 
 func (x *GetDelegationTokenRequestProto) Reset() {
 	*x = GetDelegationTokenRequestProto{}
-	mi := &file_common_Security_proto_msgTypes[3]
+	mi := &file_Security_proto_msgTypes[3]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -246,7 +246,7 @@ func (x *GetDelegationTokenRequestProto) String() string {
 func (*GetDelegationTokenRequestProto) ProtoMessage() {}
 
 func (x *GetDelegationTokenRequestProto) ProtoReflect() protoreflect.Message {
-	mi := &file_common_Security_proto_msgTypes[3]
+	mi := &file_Security_proto_msgTypes[3]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -259,7 +259,7 @@ func (x *GetDelegationTokenRequestProto) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use GetDelegationTokenRequestProto.ProtoReflect.Descriptor instead.
 func (*GetDelegationTokenRequestProto) Descriptor() ([]byte, []int) {
-	return file_common_Security_proto_rawDescGZIP(), []int{3}
+	return file_Security_proto_rawDescGZIP(), []int{3}
 }
 
 func (x *GetDelegationTokenRequestProto) GetRenewer() string {
@@ -278,7 +278,7 @@ type GetDelegationTokenResponseProto struct {
 
 func (x *GetDelegationTokenResponseProto) Reset() {
 	*x = GetDelegationTokenResponseProto{}
-	mi := &file_common_Security_proto_msgTypes[4]
+	mi := &file_Security_proto_msgTypes[4]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -290,7 +290,7 @@ func (x *GetDelegationTokenResponseProto) String() string {
 func (*GetDelegationTokenResponseProto) ProtoMessage() {}
 
 func (x *GetDelegationTokenResponseProto) ProtoReflect() protoreflect.Message {
-	mi := &file_common_Security_proto_msgTypes[4]
+	mi := &file_Security_proto_msgTypes[4]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -303,7 +303,7 @@ func (x *GetDelegationTokenResponseProto) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use GetDelegationTokenResponseProto.ProtoReflect.Descriptor instead.
 func (*GetDelegationTokenResponseProto) Descriptor() ([]byte, []int) {
-	return file_common_Security_proto_rawDescGZIP(), []int{4}
+	return file_Security_proto_rawDescGZIP(), []int{4}
 }
 
 func (x *GetDelegationTokenResponseProto) GetToken() *TokenProto {
@@ -322,7 +322,7 @@ type RenewDelegationTokenRequestProto struct {
 
 func (x *RenewDelegationTokenRequestProto) Reset() {
 	*x = RenewDelegationTokenRequestProto{}
-	mi := &file_common_Security_proto_msgTypes[5]
+	mi := &file_Security_proto_msgTypes[5]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -334,7 +334,7 @@ func (x *RenewDelegationTokenRequestProto) String() string {
 func (*RenewDelegationTokenRequestProto) ProtoMessage() {}
 
 func (x *RenewDelegationTokenRequestProto) ProtoReflect() protoreflect.Message {
-	mi := &file_common_Security_proto_msgTypes[5]
+	mi := &file_Security_proto_msgTypes[5]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -347,7 +347,7 @@ func (x *RenewDelegationTokenRequestProto) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use RenewDelegationTokenRequestProto.ProtoReflect.Descriptor instead.
 func (*RenewDelegationTokenRequestProto) Descriptor() ([]byte, []int) {
-	return file_common_Security_proto_rawDescGZIP(), []int{5}
+	return file_Security_proto_rawDescGZIP(), []int{5}
 }
 
 func (x *RenewDelegationTokenRequestProto) GetToken() *TokenProto {
@@ -366,7 +366,7 @@ type RenewDelegationTokenResponseProto struct {
 
 func (x *RenewDelegationTokenResponseProto) Reset() {
 	*x = RenewDelegationTokenResponseProto{}
-	mi := &file_common_Security_proto_msgTypes[6]
+	mi := &file_Security_proto_msgTypes[6]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -378,7 +378,7 @@ func (x *RenewDelegationTokenResponseProto) String() string {
 func (*RenewDelegationTokenResponseProto) ProtoMessage() {}
 
 func (x *RenewDelegationTokenResponseProto) ProtoReflect() protoreflect.Message {
-	mi := &file_common_Security_proto_msgTypes[6]
+	mi := &file_Security_proto_msgTypes[6]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -391,7 +391,7 @@ func (x *RenewDelegationTokenResponseProto) ProtoReflect() protoreflect.Message
 
 // Deprecated: Use RenewDelegationTokenResponseProto.ProtoReflect.Descriptor instead.
 func (*RenewDelegationTokenResponseProto) Descriptor() ([]byte, []int) {
-	return file_common_Security_proto_rawDescGZIP(), []int{6}
+	return file_Security_proto_rawDescGZIP(), []int{6}
 }
 
 func (x *RenewDelegationTokenResponseProto) GetNewExpiryTime() uint64 {
@@ -410,7 +410,7 @@ type CancelDelegationTokenRequestProto struct {
 
 func (x *CancelDelegationTokenRequestProto) Reset() {
 	*x = CancelDelegationTokenRequestProto{}
-	mi := &file_common_Security_proto_msgTypes[7]
+	mi := &file_Security_proto_msgTypes[7]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -422,7 +422,7 @@ func (x *CancelDelegationTokenRequestProto) String() string {
 func (*CancelDelegationTokenRequestProto) ProtoMessage() {}
 
 func (x *CancelDelegationTokenRequestProto) ProtoReflect() protoreflect.Message {
-	mi := &file_common_Security_proto_msgTypes[7]
+	mi := &file_Security_proto_msgTypes[7]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -435,7 +435,7 @@ func (x *CancelDelegationTokenRequestProto) ProtoReflect() protoreflect.Message
 
 // Deprecated: Use CancelDelegationTokenRequestProto.ProtoReflect.Descriptor instead.
 func (*CancelDelegationTokenRequestProto) Descriptor() ([]byte, []int) {
-	return file_common_Security_proto_rawDescGZIP(), []int{7}
+	return file_Security_proto_rawDescGZIP(), []int{7}
 }
 
 func (x *CancelDelegationTokenRequestProto) GetToken() *TokenProto {
@@ -453,7 +453,7 @@ type CancelDelegationTokenResponseProto struct {
 
 func (x *CancelDelegationTokenResponseProto) Reset() {
 	*x = CancelDelegationTokenResponseProto{}
-	mi := &file_common_Security_proto_msgTypes[8]
+	mi := &file_Security_proto_msgTypes[8]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -465,7 +465,7 @@ func (x *CancelDelegationTokenResponseProto) String() string {
 func (*CancelDelegationTokenResponseProto) ProtoMessage() {}
 
 func (x *CancelDelegationTokenResponseProto) ProtoReflect() protoreflect.Message {
-	mi := &file_common_Security_proto_msgTypes[8]
+	mi := &file_Security_proto_msgTypes[8]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -478,14 +478,14 @@ func (x *CancelDelegationTokenResponseProto) ProtoReflect() protoreflect.Message
 
 // Deprecated: Use CancelDelegationTokenResponseProto.ProtoReflect.Descriptor instead.
 func (*CancelDelegationTokenResponseProto) Descriptor() ([]byte, []int) {
-	return file_common_Security_proto_rawDescGZIP(), []int{8}
+	return file_Security_proto_rawDescGZIP(), []int{8}
 }
 
-var File_common_Security_proto protoreflect.FileDescriptor
+var File_Security_proto protoreflect.FileDescriptor
 
-const file_common_Security_proto_rawDesc = "" +
+const file_Security_proto_rawDesc = "" +
 	"\n" +
-	"\x15common/Security.proto\x12\rhadoop.common\"v\n" +
+	"\x0eSecurity.proto\x12\rhadoop.common\"v\n" +
 	"\n" +
 	"TokenProto\x12\x1e\n" +
 	"\n" +
@@ -511,23 +511,23 @@ const file_common_Security_proto_rawDesc = "" +
 	"\rnewExpiryTime\x18\x01 \x02(\x04R\rnewExpiryTime\"T\n" +
 	"!CancelDelegationTokenRequestProto\x12/\n" +
 	"\x05token\x18\x01 \x02(\v2\x19.hadoop.common.TokenProtoR\x05token\"$\n" +
-	"\"CancelDelegationTokenResponseProtoBK\n" +
-	" org.apache.hadoop.security.protoB\x0eSecurityProtosZ\x11pkg/hadoop_common\x88\x01\x01\xa0\x01\x01"
+	"\"CancelDelegationTokenResponseProtoBa\n" +
+	" org.apache.hadoop.security.protoB\x0eSecurityProtosZ'hdfs-fsimage-parse-go/pkg/hadoop_common\x88\x01\x01\xa0\x01\x01"
 
 var (
-	file_common_Security_proto_rawDescOnce sync.Once
-	file_common_Security_proto_rawDescData []byte
+	file_Security_proto_rawDescOnce sync.Once
+	file_Security_proto_rawDescData []byte
 )
 
-func file_common_Security_proto_rawDescGZIP() []byte {
-	file_common_Security_proto_rawDescOnce.Do(func() {
-		file_common_Security_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_common_Security_proto_rawDesc), len(file_common_Security_proto_rawDesc)))
+func file_Security_proto_rawDescGZIP() []byte {
+	file_Security_proto_rawDescOnce.Do(func() {
+		file_Security_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_Security_proto_rawDesc), len(file_Security_proto_rawDesc)))
 	})
-	return file_common_Security_proto_rawDescData
+	return file_Security_proto_rawDescData
 }
 
-var file_common_Security_proto_msgTypes = make([]protoimpl.MessageInfo, 9)
-var file_common_Security_proto_goTypes = []any{
+var file_Security_proto_msgTypes = make([]protoimpl.MessageInfo, 9)
+var file_Security_proto_goTypes = []any{
 	(*TokenProto)(nil),                         // 0: hadoop.common.TokenProto
 	(*CredentialsKVProto)(nil),                 // 1: hadoop.common.CredentialsKVProto
 	(*CredentialsProto)(nil),                   // 2: hadoop.common.CredentialsProto
@@ -538,7 +538,7 @@ var file_common_Security_proto_goTypes = []any{
 	(*CancelDelegationTokenRequestProto)(nil),  // 7: hadoop.common.CancelDelegationTokenRequestProto
 	(*CancelDelegationTokenResponseProto)(nil), // 8: hadoop.common.CancelDelegationTokenResponseProto
 }
-var file_common_Security_proto_depIdxs = []int32{
+var file_Security_proto_depIdxs = []int32{
 	0, // 0: hadoop.common.CredentialsKVProto.token:type_name -> hadoop.common.TokenProto
 	1, // 1: hadoop.common.CredentialsProto.tokens:type_name -> hadoop.common.CredentialsKVProto
 	1, // 2: hadoop.common.CredentialsProto.secrets:type_name -> hadoop.common.CredentialsKVProto
@@ -552,26 +552,26 @@ var file_common_Security_proto_depIdxs = []int32{
 	0, // [0:6] is the sub-list for field type_name
 }
 
-func init() { file_common_Security_proto_init() }
-func file_common_Security_proto_init() {
-	if File_common_Security_proto != nil {
+func init() { file_Security_proto_init() }
+func file_Security_proto_init() {
+	if File_Security_proto != nil {
 		return
 	}
 	type x struct{}
 	out := protoimpl.TypeBuilder{
 		File: protoimpl.DescBuilder{
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
-			RawDescriptor: unsafe.Slice(unsafe.StringData(file_common_Security_proto_rawDesc), len(file_common_Security_proto_rawDesc)),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_Security_proto_rawDesc), len(file_Security_proto_rawDesc)),
 			NumEnums:      0,
 			NumMessages:   9,
 			NumExtensions: 0,
 			NumServices:   0,
 		},
-		GoTypes:           file_common_Security_proto_goTypes,
-		DependencyIndexes: file_common_Security_proto_depIdxs,
-		MessageInfos:      file_common_Security_proto_msgTypes,
+		GoTypes:           file_Security_proto_goTypes,
+		DependencyIndexes: file_Security_proto_depIdxs,
+		MessageInfos:      file_Security_proto_msgTypes,
 	}.Build()
-	File_common_Security_proto = out.File
-	file_common_Security_proto_goTypes = nil
-	file_common_Security_proto_depIdxs = nil
+	File_Security_proto = out.File
+	file_Security_proto_goTypes = nil
+	file_Security_proto_depIdxs = nil
 }
@@ -0,0 +1,354 @@
+//*
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//*
+// These .proto interfaces are private and stable.
+// Please see https://hadoop.apache.org/docs/current/hadoop-project-dist/hadoop-common/Compatibility.html
+// for what changes are allowed for a *stable* .proto interface.
+
+//*
+// Only the cache pool and cache directive messages are vendored from
+// ClientNamenodeProtocol.proto: the fsimage CACHE_MANAGER section stores
+// them after its CacheManagerSection header. The RPC service and the
+// rest of its messages are not needed to read images.
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.11
+// 	protoc        v6.33.4
+// source: ClientNamenodeProtocol.proto
+
+package hadoop_hdfs
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type CacheDirectiveInfoProto struct {
+	state         protoimpl.MessageState             `protogen:"open.v1"`
+	Id            *int64                             `protobuf:"varint,1,opt,name=id" json:"id,omitempty"`
+	Path          *string                            `protobuf:"bytes,2,opt,name=path" json:"path,omitempty"`
+	Replication   *uint32                            `protobuf:"varint,3,opt,name=replication" json:"replication,omitempty"`
+	Pool          *string                            `protobuf:"bytes,4,opt,name=pool" json:"pool,omitempty"`
+	Expiration    *CacheDirectiveInfoExpirationProto `protobuf:"bytes,5,opt,name=expiration" json:"expiration,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CacheDirectiveInfoProto) Reset() {
+	*x = CacheDirectiveInfoProto{}
+	mi := &file_ClientNamenodeProtocol_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CacheDirectiveInfoProto) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CacheDirectiveInfoProto) ProtoMessage() {}
+
+func (x *CacheDirectiveInfoProto) ProtoReflect() protoreflect.Message {
+	mi := &file_ClientNamenodeProtocol_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CacheDirectiveInfoProto.ProtoReflect.Descriptor instead.
+func (*CacheDirectiveInfoProto) Descriptor() ([]byte, []int) {
+	return file_ClientNamenodeProtocol_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *CacheDirectiveInfoProto) GetId() int64 {
+	if x != nil && x.Id != nil {
+		return *x.Id
+	}
+	return 0
+}
+
+func (x *CacheDirectiveInfoProto) GetPath() string {
+	if x != nil && x.Path != nil {
+		return *x.Path
+	}
+	return ""
+}
+
+func (x *CacheDirectiveInfoProto) GetReplication() uint32 {
+	if x != nil && x.Replication != nil {
+		return *x.Replication
+	}
+	return 0
+}
+
+func (x *CacheDirectiveInfoProto) GetPool() string {
+	if x != nil && x.Pool != nil {
+		return *x.Pool
+	}
+	return ""
+}
+
+func (x *CacheDirectiveInfoProto) GetExpiration() *CacheDirectiveInfoExpirationProto {
+	if x != nil {
+		return x.Expiration
+	}
+	return nil
+}
+
+type CacheDirectiveInfoExpirationProto struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Millis        *int64                 `protobuf:"varint,1,req,name=millis" json:"millis,omitempty"`
+	IsRelative    *bool                  `protobuf:"varint,2,req,name=isRelative" json:"isRelative,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CacheDirectiveInfoExpirationProto) Reset() {
+	*x = CacheDirectiveInfoExpirationProto{}
+	mi := &file_ClientNamenodeProtocol_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CacheDirectiveInfoExpirationProto) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CacheDirectiveInfoExpirationProto) ProtoMessage() {}
+
+func (x *CacheDirectiveInfoExpirationProto) ProtoReflect() protoreflect.Message {
+	mi := &file_ClientNamenodeProtocol_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CacheDirectiveInfoExpirationProto.ProtoReflect.Descriptor instead.
+func (*CacheDirectiveInfoExpirationProto) Descriptor() ([]byte, []int) {
+	return file_ClientNamenodeProtocol_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *CacheDirectiveInfoExpirationProto) GetMillis() int64 {
+	if x != nil && x.Millis != nil {
+		return *x.Millis
+	}
+	return 0
+}
+
+func (x *CacheDirectiveInfoExpirationProto) GetIsRelative() bool {
+	if x != nil && x.IsRelative != nil {
+		return *x.IsRelative
+	}
+	return false
+}
+
+type CachePoolInfoProto struct {
+	state              protoimpl.MessageState `protogen:"open.v1"`
+	PoolName           *string                `protobuf:"bytes,1,opt,name=poolName" json:"poolName,omitempty"`
+	OwnerName          *string                `protobuf:"bytes,2,opt,name=ownerName" json:"ownerName,omitempty"`
+	GroupName          *string                `protobuf:"bytes,3,opt,name=groupName" json:"groupName,omitempty"`
+	Mode               *int32                 `protobuf:"varint,4,opt,name=mode" json:"mode,omitempty"`
+	Limit              *int64                 `protobuf:"varint,5,opt,name=limit" json:"limit,omitempty"`
+	MaxRelativeExpiry  *int64                 `protobuf:"varint,6,opt,name=maxRelativeExpiry" json:"maxRelativeExpiry,omitempty"`
+	DefaultReplication *uint32                `protobuf:"varint,7,opt,name=defaultReplication,def=1" json:"defaultReplication,omitempty"`
+	unknownFields      protoimpl.UnknownFields
+	sizeCache          protoimpl.SizeCache
+}
+
+// Default values for CachePoolInfoProto fields.
+const (
+	Default_CachePoolInfoProto_DefaultReplication = uint32(1)
+)
+
+func (x *CachePoolInfoProto) Reset() {
+	*x = CachePoolInfoProto{}
+	mi := &file_ClientNamenodeProtocol_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CachePoolInfoProto) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CachePoolInfoProto) ProtoMessage() {}
+
+func (x *CachePoolInfoProto) ProtoReflect() protoreflect.Message {
+	mi := &file_ClientNamenodeProtocol_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CachePoolInfoProto.ProtoReflect.Descriptor instead.
+func (*CachePoolInfoProto) Descriptor() ([]byte, []int) {
+	return file_ClientNamenodeProtocol_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *CachePoolInfoProto) GetPoolName() string {
+	if x != nil && x.PoolName != nil {
+		return *x.PoolName
+	}
+	return ""
+}
+
+func (x *CachePoolInfoProto) GetOwnerName() string {
+	if x != nil && x.OwnerName != nil {
+		return *x.OwnerName
+	}
+	return ""
+}
+
+func (x *CachePoolInfoProto) GetGroupName() string {
+	if x != nil && x.GroupName != nil {
+		return *x.GroupName
+	}
+	return ""
+}
+
+func (x *CachePoolInfoProto) GetMode() int32 {
+	if x != nil && x.Mode != nil {
+		return *x.Mode
+	}
+	return 0
+}
+
+func (x *CachePoolInfoProto) GetLimit() int64 {
+	if x != nil && x.Limit != nil {
+		return *x.Limit
+	}
+	return 0
+}
+
+func (x *CachePoolInfoProto) GetMaxRelativeExpiry() int64 {
+	if x != nil && x.MaxRelativeExpiry != nil {
+		return *x.MaxRelativeExpiry
+	}
+	return 0
+}
+
+func (x *CachePoolInfoProto) GetDefaultReplication() uint32 {
+	if x != nil && x.DefaultReplication != nil {
+		return *x.DefaultReplication
+	}
+	return Default_CachePoolInfoProto_DefaultReplication
+}
+
+var File_ClientNamenodeProtocol_proto protoreflect.FileDescriptor
+
+const file_ClientNamenodeProtocol_proto_rawDesc = "" +
+	"\n" +
+	"\x1cClientNamenodeProtocol.proto\x12\vhadoop.hdfs\"\xc3\x01\n" +
+	"\x17CacheDirectiveInfoProto\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\x03R\x02id\x12\x12\n" +
+	"\x04path\x18\x02 \x01(\tR\x04path\x12 \n" +
+	"\vreplication\x18\x03 \x01(\rR\vreplication\x12\x12\n" +
+	"\x04pool\x18\x04 \x01(\tR\x04pool\x12N\n" +
+	"\n" +
+	"expiration\x18\x05 \x01(\v2..hadoop.hdfs.CacheDirectiveInfoExpirationProtoR\n" +
+	"expiration\"[\n" +
+	"!CacheDirectiveInfoExpirationProto\x12\x16\n" +
+	"\x06millis\x18\x01 \x02(\x03R\x06millis\x12\x1e\n" +
+	"\n" +
+	"isRelative\x18\x02 \x02(\bR\n" +
+	"isRelative\"\xf7\x01\n" +
+	"\x12CachePoolInfoProto\x12\x1a\n" +
+	"\bpoolName\x18\x01 \x01(\tR\bpoolName\x12\x1c\n" +
+	"\townerName\x18\x02 \x01(\tR\townerName\x12\x1c\n" +
+	"\tgroupName\x18\x03 \x01(\tR\tgroupName\x12\x12\n" +
+	"\x04mode\x18\x04 \x01(\x05R\x04mode\x12\x14\n" +
+	"\x05limit\x18\x05 \x01(\x03R\x05limit\x12,\n" +
+	"\x11maxRelativeExpiry\x18\x06 \x01(\x03R\x11maxRelativeExpiry\x121\n" +
+	"\x12defaultReplication\x18\a \x01(\r:\x011R\x12defaultReplicationBr\n" +
+	"%org.apache.hadoop.hdfs.protocol.protoB\x1cClientNamenodeProtocolProtosZ%hdfs-fsimage-parse-go/pkg/hadoop_hdfs\x88\x01\x01\xa0\x01\x01"
+
+var (
+	file_ClientNamenodeProtocol_proto_rawDescOnce sync.Once
+	file_ClientNamenodeProtocol_proto_rawDescData []byte
+)
+
+func file_ClientNamenodeProtocol_proto_rawDescGZIP() []byte {
+	file_ClientNamenodeProtocol_proto_rawDescOnce.Do(func() {
+		file_ClientNamenodeProtocol_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_ClientNamenodeProtocol_proto_rawDesc), len(file_ClientNamenodeProtocol_proto_rawDesc)))
+	})
+	return file_ClientNamenodeProtocol_proto_rawDescData
+}
+
+var file_ClientNamenodeProtocol_proto_msgTypes = make([]protoimpl.MessageInfo, 3)
+var file_ClientNamenodeProtocol_proto_goTypes = []any{
+	(*CacheDirectiveInfoProto)(nil),           // 0: hadoop.hdfs.CacheDirectiveInfoProto
+	(*CacheDirectiveInfoExpirationProto)(nil), // 1: hadoop.hdfs.CacheDirectiveInfoExpirationProto
+	(*CachePoolInfoProto)(nil),                // 2: hadoop.hdfs.CachePoolInfoProto
+}
+var file_ClientNamenodeProtocol_proto_depIdxs = []int32{
+	1, // 0: hadoop.hdfs.CacheDirectiveInfoProto.expiration:type_name -> hadoop.hdfs.CacheDirectiveInfoExpirationProto
+	1, // [1:1] is the sub-list for method output_type
+	1, // [1:1] is the sub-list for method input_type
+	1, // [1:1] is the sub-list for extension type_name
+	1, // [1:1] is the sub-list for extension extendee
+	0, // [0:1] is the sub-list for field type_name
+}
+
+func init() { file_ClientNamenodeProtocol_proto_init() }
+func file_ClientNamenodeProtocol_proto_init() {
+	if File_ClientNamenodeProtocol_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_ClientNamenodeProtocol_proto_rawDesc), len(file_ClientNamenodeProtocol_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   3,
+			NumExtensions: 0,
+			NumServices:   0,
+		},
+		GoTypes:           file_ClientNamenodeProtocol_proto_goTypes,
+		DependencyIndexes: file_ClientNamenodeProtocol_proto_depIdxs,
+		MessageInfos:      file_ClientNamenodeProtocol_proto_msgTypes,
+	}.Build()
+	File_ClientNamenodeProtocol_proto = out.File
+	file_ClientNamenodeProtocol_proto_goTypes = nil
+	file_ClientNamenodeProtocol_proto_depIdxs = nil
+}
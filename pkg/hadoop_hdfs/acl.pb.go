@@ -992,8 +992,8 @@ const file_acl_proto_rawDesc = "" +
 	"\x18GetAclStatusRequestProto\x12\x10\n" +
 	"\x03src\x18\x01 \x02(\tR\x03src\"P\n" +
 	"\x19GetAclStatusResponseProto\x123\n" +
-	"\x06result\x18\x01 \x02(\v2\x1b.hadoop.hdfs.AclStatusProtoR\x06resultBF\n" +
-	"%org.apache.hadoop.hdfs.protocol.protoB\tAclProtosZ\x0fpkg/hadoop_hdfs\xa0\x01\x01"
+	"\x06result\x18\x01 \x02(\v2\x1b.hadoop.hdfs.AclStatusProtoR\x06resultB\\\n" +
+	"%org.apache.hadoop.hdfs.protocol.protoB\tAclProtosZ%hdfs-fsimage-parse-go/pkg/hadoop_hdfs\xa0\x01\x01"
 
 var (
 	file_acl_proto_rawDescOnce sync.Once
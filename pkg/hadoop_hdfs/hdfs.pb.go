@@ -31,7 +31,7 @@ package hadoop_hdfs
 import (
 	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
 	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
-	hadoop_common "main/pkg/hadoop_common"
+	hadoop_common "hdfs-fsimage-parse-go/pkg/hadoop_common"
 	reflect "reflect"
 	sync "sync"
 	unsafe "unsafe"
@@ -5241,9 +5241,9 @@ const file_hdfs_proto_rawDesc = "" +
 	"\x04READ\x10\x01\x12\t\n" +
 	"\x05WRITE\x10\x02\x12\b\n" +
 	"\x04COPY\x10\x03\x12\v\n" +
-	"\aREPLACE\x10\x04BG\n" +
+	"\aREPLACE\x10\x04B]\n" +
 	"%org.apache.hadoop.hdfs.protocol.protoB\n" +
-	"HdfsProtosZ\x0fpkg/hadoop_hdfs\xa0\x01\x01"
+	"HdfsProtosZ%hdfs-fsimage-parse-go/pkg/hadoop_hdfs\xa0\x01\x01"
 
 var (
 	file_hdfs_proto_rawDescOnce sync.Once
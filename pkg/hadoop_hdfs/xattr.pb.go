@@ -624,8 +624,8 @@ const file_xattr_proto_rawDesc = "" +
 	"\x18RemoveXAttrResponseProto*8\n" +
 	"\x11XAttrSetFlagProto\x12\x10\n" +
 	"\fXATTR_CREATE\x10\x01\x12\x11\n" +
-	"\rXATTR_REPLACE\x10\x02BH\n" +
-	"%org.apache.hadoop.hdfs.protocol.protoB\vXAttrProtosZ\x0fpkg/hadoop_hdfs\xa0\x01\x01"
+	"\rXATTR_REPLACE\x10\x02B^\n" +
+	"%org.apache.hadoop.hdfs.protocol.protoB\vXAttrProtosZ%hdfs-fsimage-parse-go/pkg/hadoop_hdfs\xa0\x01\x01"
 
 var (
 	file_xattr_proto_rawDescOnce sync.Once
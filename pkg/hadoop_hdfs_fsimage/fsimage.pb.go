@@ -26,7 +26,7 @@ package hadoop_hdfs_fsimage
 import (
 	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
 	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
-	hadoop_hdfs "main/pkg/hadoop_hdfs"
+	hadoop_hdfs "hdfs-fsimage-parse-go/pkg/hadoop_hdfs"
 	reflect "reflect"
 	sync "sync"
 	unsafe "unsafe"
@@ -952,7 +952,7 @@ func (x *INodeSection_FileUnderConstructionFeature) GetClientMachine() string {
 
 type INodeSection_AclFeatureProto struct {
 	state protoimpl.MessageState `protogen:"open.v1"`
-	// *
+	//*
 	// An ACL entry is represented by a 32-bit integer in Big Endian
 	// format. The bits can be divided in four segments:
 	// [0:2) || [2:26) || [26:27) || [27:29) || [29:32)
@@ -963,6 +963,7 @@ type INodeSection_AclFeatureProto struct {
 	// [26:27) -- the scope of the entry (AclEntryScopeProto)
 	// [27:29) -- the type of the entry (AclEntryTypeProto)
 	// [29:32) -- the permission of the entry (FsActionProto)
+	//
 	Entries       []uint32 `protobuf:"fixed32,2,rep,packed,name=entries" json:"entries,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
@@ -1007,7 +1008,7 @@ func (x *INodeSection_AclFeatureProto) GetEntries() []uint32 {
 
 type INodeSection_XAttrCompactProto struct {
 	state protoimpl.MessageState `protogen:"open.v1"`
-	// *
+	//*
 	//
 	// [0:2) -- the namespace of XAttr (XAttrNamespaceProto)
 	// [2:26) -- the name of the entry, which is an ID that points to a
@@ -2515,8 +2516,8 @@ const file_fsimage_fsimage_proto_rawDesc = "" +
 	"\bnumPools\x18\x02 \x02(\rR\bnumPools\x12$\n" +
 	"\rnumDirectives\x18\x03 \x02(\rR\rnumDirectives\"Y\n" +
 	"\x14ErasureCodingSection\x12A\n" +
-	"\bpolicies\x18\x01 \x03(\v2%.hadoop.hdfs.ErasureCodingPolicyProtoR\bpoliciesBO\n" +
-	"&org.apache.hadoop.hdfs.server.namenodeB\fFsImageProtoZ\x17pkg/hadoop_hdfs_fsimage"
+	"\bpolicies\x18\x01 \x03(\v2%.hadoop.hdfs.ErasureCodingPolicyProtoR\bpoliciesBe\n" +
+	"&org.apache.hadoop.hdfs.server.namenodeB\fFsImageProtoZ-hdfs-fsimage-parse-go/pkg/hadoop_hdfs_fsimage"
 
 var (
 	file_fsimage_fsimage_proto_rawDescOnce sync.Once
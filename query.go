@@ -0,0 +1,133 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+func runQuery(args []string) {
+	fs := flag.NewFlagSet("query", flag.ExitOnError)
+	format := fs.String("format", "table", "output format: table, tsv or json")
+	output := fs.String("o", "", "write results to this file instead of stdout")
+	var outOpts OutputOptions
+	registerOutputFlags(fs, &outOpts)
+	var fOpts FilterOptions
+	registerFilterFlags(fs, &fOpts)
+	fs.Usage = commandUsage(fs, "[flags] <fsimage> <sql>",
+		"Tables: inodes, paths, blocks, acls, xattrs, snapshots, strings",
+		"Views:  namespace, files, dirs, symlinks")
+	registerEditsFlags(fs)
+	registerParseFlags(fs)
+	registerLogFlags(fs)
+	parseArgs(fs, args, 2)
+	query := strings.Join(fs.Args()[1:], " ")
+
+	filter, err := NewFilter(fOpts, time.Now())
+	logIfErr(err)
+
+	f, sectionMap, err := openImage(fs.Arg(0))
+	logIfErr(err)
+	defer f.Close()
+	ns, err := loadNamespace(f, sectionMap)
+	logIfErr(err)
+	snapshots, err := parseSnapshotSection(sectionMap["SNAPSHOT"], f)
+	logIfErr(err)
+
+	db, err := sql.Open("sqlite", ":memory:")
+	logIfErr(err)
+	defer db.Close()
+	// every connection to ":memory:" is a separate database
+	db.SetMaxOpenConns(1)
+
+	_, err = db.Exec(namespaceSchema)
+	logIfErr(err)
+	logIfErr(loadNamespaceSQL(db, ns, filter))
+	logIfErr(loadStringsSQL(db))
+	logIfErr(loadSnapshotsSQL(db, snapshots))
+
+	rows, err := db.Query(query)
+	logIfErr(err)
+	defer rows.Close()
+
+	out, err := createOutput(*output, outOpts)
+	logIfErr(err)
+	logIfErr(writeQueryResult(out, rows, *format))
+	logIfErr(out.Close())
+}
+
+func writeQueryResult(w io.Writer, rows *sql.Rows, format string) error {
+	columns, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+	values := make([]any, len(columns))
+	ptrs := make([]any, len(columns))
+	for i := range values {
+		ptrs[i] = &values[i]
+	}
+
+	switch format {
+	case "table", "tsv":
+		var out io.Writer = w
+		var tw *tabwriter.Writer
+		if format == "table" {
+			tw = tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+			out = tw
+		}
+		fmt.Fprintln(out, strings.Join(columns, "\t"))
+		for rows.Next() {
+			if err := rows.Scan(ptrs...); err != nil {
+				return err
+			}
+			cells := make([]string, len(values))
+			for i, v := range values {
+				cells[i] = convertSpecialSymbols(sqlValueString(v))
+			}
+			fmt.Fprintln(out, strings.Join(cells, "\t"))
+		}
+		if tw != nil {
+			tw.Flush()
+		}
+	case "json":
+		result := make([]map[string]any, 0)
+		for rows.Next() {
+			if err := rows.Scan(ptrs...); err != nil {
+				return err
+			}
+			record := make(map[string]any, len(columns))
+			for i, c := range columns {
+				if b, ok := values[i].([]byte); ok {
+					record[c] = string(b)
+				} else {
+					record[c] = values[i]
+				}
+			}
+			result = append(result, record)
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(result); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown format %q (want table, tsv or json)", format)
+	}
+	return rows.Err()
+}
+
+func sqlValueString(v any) string {
+	switch t := v.(type) {
+	case nil:
+		return "NULL"
+	case []byte:
+		return string(t)
+	default:
+		return fmt.Sprint(t)
+	}
+}
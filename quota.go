@@ -0,0 +1,158 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"text/tabwriter"
+)
+
+// Kinds of quota a QuotaEntry reports; storage type quotas use the
+// storage type name instead.
+const (
+	quotaNamespace = "namespace"
+	quotaSpace     = "space"
+)
+
+// QuotaReport is the result of `quota`, also its JSON output. Entries
+// are sorted by Percent, the most used first.
+type QuotaReport struct {
+	Image       string       `json:"image"`
+	Threshold   float64      `json:"threshold,omitempty"`
+	Directories int          `json:"directories"`
+	Over        int          `json:"over"`
+	Quotas      []QuotaEntry `json:"quotas"`
+}
+
+// QuotaEntry is one quota of a directory. Headroom is negative when the
+// directory is over the quota.
+type QuotaEntry struct {
+	Path     string  `json:"path"`
+	Quota    string  `json:"quota"`
+	Used     uint64  `json:"used"`
+	Limit    int64   `json:"limit"`
+	Percent  float64 `json:"percent"`
+	Headroom int64   `json:"headroom"`
+	Over     bool    `json:"over"`
+}
+
+// runQuota implements the `quota` subcommand: usage, headroom and
+// violations of every namespace, space and storage type quota.
+func runQuota(args []string) {
+	fs := flag.NewFlagSet("quota", flag.ExitOnError)
+	threshold := fs.Float64("threshold", 0, "list only quotas at least this many percent used, and exit with status 3 if any")
+	human := fs.Bool("h", false, "print sizes as 1.5 G instead of bytes")
+	format := fs.String("format", "text", "output format: text or json")
+	output := fs.String("o", "", "write to this file instead of stdout")
+	registerEditsFlags(fs)
+	registerParseFlags(fs)
+	registerLogFlags(fs)
+	fs.Usage = commandUsage(fs, "[flags] <fsimage>",
+		"Usage is computed from the subtree of each directory, as the NameNode counts it.",
+		fmt.Sprintf("With -threshold, exits with status %d when any quota reaches it.", exitProblems))
+	parseArgs(fs, args, 1)
+
+	if *format != "text" && *format != "json" {
+		log.Fatalf("unknown format %q (want text or json)", *format)
+	}
+	if *threshold < 0 {
+		log.Fatalf("-threshold must not be negative")
+	}
+	f, sectionMap, err := openImage(fs.Arg(0))
+	logIfErr(err)
+	defer f.Close()
+	ecPolicies, err := loadECPolicies(f, sectionMap)
+	logIfErr(err)
+	ns, err := loadNamespace(f, sectionMap)
+	logIfErr(err)
+
+	report := buildQuotaReport(computeUsage(ns, usageOptions{quotasOnly: true, ecPolicies: ecPolicies}).quotas, *threshold)
+	report.Image = fs.Arg(0)
+
+	out, err := createOutput(*output, OutputOptions{})
+	logIfErr(err)
+	if *format == "json" {
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		logIfErr(enc.Encode(report))
+	} else {
+		logIfErr(writeQuotaReport(out, report, *human))
+	}
+	logIfErr(out.Close())
+
+	if *threshold > 0 && len(report.Quotas) > 0 {
+		log.Printf("quota: %d quotas at or above %g%%", len(report.Quotas), *threshold)
+		parseReport.Log()
+		os.Exit(exitProblems)
+	}
+}
+
+// buildQuotaReport lists each quota of each directory, keeping only
+// those at least threshold percent used when threshold is positive.
+func buildQuotaReport(quotas map[string]*quotaUsage, threshold float64) *QuotaReport {
+	report := &QuotaReport{Threshold: threshold, Directories: len(quotas), Quotas: []QuotaEntry{}}
+	add := func(path, kind string, used uint64, limit int64) bool {
+		e := QuotaEntry{
+			Path:     path,
+			Quota:    kind,
+			Used:     used,
+			Limit:    limit,
+			Percent:  100 * float64(used) / float64(max(limit, 1)),
+			Headroom: limit - int64(used),
+			Over:     used > uint64(limit),
+		}
+		if e.Percent >= threshold {
+			report.Quotas = append(report.Quotas, e)
+		}
+		return e.Over
+	}
+	for _, q := range quotas {
+		over := false
+		if q.nsQuota >= 0 {
+			over = add(q.path, quotaNamespace, q.nsUsed, q.nsQuota) || over
+		}
+		if q.dsQuota >= 0 {
+			over = add(q.path, quotaSpace, q.spaceUsed, q.dsQuota) || over
+		}
+		for _, t := range q.typeQuotas {
+			over = add(q.path, t.GetStorageType().String(), q.typeUsed[t.GetStorageType()], int64(t.GetQuota())) || over
+		}
+		if over {
+			report.Over++
+		}
+	}
+	sort.Slice(report.Quotas, func(i, j int) bool {
+		a, b := report.Quotas[i], report.Quotas[j]
+		if a.Percent != b.Percent {
+			return a.Percent > b.Percent
+		}
+		if a.Path != b.Path {
+			return a.Path < b.Path
+		}
+		return a.Quota < b.Quota
+	})
+	return report
+}
+
+func writeQuotaReport(out io.Writer, r *QuotaReport, human bool) error {
+	w := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(w, "Used%%\tQuota\tUsed\tLimit\tHeadroom\tOver\tPath\n")
+	for _, e := range r.Quotas {
+		used, limit, headroom := fmt.Sprint(e.Used), fmt.Sprint(e.Limit), fmt.Sprint(e.Headroom)
+		if human && e.Quota != quotaNamespace {
+			used, limit = formatSize(e.Used), formatSize(uint64(e.Limit))
+			headroom = formatSize(uint64(max(e.Headroom, -e.Headroom)))
+			if e.Headroom < 0 {
+				headroom = "-" + headroom
+			}
+		}
+		fmt.Fprintf(w, "%.1f\t%s\t%s\t%s\t%s\t%t\t%s\n", e.Percent, e.Quota, used, limit, headroom, e.Over,
+			convertSpecialSymbols(e.Path))
+	}
+	fmt.Fprintf(w, "\n%d directories with quotas, %d over quota\n", r.Directories, r.Over)
+	return w.Flush()
+}
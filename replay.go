@@ -0,0 +1,836 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"math"
+	"slices"
+	"sort"
+	"strings"
+
+	hd "hdfs-fsimage-parse-go/pkg/hadoop_hdfs"
+	pb "hdfs-fsimage-parse-go/pkg/hadoop_hdfs_fsimage"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// EditsOptions select the edit log that loadNamespace replays onto the
+// image, for the commands that register them.
+type EditsOptions struct {
+	Paths []string
+	Until int64
+}
+
+var editsOptions EditsOptions
+
+func registerEditsFlags(fs *flag.FlagSet) {
+	fs.Func("edits", "replay the edits segments in this file or directory onto the image (repeatable)", func(s string) error {
+		editsOptions.Paths = append(editsOptions.Paths, s)
+		return nil
+	})
+	fs.Int64Var(&editsOptions.Until, "edits-until", 0, "stop replaying after this transaction id (default: all)")
+}
+
+// Quota values of HdfsConstants in SET_QUOTA ops.
+const (
+	quotaDontSet = math.MaxInt64
+	quotaReset   = -1
+)
+
+// storagePolicyXAttr holds the storage policy of a directory, see
+// BlockStoragePolicySuite.
+const storagePolicyXAttr = "hsm.block.storage.policy.id"
+
+var errStopReplay = errors.New("stop replay")
+
+// replayEdits applies the transactions after imageTxId to inodeData and
+// stringMap and returns the resulting directory structure. An op the
+// namespace does not allow, such as deleting a missing path, is logged
+// and skipped; with -strict it aborts, as it would abort the namenode.
+func replayEdits(ns *Namespace, imageTxId int64) (*Namespace, error) {
+	segments, err := findEditSegments(editsOptions.Paths)
+	if err != nil {
+		return nil, err
+	}
+	t := newTreeEditor(ns)
+	applied, noEffect, failed := 0, 0, 0
+	last, err := forEachEdit(segments, imageTxId, func(op *EditOp) error {
+		if editsOptions.Until > 0 && op.TxId > editsOptions.Until {
+			return errStopReplay
+		}
+		ok, err := t.apply(op)
+		switch {
+		case err != nil:
+			if parseReport.Strict {
+				return fmt.Errorf("txid %d %s: %w", op.TxId, op.Code, err)
+			}
+			log.Printf("warning: txid %d %s: %v", op.TxId, op.Code, err)
+			failed++
+		case ok:
+			applied++
+		default:
+			noEffect++
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errStopReplay) {
+		return nil, err
+	}
+	if last == imageTxId {
+		infof("no transactions after %d in %d edits segments", imageTxId, len(segments))
+	} else {
+		infof("replayed transactions %d to %d: %d applied, %d without effect on the namespace, %d failed",
+			imageTxId+1, last, applied, noEffect, failed)
+	}
+	return t.namespace(), nil
+}
+
+// treeEditor is a mutable copy of the directory structure. Children
+// are kept sorted by name like INodeDirectory keeps them; the name
+// index of a directory is built on its first lookup.
+type treeEditor struct {
+	children    map[uint64][]uint64
+	refChildren map[uint64][]uint32
+	parents     map[uint64]uint64
+	byName      map[uint64]map[string]uint64
+
+	masked  bool // STRING_TABLE ids carry the user/group/xattr mask
+	strings map[uint32]map[string]uint32
+	serial  uint32
+}
+
+func newTreeEditor(ns *Namespace) *treeEditor {
+	t := &treeEditor{
+		children:    make(map[uint64][]uint64),
+		refChildren: make(map[uint64][]uint32),
+		parents:     ns.Parents(),
+		byName:      make(map[uint64]map[string]uint64),
+	}
+	ns.forEachDir(func(parent uint64, children []uint64, refChildren []uint32) {
+		t.children[parent] = slices.Clone(children)
+		if len(refChildren) > 0 {
+			t.refChildren[parent] = slices.Clone(refChildren)
+		}
+	})
+	return t
+}
+
+// namespace rebuilds the compressed form.
+func (t *treeEditor) namespace() *Namespace {
+	parents := make([]uint64, 0, len(t.children))
+	for parent, children := range t.children {
+		if len(children) > 0 || len(t.refChildren[parent]) > 0 {
+			parents = append(parents, parent)
+		}
+	}
+	for parent := range t.refChildren {
+		if _, ok := t.children[parent]; !ok {
+			parents = append(parents, parent)
+		}
+	}
+	slices.Sort(parents)
+	ns := &Namespace{}
+	for _, parent := range parents {
+		ns.addDirEntry(parent, t.children[parent], t.refChildren[parent])
+	}
+	ns.finish()
+	return ns
+}
+
+func (t *treeEditor) child(dir uint64, name string) (uint64, bool) {
+	index, ok := t.byName[dir]
+	if !ok {
+		index = make(map[string]uint64, len(t.children[dir]))
+		for _, id := range t.children[dir] {
+			if inode, ok := inodeData[id]; ok {
+				index[string(inode.GetName())] = id
+			}
+		}
+		t.byName[dir] = index
+	}
+	id, ok := index[name]
+	return id, ok
+}
+
+func (t *treeEditor) resolve(path string) (*pb.INodeSection_INode, error) {
+	if !strings.HasPrefix(path, "/") {
+		return nil, fmt.Errorf("%s: not an absolute path", path)
+	}
+	id := uint64(ROOT_INODE_ID)
+	for _, name := range strings.Split(path, "/") {
+		if name == "" {
+			continue
+		}
+		child, ok := t.child(id, name)
+		if !ok {
+			return nil, fmt.Errorf("%s: no such file or directory", path)
+		}
+		id = child
+	}
+	inode, ok := inodeData[id]
+	if !ok {
+		return nil, fmt.Errorf("%s: inode %d is missing", path, id)
+	}
+	return inode, nil
+}
+
+func (t *treeEditor) resolveType(path string, typ pb.INodeSection_INode_Type) (*pb.INodeSection_INode, error) {
+	inode, err := t.resolve(path)
+	if err == nil && inode.GetType() != typ {
+		err = fmt.Errorf("%s: not a %s", path, strings.ToLower(typ.String()))
+	}
+	return inode, err
+}
+
+// resolveParent returns the directory that holds path and the last
+// component of path.
+func (t *treeEditor) resolveParent(path string) (*pb.INodeSection_INode, string, error) {
+	path = strings.TrimRight(path, "/")
+	i := strings.LastIndexByte(path, '/')
+	if i < 0 || path == "" {
+		return nil, "", fmt.Errorf("%q: not an absolute path below /", path)
+	}
+	dir, err := t.resolveType(path[:i]+"/", pb.INodeSection_INode_DIRECTORY)
+	return dir, path[i+1:], err
+}
+
+func (t *treeEditor) addChild(parent *pb.INodeSection_INode, inode *pb.INodeSection_INode) error {
+	name := string(inode.GetName())
+	if _, exists := t.child(parent.GetId(), name); exists {
+		return fmt.Errorf("%s already exists in directory %d", name, parent.GetId())
+	}
+	children := t.children[parent.GetId()]
+	i := sort.Search(len(children), func(i int) bool { return string(inodeData[children[i]].GetName()) >= name })
+	t.children[parent.GetId()] = slices.Insert(children, i, inode.GetId())
+	t.byName[parent.GetId()][name] = inode.GetId()
+	t.parents[inode.GetId()] = parent.GetId()
+	inodeData[inode.GetId()] = inode
+	return nil
+}
+
+func (t *treeEditor) removeChild(inode *pb.INodeSection_INode) {
+	parent := t.parents[inode.GetId()]
+	t.children[parent] = removeId(t.children[parent], inode.GetId())
+	if index, ok := t.byName[parent]; ok {
+		delete(index, string(inode.GetName()))
+	}
+	delete(t.parents, inode.GetId())
+}
+
+// deleteSubtree removes an inode and everything below it.
+func (t *treeEditor) deleteSubtree(inode *pb.INodeSection_INode) {
+	if _, attached := t.parents[inode.GetId()]; attached {
+		t.removeChild(inode)
+	}
+	stack := []uint64{inode.GetId()}
+	for len(stack) > 0 {
+		id := stack[len(stack)-1]
+		stack = append(stack[:len(stack)-1], t.children[id]...)
+		delete(inodeData, id)
+		delete(t.children, id)
+		delete(t.refChildren, id)
+		delete(t.byName, id)
+		delete(t.parents, id)
+	}
+}
+
+// touchDir moves the modification time of a directory forward, as
+// INode.updateModificationTime does.
+func touchDir(dir *pb.INodeSection_INode, mtime int64) {
+	if d := dir.GetDirectory(); d != nil && uint64(mtime) > d.GetModificationTime() {
+		d.ModificationTime = proto.Uint64(uint64(mtime))
+	}
+}
+
+// intern returns the serial number of s in the string table, adding it
+// when the image does not have it yet. Images with the expanded string
+// table keep users, groups and xattr names apart by the id mask, older
+// ones share one id space.
+func (t *treeEditor) intern(s string, mask uint32) uint32 {
+	if t.strings == nil {
+		t.strings = make(map[uint32]map[string]uint32)
+		for id := range stringMap {
+			if id>>29 != 0 {
+				t.masked = true
+			}
+			t.serial = max(t.serial, id&0xFFFFFF)
+		}
+		for id, str := range stringMap {
+			m := id &^ 0xFFFFFF
+			if t.strings[m] == nil {
+				t.strings[m] = make(map[string]uint32)
+			}
+			t.strings[m][str] = id & 0xFFFFFF
+		}
+	}
+	if !t.masked {
+		mask = 0
+	}
+	if serial, ok := t.strings[mask][s]; ok {
+		return serial
+	}
+	t.serial++
+	stringMap[t.serial|mask] = s
+	if t.strings[mask] == nil {
+		t.strings[mask] = make(map[string]uint32)
+	}
+	t.strings[mask][s] = t.serial
+	return t.serial
+}
+
+func (t *treeEditor) permission(p *EditPermission) uint64 {
+	return uint64(t.intern(p.User, 0x20000000))<<40 | uint64(t.intern(p.Group, 0x40000000))<<16 | uint64(p.Mode)
+}
+
+func editBlocks(blocks []EditBlock) []*hd.BlockProto {
+	protos := make([]*hd.BlockProto, 0, len(blocks))
+	for _, b := range blocks {
+		protos = append(protos, &hd.BlockProto{BlockId: proto.Uint64(uint64(b.Id)), GenStamp: proto.Uint64(uint64(b.GenStamp)),
+			NumBytes: proto.Uint64(uint64(b.NumBytes))})
+	}
+	return protos
+}
+
+// permissionField returns the packed permission of a file, directory
+// or symlink for updating in place.
+func permissionField(inode *pb.INodeSection_INode) **uint64 {
+	switch inode.GetType() {
+	case pb.INodeSection_INode_FILE:
+		return &inode.GetFile().Permission
+	case pb.INodeSection_INode_DIRECTORY:
+		return &inode.GetDirectory().Permission
+	case pb.INodeSection_INode_SYMLINK:
+		return &inode.GetSymlink().Permission
+	}
+	return nil
+}
+
+// setAcl stores a full ACL the way AclStorage.updateINodeAcl does: the
+// owner, mask (or group) and other entries go to the permission bits,
+// the named entries, the group entry and the default ACL to the
+// feature. A minimal ACL removes the feature.
+func (t *treeEditor) setAcl(inode *pb.INodeSection_INode, entries []*hd.AclEntryProto) error {
+	perm := permissionField(inode)
+	if perm == nil || inode.GetType() == pb.INodeSection_INode_SYMLINK {
+		return fmt.Errorf("inode %d cannot have an ACL", inode.GetId())
+	}
+	var access, dflt []*hd.AclEntryProto
+	for _, e := range entries {
+		if e.GetScope() == hd.AclEntryProto_DEFAULT {
+			dflt = append(dflt, e)
+		} else {
+			access = append(access, e)
+		}
+	}
+	if len(dflt) > 0 && inode.GetType() != pb.INodeSection_INode_DIRECTORY {
+		return fmt.Errorf("inode %d is not a directory and cannot have a default ACL", inode.GetId())
+	}
+	// AclTransformation's order: by type, the unnamed entry first
+	order := func(e *hd.AclEntryProto) int {
+		if e.Name == nil {
+			return int(e.GetType()) * 2
+		}
+		return int(e.GetType())*2 + 1
+	}
+	sort.SliceStable(access, func(i, j int) bool { return order(access[i]) < order(access[j]) })
+	if len(access) < 3 {
+		return fmt.Errorf("inode %d: ACL without owner, group and other entries", inode.GetId())
+	}
+
+	// the group bits hold the mask, or the group entry when there is none
+	group := access[len(access)-2]
+	feature := append(access[1:len(access)-2:len(access)-2], dflt...)
+	mode := uint64(access[0].GetPermissions())<<6 | uint64(group.GetPermissions())<<3 | uint64(access[len(access)-1].GetPermissions())
+	*perm = proto.Uint64(**perm&^0o777 | mode)
+
+	var acl *pb.INodeSection_AclFeatureProto
+	if len(feature) > 0 {
+		acl = &pb.INodeSection_AclFeatureProto{}
+		for _, e := range feature {
+			var name uint32
+			switch {
+			case e.Name == nil:
+			case e.GetType() == hd.AclEntryProto_USER:
+				name = t.intern(e.GetName(), 0x20000000)
+			default:
+				name = t.intern(e.GetName(), 0x40000000)
+			}
+			acl.Entries = append(acl.Entries, name<<6|uint32(e.GetScope())<<5|uint32(e.GetType())<<3|uint32(e.GetPermissions()))
+		}
+	}
+	if f := inode.GetFile(); f != nil {
+		f.Acl = acl
+	} else {
+		inode.GetDirectory().Acl = acl
+	}
+	return nil
+}
+
+// xattrFeature returns the xattrs of a file or directory, created on
+// demand.
+func xattrFeature(inode *pb.INodeSection_INode) (*pb.INodeSection_XAttrFeatureProto, error) {
+	var field **pb.INodeSection_XAttrFeatureProto
+	switch inode.GetType() {
+	case pb.INodeSection_INode_FILE:
+		field = &inode.GetFile().XAttrs
+	case pb.INodeSection_INode_DIRECTORY:
+		field = &inode.GetDirectory().XAttrs
+	default:
+		return nil, fmt.Errorf("inode %d cannot have xattrs", inode.GetId())
+	}
+	if *field == nil {
+		*field = &pb.INodeSection_XAttrFeatureProto{}
+	}
+	return *field, nil
+}
+
+// xattrName packs a namespace and name id as XAttrCompactProto does.
+func (t *treeEditor) xattrName(ns hd.XAttrProto_XAttrNamespaceProto, name string) uint32 {
+	return (uint32(ns)&3)<<30 | t.intern(name, 0x60000000)<<6 | (uint32(ns)>>2&1)<<5
+}
+
+// setXAttr adds an xattr or replaces the value of the one with the
+// same namespace and name.
+func (t *treeEditor) setXAttr(inode *pb.INodeSection_INode, x *hd.XAttrProto) error {
+	feature, err := xattrFeature(inode)
+	if err != nil {
+		return err
+	}
+	name := t.xattrName(x.GetNamespace(), x.GetName())
+	for _, existing := range feature.XAttrs {
+		if existing.GetName() == name {
+			existing.Value = x.GetValue()
+			return nil
+		}
+	}
+	feature.XAttrs = append(feature.XAttrs, &pb.INodeSection_XAttrCompactProto{Name: proto.Uint32(name), Value: x.GetValue()})
+	return nil
+}
+
+func (t *treeEditor) removeXAttr(inode *pb.INodeSection_INode, x *hd.XAttrProto) error {
+	feature, err := xattrFeature(inode)
+	if err != nil {
+		return err
+	}
+	name := t.xattrName(x.GetNamespace(), x.GetName())
+	feature.XAttrs = slices.DeleteFunc(feature.XAttrs, func(e *pb.INodeSection_XAttrCompactProto) bool { return e.GetName() == name })
+	return nil
+}
+
+// newINode builds the inode an OP_ADD, OP_MKDIR or OP_SYMLINK creates
+// and links it into its parent.
+func (t *treeEditor) newINode(op *EditOp) (*pb.INodeSection_INode, error) {
+	if _, exists := inodeData[uint64(op.InodeId)]; exists {
+		return nil, fmt.Errorf("%s: inode %d is already in use", op.Path, op.InodeId)
+	}
+	parent, name, err := t.resolveParent(op.Path)
+	if err != nil {
+		return nil, err
+	}
+	if op.Permissions == nil {
+		return nil, fmt.Errorf("%s: no permissions", op.Path)
+	}
+	inode := &pb.INodeSection_INode{Id: proto.Uint64(uint64(op.InodeId)), Name: []byte(name)}
+	perm := t.permission(op.Permissions)
+	switch op.Code {
+	case opAdd:
+		file := &pb.INodeSection_INodeFile{
+			ModificationTime:   proto.Uint64(uint64(op.Mtime)),
+			AccessTime:         proto.Uint64(uint64(op.Atime)),
+			PreferredBlockSize: proto.Uint64(uint64(op.BlockSize)),
+			Permission:         proto.Uint64(perm),
+			FileUC:             &pb.INodeSection_FileUnderConstructionFeature{ClientName: proto.String(op.ClientName), ClientMachine: proto.String(op.ClientMachine)},
+		}
+		if op.ECPolicy != 0 {
+			file.BlockType = hd.BlockTypeProto_STRIPED.Enum()
+			file.ErasureCodingPolicyID = proto.Uint32(uint32(uint8(op.ECPolicy)))
+		} else {
+			file.Replication = proto.Uint32(uint32(op.Replication))
+		}
+		if op.StoragePolicy != 0 {
+			file.StoragePolicyID = proto.Uint32(uint32(uint8(op.StoragePolicy)))
+		}
+		inode.Type, inode.File = pb.INodeSection_INode_FILE.Enum(), file
+	case opMkdir:
+		inode.Type = pb.INodeSection_INode_DIRECTORY.Enum()
+		inode.Directory = &pb.INodeSection_INodeDirectory{
+			ModificationTime: proto.Uint64(uint64(op.Mtime)),
+			NsQuota:          proto.Uint64(math.MaxUint64),
+			DsQuota:          proto.Uint64(math.MaxUint64),
+			Permission:       proto.Uint64(perm),
+		}
+	case opSymlink:
+		inode.Type = pb.INodeSection_INode_SYMLINK.Enum()
+		inode.Symlink = &pb.INodeSection_INodeSymlink{
+			Permission:       proto.Uint64(perm),
+			Target:           []byte(op.Dst),
+			ModificationTime: proto.Uint64(uint64(op.Mtime)),
+			AccessTime:       proto.Uint64(uint64(op.Atime)),
+		}
+	}
+	if len(op.Acl) > 0 {
+		if err := t.setAcl(inode, op.Acl); err != nil {
+			return nil, err
+		}
+	}
+	for _, x := range op.XAttrs {
+		if err := t.setXAttr(inode, x); err != nil {
+			return nil, err
+		}
+	}
+	if err := t.addChild(parent, inode); err != nil {
+		return nil, err
+	}
+	touchDir(parent, op.Mtime)
+	return inode, nil
+}
+
+// rename moves src to dst. OP_RENAME_OLD moves into dst when it is a
+// directory; OP_RENAME replaces dst when asked to.
+func (t *treeEditor) rename(op *EditOp) error {
+	src, err := t.resolve(op.Path)
+	if err != nil {
+		return err
+	}
+	dstPath := op.Dst
+	var overwrite *pb.INodeSection_INode
+	if existing, err := t.resolve(dstPath); err == nil {
+		switch {
+		case op.Code == opRenameOld && existing.GetType() == pb.INodeSection_INode_DIRECTORY:
+			dstPath = strings.TrimRight(dstPath, "/") + "/" + string(src.GetName())
+		case op.Code == opRename && slices.Contains(op.RenameOptions, 1): // Options.Rename.OVERWRITE
+			// FSDirRenameOp.validateOverwrite
+			srcDir, dstDir := src.GetType() == pb.INodeSection_INode_DIRECTORY, existing.GetType() == pb.INodeSection_INode_DIRECTORY
+			switch {
+			case existing.GetId() == src.GetId():
+				return fmt.Errorf("%s: source and destination are the same", op.Dst)
+			case dstDir && !srcDir:
+				return fmt.Errorf("%s: cannot overwrite a directory with a file", op.Dst)
+			case srcDir && !dstDir:
+				return fmt.Errorf("%s: cannot overwrite a file with a directory", op.Dst)
+			case len(t.children[existing.GetId()]) > 0:
+				return fmt.Errorf("%s: cannot overwrite a non-empty directory", op.Dst)
+			}
+			overwrite = existing
+		default:
+			return fmt.Errorf("%s: destination exists", op.Dst)
+		}
+	}
+	dstParent, name, err := t.resolveParent(dstPath)
+	if err != nil {
+		return err
+	}
+	for id := dstParent.GetId(); id != ROOT_INODE_ID; id = t.parents[id] {
+		if id == src.GetId() {
+			return fmt.Errorf("%s: cannot move a directory below itself", op.Path)
+		}
+	}
+	// OP_RENAME_OLD into a directory can still collide, check before
+	// src is detached
+	if id, exists := t.child(dstParent.GetId(), name); exists && id != overwrite.GetId() {
+		return fmt.Errorf("%s: destination exists", dstPath)
+	}
+	// the destination goes only once nothing can fail any more
+	if overwrite != nil {
+		t.deleteSubtree(overwrite)
+	}
+	srcParent := inodeData[t.parents[src.GetId()]]
+	t.removeChild(src)
+	src.Name = []byte(name)
+	if err := t.addChild(dstParent, src); err != nil {
+		return err
+	}
+	touchDir(srcParent, op.Mtime)
+	touchDir(dstParent, op.Mtime)
+	return nil
+}
+
+// setQuota sets a namespace and storage space quota, leaving the ones
+// that are quotaDontSet.
+func setQuota(dir *pb.INodeSection_INodeDirectory, ns, ds int64) {
+	if ns != quotaDontSet {
+		dir.NsQuota = proto.Uint64(uint64(ns))
+	}
+	if ds != quotaDontSet {
+		dir.DsQuota = proto.Uint64(uint64(ds))
+	}
+}
+
+func setTypeQuota(dir *pb.INodeSection_INodeDirectory, typ hd.StorageTypeProto, quota int64) {
+	if dir.TypeQuotas == nil {
+		dir.TypeQuotas = &pb.INodeSection_QuotaByStorageTypeFeatureProto{}
+	}
+	quotas := slices.DeleteFunc(dir.TypeQuotas.Quotas, func(q *pb.INodeSection_QuotaByStorageTypeEntryProto) bool {
+		return q.GetStorageType() == typ
+	})
+	if quota != quotaReset {
+		quotas = append(quotas, &pb.INodeSection_QuotaByStorageTypeEntryProto{StorageType: typ.Enum(), Quota: proto.Uint64(uint64(quota))})
+	}
+	dir.TypeQuotas.Quotas = quotas
+	if len(quotas) == 0 {
+		dir.TypeQuotas = nil
+	}
+}
+
+// truncate cuts a file to newLength. Off a block boundary the last
+// block is replaced by the truncate block and the file stays under
+// construction until recovery closes it.
+func truncate(file *pb.INodeSection_INodeFile, op *EditOp) {
+	var kept []*hd.BlockProto
+	var size uint64
+	for _, b := range file.GetBlocks() {
+		if size >= uint64(op.NewLength) {
+			break
+		}
+		kept = append(kept, b)
+		size += b.GetNumBytes()
+	}
+	file.Blocks = kept
+	file.ModificationTime = proto.Uint64(uint64(op.Mtime))
+	if size == uint64(op.NewLength) {
+		return
+	}
+	last := kept[len(kept)-1]
+	if len(op.Blocks) > 0 {
+		kept[len(kept)-1] = editBlocks(op.Blocks)[0]
+	} else {
+		last.NumBytes = proto.Uint64(last.GetNumBytes() - (size - uint64(op.NewLength)))
+	}
+	file.FileUC = &pb.INodeSection_FileUnderConstructionFeature{ClientName: proto.String(op.ClientName), ClientMachine: proto.String(op.ClientMachine)}
+}
+
+// apply replays one op as FSEditLogLoader.applyEditLogOp does, as far
+// as the namespace in the image goes. It reports false for ops that do
+// not change it: log segment markers, block and generation stamp
+// counters, snapshots, tokens, cache directives and erasure coding
+// policies.
+func (t *treeEditor) apply(op *EditOp) (bool, error) {
+	switch op.Code {
+	case opAdd:
+		existing, err := t.resolve(op.Path)
+		if err != nil {
+			_, err := t.newINode(op)
+			return true, err
+		}
+		file := existing.GetFile()
+		if file == nil {
+			return true, fmt.Errorf("%s: not a file", op.Path)
+		}
+		if op.Overwrite {
+			// detach the old file while the new one is made, and put it
+			// back when that fails
+			parent := inodeData[t.parents[existing.GetId()]]
+			t.removeChild(existing)
+			if _, err := t.newINode(op); err != nil {
+				return true, errors.Join(err, t.addChild(parent, existing))
+			}
+			t.deleteSubtree(existing)
+			return true, nil
+		}
+		// an old-style append reopens the file
+		if file.FileUC == nil {
+			file.FileUC = &pb.INodeSection_FileUnderConstructionFeature{ClientName: proto.String(op.ClientName), ClientMachine: proto.String(op.ClientMachine)}
+		}
+		file.AccessTime, file.ModificationTime = proto.Uint64(uint64(op.Atime)), proto.Uint64(uint64(op.Mtime))
+		file.Blocks = editBlocks(op.Blocks)
+	case opClose:
+		inode, err := t.resolveType(op.Path, pb.INodeSection_INode_FILE)
+		if err != nil {
+			return true, err
+		}
+		file := inode.GetFile()
+		file.AccessTime, file.ModificationTime = proto.Uint64(uint64(op.Atime)), proto.Uint64(uint64(op.Mtime))
+		file.Blocks = editBlocks(op.Blocks)
+		file.FileUC = nil
+	case opAppend:
+		inode, err := t.resolveType(op.Path, pb.INodeSection_INode_FILE)
+		if err != nil {
+			return true, err
+		}
+		inode.GetFile().FileUC = &pb.INodeSection_FileUnderConstructionFeature{ClientName: proto.String(op.ClientName), ClientMachine: proto.String(op.ClientMachine)}
+	case opAddBlock:
+		inode, err := t.resolveType(op.Path, pb.INodeSection_INode_FILE)
+		if err != nil {
+			return true, err
+		}
+		file := inode.GetFile()
+		blocks := editBlocks(op.Blocks)
+		if len(blocks) == 0 {
+			return true, fmt.Errorf("%s: no block to add", op.Path)
+		}
+		if len(blocks) == 2 {
+			// the penultimate block is committed with its final size
+			if n := len(file.Blocks); n == 0 || file.Blocks[n-1].GetBlockId() != blocks[0].GetBlockId() {
+				return true, fmt.Errorf("%s: penultimate block %d is not the last block of the file", op.Path, blocks[0].GetBlockId())
+			}
+			file.Blocks[len(file.Blocks)-1] = blocks[0]
+		}
+		file.Blocks = append(file.Blocks, blocks[len(blocks)-1])
+	case opUpdateBlocks:
+		inode, err := t.resolveType(op.Path, pb.INodeSection_INode_FILE)
+		if err != nil {
+			return true, err
+		}
+		inode.GetFile().Blocks = editBlocks(op.Blocks)
+	case opTruncate:
+		inode, err := t.resolveType(op.Path, pb.INodeSection_INode_FILE)
+		if err != nil {
+			return true, err
+		}
+		if uint64(op.NewLength) > getFileSize(inode.GetFile()) {
+			return true, fmt.Errorf("%s: cannot truncate to %d, the file is shorter", op.Path, op.NewLength)
+		}
+		truncate(inode.GetFile(), op)
+	case opReassignLease:
+		inode, err := t.resolveType(op.Path, pb.INodeSection_INode_FILE)
+		if err != nil {
+			return true, err
+		}
+		if inode.GetFile().FileUC == nil {
+			return true, fmt.Errorf("%s: not under construction", op.Path)
+		}
+		inode.GetFile().FileUC.ClientName = proto.String(op.ClientName)
+	case opMkdir, opSymlink:
+		_, err := t.newINode(op)
+		return true, err
+	case opDelete:
+		inode, err := t.resolve(op.Path)
+		if err != nil {
+			return true, err
+		}
+		if inode.GetId() == ROOT_INODE_ID {
+			return true, errors.New("cannot delete the root")
+		}
+		parent := inodeData[t.parents[inode.GetId()]]
+		t.deleteSubtree(inode)
+		touchDir(parent, op.Mtime)
+	case opRename, opRenameOld:
+		return true, t.rename(op)
+	case opConcatDelete:
+		target, err := t.resolveType(op.Path, pb.INodeSection_INode_FILE)
+		if err != nil {
+			return true, err
+		}
+		var srcs []*pb.INodeSection_INode
+		for _, src := range op.Srcs {
+			inode, err := t.resolveType(src, pb.INodeSection_INode_FILE)
+			if err != nil {
+				return true, err
+			}
+			srcs = append(srcs, inode)
+		}
+		file := target.GetFile()
+		for _, src := range srcs {
+			file.Blocks = append(file.Blocks, src.GetFile().GetBlocks()...)
+			t.deleteSubtree(src)
+		}
+		file.ModificationTime = proto.Uint64(uint64(op.Mtime))
+		touchDir(inodeData[t.parents[target.GetId()]], op.Mtime)
+	case opSetReplication:
+		inode, err := t.resolveType(op.Path, pb.INodeSection_INode_FILE)
+		if err != nil {
+			return true, err
+		}
+		if inode.GetFile().GetBlockType() == hd.BlockTypeProto_STRIPED {
+			return true, fmt.Errorf("%s: erasure coded files have no replication", op.Path)
+		}
+		inode.GetFile().Replication = proto.Uint32(uint32(op.Replication))
+	case opSetPermissions:
+		inode, err := t.resolve(op.Path)
+		if err != nil {
+			return true, err
+		}
+		perm := permissionField(inode)
+		*perm = proto.Uint64(**perm&^0xFFFF | uint64(op.Mode))
+	case opSetOwner:
+		inode, err := t.resolve(op.Path)
+		if err != nil {
+			return true, err
+		}
+		perm := permissionField(inode)
+		v := **perm
+		if op.User != "" {
+			v = v&^(0xFFFFFF<<40) | uint64(t.intern(op.User, 0x20000000))<<40
+		}
+		if op.Group != "" {
+			v = v&^(0xFFFFFF<<16) | uint64(t.intern(op.Group, 0x40000000))<<16
+		}
+		*perm = proto.Uint64(v)
+	case opTimes:
+		inode, err := t.resolve(op.Path)
+		if err != nil {
+			return true, err
+		}
+		var mtime, atime **uint64
+		switch inode.GetType() {
+		case pb.INodeSection_INode_FILE:
+			mtime, atime = &inode.GetFile().ModificationTime, &inode.GetFile().AccessTime
+		case pb.INodeSection_INode_DIRECTORY:
+			mtime = &inode.GetDirectory().ModificationTime
+		case pb.INodeSection_INode_SYMLINK:
+			mtime, atime = &inode.GetSymlink().ModificationTime, &inode.GetSymlink().AccessTime
+		}
+		if op.Mtime != -1 {
+			*mtime = proto.Uint64(uint64(op.Mtime))
+		}
+		if op.Atime != -1 && atime != nil {
+			*atime = proto.Uint64(uint64(op.Atime))
+		}
+	case opSetQuota, opSetNSQuota, opClearNSQuota:
+		inode, err := t.resolveType(op.Path, pb.INodeSection_INode_DIRECTORY)
+		if err != nil {
+			return true, err
+		}
+		switch op.Code {
+		case opSetQuota:
+			setQuota(inode.GetDirectory(), op.NsQuota, op.DsQuota)
+		case opSetNSQuota:
+			setQuota(inode.GetDirectory(), op.NsQuota, quotaDontSet)
+		default:
+			setQuota(inode.GetDirectory(), quotaReset, quotaDontSet)
+		}
+	case opSetQuotaByStorageType:
+		inode, err := t.resolveType(op.Path, pb.INodeSection_INode_DIRECTORY)
+		if err != nil {
+			return true, err
+		}
+		setTypeQuota(inode.GetDirectory(), op.StorageType, op.DsQuota)
+	case opSetStoragePolicy:
+		inode, err := t.resolve(op.Path)
+		if err != nil {
+			return true, err
+		}
+		if file := inode.GetFile(); file != nil {
+			file.StoragePolicyID = proto.Uint32(uint32(uint8(op.StoragePolicy)))
+			return true, nil
+		}
+		return true, t.setXAttr(inode, &hd.XAttrProto{Namespace: hd.XAttrProto_SYSTEM.Enum(),
+			Name: proto.String(storagePolicyXAttr), Value: []byte{byte(op.StoragePolicy)}})
+	case opSetAcl:
+		inode, err := t.resolve(op.Path)
+		if err != nil {
+			return true, err
+		}
+		return true, t.setAcl(inode, op.Acl)
+	case opSetXAttr, opRemoveXAttr:
+		inode, err := t.resolve(op.Path)
+		if err != nil {
+			return true, err
+		}
+		for _, x := range op.XAttrs {
+			if op.Code == opSetXAttr {
+				err = t.setXAttr(inode, x)
+			} else {
+				err = t.removeXAttr(inode, x)
+			}
+			if err != nil {
+				return true, err
+			}
+		}
+	default:
+		return false, nil
+	}
+	return true, nil
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	hd "hdfs-fsimage-parse-go/pkg/hadoop_hdfs"
+	pb "hdfs-fsimage-parse-go/pkg/hadoop_hdfs_fsimage"
+
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	testEditTime  = 1704067200000 // 2024-01-01, after every time in the generated image
+	testEditInode = 1 << 30
+)
+
+// testEditOps is a segment of transactions 1001 on, after the generated
+// image. Renaming /t/a into /t/b fails, /t/b/a exists.
+func testEditOps() []*EditOp {
+	dirPerm := &EditPermission{User: "hdfs", Group: "supergroup", Mode: 0o755}
+	filePerm := &EditPermission{User: "etl", Group: "hadoop", Mode: 0o644}
+	rpcId := bytes.Repeat([]byte{1}, 16)
+	mkdir := func(id int64, path string) *EditOp {
+		return &EditOp{Code: opMkdir, InodeId: testEditInode + id, Path: path, Mtime: testEditTime, Atime: testEditTime, Permissions: dirPerm}
+	}
+	ops := []*EditOp{
+		{Code: opStartLogSegment},
+		mkdir(0, "/t"),
+		mkdir(1, "/t/a"),
+		mkdir(2, "/t/b"),
+		mkdir(3, "/t/b/a"),
+		mkdir(4, "/t/c"),
+		{Code: opAdd, InodeId: testEditInode + 5, Path: "/t/b/f", Replication: 3, Mtime: testEditTime, Atime: testEditTime,
+			BlockSize: 128 << 20, Permissions: filePerm,
+			Acl: []*hd.AclEntryProto{
+				aclEntry(hd.AclEntryProto_USER, "", hd.AclEntryProto_READ_WRITE),
+				aclEntry(hd.AclEntryProto_USER, "bob", hd.AclEntryProto_READ),
+				aclEntry(hd.AclEntryProto_GROUP, "", hd.AclEntryProto_READ),
+				aclEntry(hd.AclEntryProto_MASK, "", hd.AclEntryProto_READ),
+				aclEntry(hd.AclEntryProto_OTHER, "", hd.AclEntryProto_NONE),
+			},
+			XAttrs:     []*hd.XAttrProto{{Namespace: hd.XAttrProto_USER.Enum(), Name: proto.String("origin"), Value: []byte("test")}},
+			ClientName: "DFSClient_1", ClientMachine: "10.0.0.1", RpcClientId: rpcId, RpcCallId: 7},
+		{Code: opAllocateBlockId, Value: 1 << 31},
+		{Code: opClose, Path: "/t/b/f", Replication: 3, Mtime: testEditTime + 1, Atime: testEditTime + 1, BlockSize: 128 << 20,
+			Blocks: []EditBlock{{Id: 1 << 31, NumBytes: 1000, GenStamp: 5000}}, Permissions: filePerm},
+		{Code: opRenameOld, Path: "/t/a", Dst: "/t/b", Mtime: testEditTime + 2, RpcClientId: rpcId, RpcCallId: 8},
+		{Code: opRenameOld, Path: "/t/c", Dst: "/t/b", Mtime: testEditTime + 3, RpcClientId: rpcId, RpcCallId: 9},
+		{Code: opRename, Path: "/t/b/f", Dst: "/t/f", Mtime: testEditTime + 4, RenameOptions: []byte{0}, RpcClientId: rpcId, RpcCallId: 10},
+		{Code: opSetQuota, Path: "/t", NsQuota: 100, DsQuota: 1 << 30},
+		{Code: opSetQuotaByStorageType, Path: "/t", StorageType: hd.StorageTypeProto_SSD, DsQuota: 1 << 20},
+		{Code: opSetXAttr, Path: "/t/b", XAttrs: []*hd.XAttrProto{{Namespace: hd.XAttrProto_USER.Enum(), Name: proto.String("tag"), Value: []byte("v")}},
+			RpcClientId: rpcId, RpcCallId: 11},
+		{Code: opDelete, Path: "/dir1", Mtime: testEditTime + 5, RpcClientId: rpcId, RpcCallId: 12},
+		{Code: opEndLogSegment},
+	}
+	for i, op := range ops {
+		op.TxId = 1001 + int64(i)
+	}
+	return ops
+}
+
+func aclEntry(typ hd.AclEntryProto_AclEntryTypeProto, name string, perm hd.AclEntryProto_FsActionProto) *hd.AclEntryProto {
+	e := &hd.AclEntryProto{Type: typ.Enum(), Scope: hd.AclEntryProto_ACCESS.Enum(), Permissions: perm.Enum()}
+	if name != "" {
+		e.Name = proto.String(name)
+	}
+	return e
+}
+
+// writeTestEdits writes ops as a finalized segment into dir.
+func writeTestEdits(t *testing.T, dir string, ops []*EditOp) string {
+	t.Helper()
+	fileName := filepath.Join(dir, fmt.Sprintf("edits_%019d-%019d", ops[0].TxId, ops[len(ops)-1].TxId))
+	var buf bytes.Buffer
+	w, err := NewEditLogWriter(&buf, layoutSnapshotModificationTime)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, op := range ops {
+		if err := w.WriteOp(op); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(fileName, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return fileName
+}
+
+func TestReadEditLog(t *testing.T) {
+	ops := testEditOps()
+	fileName := writeTestEdits(t, t.TempDir(), ops)
+	var got []*EditOp
+	version, err := readEditLog(fileName, func(op *EditOp) error {
+		got = append(got, op)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version != layoutSnapshotModificationTime {
+		t.Errorf("layout version %d, want %d", version, layoutSnapshotModificationTime)
+	}
+	if len(got) != len(ops) {
+		t.Fatalf("read %d ops, wrote %d", len(got), len(ops))
+	}
+	for i, op := range got {
+		want := ops[i]
+		if op.Code != want.Code || op.TxId != want.TxId {
+			t.Errorf("op %d is %s txid %d, want %s txid %d", i, op.Code, op.TxId, want.Code, want.TxId)
+			continue
+		}
+		path, details := op.describe()
+		wantPath, wantDetails := want.describe()
+		if path != wantPath || details != wantDetails {
+			t.Errorf("txid %d %s: read %q %q, want %q %q", op.TxId, op.Code, path, details, wantPath, wantDetails)
+		}
+	}
+}
+
+func TestReplayEdits(t *testing.T) {
+	fileName := writeTestImage(t, testGenerateOptions())
+	editsDir := t.TempDir()
+	writeTestEdits(t, editsDir, testEditOps())
+	editsOptions = EditsOptions{Paths: []string{editsDir}}
+	t.Cleanup(func() { editsOptions = EditsOptions{} })
+
+	f, sectionMap, err := openImage(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	ns, err := loadNamespace(f, sectionMap)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var paths []string
+	ns.Walk(nil, func(inode *pb.INodeSection_INode, p string) {
+		paths = append(paths, p)
+	})
+	// the failed rename leaves /t/a where it was
+	for _, p := range []string{"/t/a", "/t/b/a", "/t/b/c", "/t/f"} {
+		if !slices.Contains(paths, p) {
+			t.Errorf("%s is missing after replay", p)
+		}
+	}
+	for _, p := range []string{"/t/c", "/t/b/f", "/dir1"} {
+		if slices.Contains(paths, p) {
+			t.Errorf("%s is still there after replay", p)
+		}
+	}
+
+	dir := inodeData[testEditInode].GetDirectory()
+	if dir.GetNsQuota() != 100 || dir.GetDsQuota() != 1<<30 {
+		t.Errorf("/t quotas are ns %d ds %d, want 100 and %d", dir.GetNsQuota(), dir.GetDsQuota(), 1<<30)
+	}
+	if q := dir.GetTypeQuotas().GetQuotas(); len(q) != 1 || q[0].GetStorageType() != hd.StorageTypeProto_SSD || q[0].GetQuota() != 1<<20 {
+		t.Errorf("/t storage type quotas are %v, want SSD %d", q, 1<<20)
+	}
+	file := inodeData[testEditInode+5].GetFile()
+	if file.GetFileUC() != nil || len(file.GetBlocks()) != 1 || file.GetBlocks()[0].GetNumBytes() != 1000 {
+		t.Errorf("/t/f is not closed with its block: %v", file)
+	}
+	if a := inodeData[testEditInode+1]; string(a.GetName()) != "a" {
+		t.Errorf("/t/a is named %q after the failed rename", a.GetName())
+	}
+}
+
+// TestReplayOverwrite checks that a rename or create that replaces its
+// destination leaves it alone when the op fails.
+func TestReplayOverwrite(t *testing.T) {
+	fileName := writeTestImage(t, testGenerateOptions())
+	perm := &EditPermission{User: "hdfs", Group: "supergroup", Mode: 0o755}
+	mkdir := func(id int64, path string) *EditOp {
+		return &EditOp{Code: opMkdir, InodeId: testEditInode + id, Path: path, Mtime: testEditTime, Atime: testEditTime, Permissions: perm}
+	}
+	add := func(id int64, path string) *EditOp {
+		return &EditOp{Code: opAdd, InodeId: testEditInode + id, Path: path, Replication: 3, Mtime: testEditTime, Atime: testEditTime,
+			BlockSize: 128 << 20, Permissions: perm, Overwrite: true, ClientName: "DFSClient_1", ClientMachine: "10.0.0.1"}
+	}
+	overwrite := func(src, dst string) *EditOp {
+		return &EditOp{Code: opRename, Path: src, Dst: dst, Mtime: testEditTime + 1, RenameOptions: []byte{1}}
+	}
+	badAcl := add(4, "/o/f")
+	badAcl.Acl = []*hd.AclEntryProto{aclEntry(hd.AclEntryProto_USER, "bob", hd.AclEntryProto_READ)}
+	ops := []*EditOp{
+		{Code: opStartLogSegment},
+		mkdir(0, "/o"),
+		mkdir(1, "/o/d"),
+		add(2, "/o/f"),
+		mkdir(3, "/o/e"),
+		overwrite("/o/f", "/o/d"), // a file over a directory
+		overwrite("/o/d", "/o/f"), // a directory over a file
+		overwrite("/o", "/o/d"),   // below itself
+		badAcl,
+		overwrite("/o/e", "/o/d"),
+		{Code: opEndLogSegment},
+	}
+	for i, op := range ops {
+		op.TxId = 1001 + int64(i)
+	}
+	editsDir := t.TempDir()
+	writeTestEdits(t, editsDir, ops)
+	editsOptions = EditsOptions{Paths: []string{editsDir}}
+	t.Cleanup(func() { editsOptions = EditsOptions{} })
+
+	f, sectionMap, err := openImage(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	ns, err := loadNamespace(f, sectionMap)
+	if err != nil {
+		t.Fatal(err)
+	}
+	paths := map[string]uint64{}
+	ns.Walk(nil, func(inode *pb.INodeSection_INode, p string) {
+		paths[p] = inode.GetId()
+	})
+	want := map[string]uint64{"/o/d": testEditInode + 3, "/o/f": testEditInode + 2}
+	for p, id := range want {
+		if paths[p] != id {
+			t.Errorf("%s is inode %d, want %d", p, paths[p], id)
+		}
+	}
+	if _, ok := paths["/o/e"]; ok {
+		t.Errorf("/o/e is still there after it replaced /o/d")
+	}
+	if _, ok := inodeData[testEditInode+1]; ok {
+		t.Errorf("the replaced /o/d is still loaded")
+	}
+}
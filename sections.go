@@ -0,0 +1,54 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"text/tabwriter"
+
+	pb "hdfs-fsimage-parse-go/pkg/hadoop_hdfs_fsimage"
+)
+
+// runSections implements the `sections` subcommand, the FileSummary
+// section table in file order.
+func runSections(args []string) {
+	fs := flag.NewFlagSet("sections", flag.ExitOnError)
+	count := fs.Bool("count", true, "count the records of every section, which reads the whole image")
+	fs.Usage = commandUsage(fs, "[flags] <fsimage>")
+	registerLogFlags(fs)
+	parseArgs(fs, args, 1)
+
+	fileName := fs.Arg(0)
+	f, err := os.Open(fileName)
+	logIfErr(err)
+	defer f.Close()
+	fInfo, err := f.Stat()
+	logIfErr(err)
+	summary, _, err := readFileSummary(f, fInfo.Size())
+	if err != nil {
+		log.Fatalf("%s: %v", fileName, err)
+	}
+
+	sections := append([]*pb.FileSummary_Section(nil), summary.GetSections()...)
+	sort.SliceStable(sections, func(i, j int) bool { return sections[i].GetOffset() < sections[j].GetOffset() })
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "Name\tOffset\tLength\tPercent\tRecords")
+	for _, s := range sections {
+		records := "-" // compressed sections are not framed as records on disk
+		if summary.GetCodec() == "" && *count {
+			n, err := countRecords(s, f)
+			records = strconv.Itoa(n)
+			if err != nil {
+				log.Print(err)
+				records += "?"
+			}
+		}
+		percent := 100 * float64(s.GetLength()) / float64(fInfo.Size())
+		fmt.Fprintf(w, "%s\t%d\t%d\t%.1f%%\t%s\n", s.GetName(), s.GetOffset(), s.GetLength(), percent, records)
+	}
+	logIfErr(w.Flush())
+}
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	pb "hdfs-fsimage-parse-go/pkg/hadoop_hdfs_fsimage"
+)
+
+// Partition columns for -partition-by.
+const (
+	partitionTopDir = "top_dir"
+	partitionUser   = "user"
+)
+
+// hiveDefaultPartition is Hive's directory for a null partition value,
+// used for the root, which has no top-level directory.
+const hiveDefaultPartition = "__HIVE_DEFAULT_PARTITION__"
+
+const manifestName = "_manifest.json"
+
+// SplitOptions select how an export is spread over several files.
+type SplitOptions struct {
+	Rows        int64
+	Size        string
+	PartitionBy string
+	MaxOpen     int
+}
+
+func registerSplitFlags(fs *flag.FlagSet, opts *SplitOptions) {
+	fs.Int64Var(&opts.Rows, "split-rows", 0, "start a new part file after this many rows")
+	fs.StringVar(&opts.Size, "split-size", "", "start a new part file after this much uncompressed output, e.g. 256M")
+	fs.StringVar(&opts.PartitionBy, "partition-by", "", "write a Hive-style directory per value of: top_dir or user")
+	fs.IntVar(&opts.MaxOpen, "max-open-partitions", 64, "part files kept open at once; the least recently used one is finished when more are needed")
+}
+
+func (o SplitOptions) enabled() bool {
+	return o.Rows > 0 || o.Size != "" || o.PartitionBy != ""
+}
+
+// partitionKey returns the partition value of an inode.
+func (o SplitOptions) partitionKey(inode *pb.INodeSection_INode, path string) string {
+	switch o.PartitionBy {
+	case partitionTopDir:
+		top, _, _ := strings.Cut(strings.TrimPrefix(path, "/"), "/")
+		return top
+	case partitionUser:
+		return decodePermission(inodePermission(inode)).UserName
+	}
+	return ""
+}
+
+// ManifestFile is one part file, relative to the output directory.
+type ManifestFile struct {
+	Path      string `json:"path"`
+	Partition string `json:"partition,omitempty"`
+	Rows      int64  `json:"rows"`
+	Bytes     int64  `json:"bytes"` // uncompressed, including the header
+}
+
+// Manifest is written as _manifest.json next to the part files once
+// every part is complete.
+type Manifest struct {
+	Image       string         `json:"image"`
+	Format      string         `json:"format"`
+	Compression string         `json:"compression"`
+	PartitionBy string         `json:"partition_by,omitempty"`
+	Columns     []string       `json:"columns"`
+	Rows        int64          `json:"rows"`
+	Files       []ManifestFile `json:"files"`
+}
+
+// partFile is an open part file.
+type partFile struct {
+	manifestIndex int
+	out           io.WriteCloser
+	w             *bufio.Writer
+	lastUse       uint64
+}
+
+// splitWriter writes rows into part files under dir, rolling them by
+// row count or size and keeping one sequence of parts per partition.
+type splitWriter struct {
+	dir      string
+	opts     SplitOptions
+	maxBytes int64
+	outOpts  OutputOptions
+	ext      string
+	header   string
+
+	open     map[string]*partFile
+	nextPart map[string]int
+	tick     uint64
+	manifest Manifest
+}
+
+func newSplitWriter(dir, image, header string, opts SplitOptions, outOpts OutputOptions) (*splitWriter, error) {
+	switch opts.PartitionBy {
+	case "", partitionTopDir, partitionUser:
+	default:
+		return nil, fmt.Errorf("unknown -partition-by %q (want %s or %s)", opts.PartitionBy, partitionTopDir, partitionUser)
+	}
+	var maxBytes int64
+	if opts.Size != "" {
+		size, err := parseSize(opts.Size)
+		if err != nil {
+			return nil, err
+		}
+		maxBytes = int64(size)
+	}
+	compression, err := outOpts.compression("")
+	if err != nil {
+		return nil, err
+	}
+	outOpts.Compression = compression
+
+	if entries, err := os.ReadDir(dir); err == nil && len(entries) > 0 {
+		return nil, fmt.Errorf("output directory %s is not empty", dir)
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	return &splitWriter{
+		dir:      dir,
+		opts:     opts,
+		maxBytes: maxBytes,
+		outOpts:  outOpts,
+		ext:      ".tsv" + compressionExt(compression),
+		header:   header,
+		open:     make(map[string]*partFile),
+		nextPart: make(map[string]int),
+		manifest: Manifest{
+			Image:       image,
+			Format:      "tsv",
+			Compression: compression,
+			PartitionBy: opts.PartitionBy,
+			Columns:     strings.Split(strings.TrimSuffix(header, "\n"), "\t"),
+			Files:       []ManifestFile{},
+		},
+	}, nil
+}
+
+// WriteRow appends one encoded row, ending in a newline, to the current
+// part of partition.
+func (s *splitWriter) WriteRow(partition string, row []byte) error {
+	part := s.open[partition]
+	if part != nil {
+		file := &s.manifest.Files[part.manifestIndex]
+		if (s.opts.Rows > 0 && file.Rows >= s.opts.Rows) ||
+			(s.maxBytes > 0 && file.Rows > 0 && file.Bytes+int64(len(row)) > s.maxBytes) {
+			if err := s.finish(partition); err != nil {
+				return err
+			}
+			part = nil
+		}
+	}
+	if part == nil {
+		var err error
+		if part, err = s.newPart(partition); err != nil {
+			return err
+		}
+	}
+
+	s.tick++
+	part.lastUse = s.tick
+	file := &s.manifest.Files[part.manifestIndex]
+	file.Rows++
+	file.Bytes += int64(len(row))
+	s.manifest.Rows++
+	_, err := part.w.Write(row)
+	return err
+}
+
+func (s *splitWriter) newPart(partition string) (*partFile, error) {
+	if len(s.open) >= max(s.opts.MaxOpen, 1) {
+		lru := ""
+		var oldest uint64
+		for key, part := range s.open {
+			if oldest == 0 || part.lastUse < oldest {
+				lru, oldest = key, part.lastUse
+			}
+		}
+		if err := s.finish(lru); err != nil {
+			return nil, err
+		}
+	}
+
+	dir := ""
+	if s.opts.PartitionBy != "" {
+		dir = s.opts.PartitionBy + "=" + escapePartitionValue(partition)
+		if err := os.MkdirAll(filepath.Join(s.dir, dir), 0o755); err != nil {
+			return nil, err
+		}
+	}
+	rel := filepath.ToSlash(filepath.Join(dir, fmt.Sprintf("part-%05d%s", s.nextPart[partition], s.ext)))
+	s.nextPart[partition]++
+
+	out, err := createOutput(filepath.Join(s.dir, rel), s.outOpts)
+	if err != nil {
+		return nil, err
+	}
+	part := &partFile{manifestIndex: len(s.manifest.Files), out: out, w: bufio.NewWriterSize(out, 1<<20)}
+	s.manifest.Files = append(s.manifest.Files, ManifestFile{Path: rel, Partition: partition, Bytes: int64(len(s.header))})
+	s.open[partition] = part
+	debugf("writing %s", rel)
+	if _, err := part.w.WriteString(s.header); err != nil {
+		return nil, err
+	}
+	return part, nil
+}
+
+func (s *splitWriter) finish(partition string) error {
+	part := s.open[partition]
+	delete(s.open, partition)
+	if err := part.w.Flush(); err != nil {
+		part.out.Close()
+		return err
+	}
+	return part.out.Close()
+}
+
+// Close finishes every open part and writes the manifest.
+func (s *splitWriter) Close() error {
+	for partition := range s.open {
+		if err := s.finish(partition); err != nil {
+			return err
+		}
+	}
+	data, err := json.MarshalIndent(s.manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := filepath.Join(s.dir, manifestName+".tmp")
+	if err := os.WriteFile(tmp, append(data, '\n'), 0o644); err != nil {
+		return err
+	}
+	infof("wrote %d rows to %d files in %s", s.manifest.Rows, len(s.manifest.Files), s.dir)
+	return os.Rename(tmp, filepath.Join(s.dir, manifestName))
+}
+
+// escapePartitionValue escapes a value for a directory name the way
+// Hive's FileUtils.escapePathName does.
+func escapePartitionValue(v string) string {
+	if v == "" {
+		return hiveDefaultPartition
+	}
+	var b strings.Builder
+	for i := 0; i < len(v); i++ {
+		c := v[i]
+		if c < 0x20 || c == 0x7F || strings.IndexByte("\"#%'*/:=?\\{[]^", c) >= 0 {
+			fmt.Fprintf(&b, "%%%02X", c)
+		} else {
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// writeTSVSplit is writeTSV into part files under dir.
+func writeTSVSplit(ns *Namespace, filter *Filter, dir, image string, splitOpts SplitOptions, outOpts OutputOptions) {
+	s, err := newSplitWriter(dir, image, tsvHeader, splitOpts, outOpts)
+	logIfErr(err)
+
+	var row bytes.Buffer
+	ns.Walk(filter, func(inode *pb.INodeSection_INode, path string) {
+		row.Reset()
+		writeTSVRow(&row, buildRowForINode(inode, path))
+		logIfErr(s.WriteRow(splitOpts.partitionKey(inode, path), row.Bytes()))
+	})
+	logIfErr(s.Close())
+}
@@ -0,0 +1,317 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+
+	pb "hdfs-fsimage-parse-go/pkg/hadoop_hdfs_fsimage"
+
+	_ "modernc.org/sqlite"
+)
+
+// namespaceSchema is the relational model of a parsed image shared by
+// `query` and the SQLite export. Times are epoch millis, quotas are -1
+// when unset. The namespace, files, dirs and symlinks views join each
+// inode with its full path.
+const namespaceSchema = `
+CREATE TABLE strings (
+	id  INTEGER PRIMARY KEY,
+	str TEXT
+);
+CREATE TABLE inodes (
+	id                   INTEGER PRIMARY KEY,
+	parent               INTEGER,
+	name                 TEXT NOT NULL,
+	type                 TEXT NOT NULL,
+	user                 TEXT,
+	grp                  TEXT,
+	permission           TEXT,
+	replication          INTEGER,
+	mtime                INTEGER,
+	atime                INTEGER,
+	preferred_block_size INTEGER,
+	blocks               INTEGER,
+	size                 INTEGER,
+	ns_quota             INTEGER,
+	ds_quota             INTEGER,
+	storage_policy       INTEGER,
+	target               TEXT
+);
+CREATE TABLE paths (
+	inode_id INTEGER PRIMARY KEY,
+	path     TEXT NOT NULL
+);
+CREATE TABLE blocks (
+	block_id   INTEGER,
+	gen_stamp  INTEGER,
+	num_bytes  INTEGER,
+	inode_id   INTEGER,
+	idx        INTEGER,
+	block_type TEXT
+);
+CREATE TABLE acls (
+	inode_id   INTEGER,
+	scope      TEXT,
+	type       TEXT,
+	name       TEXT,
+	permission TEXT
+);
+CREATE TABLE xattrs (
+	inode_id  INTEGER,
+	namespace TEXT,
+	name      TEXT,
+	value     BLOB
+);
+CREATE TABLE snapshots (
+	snapshot_id INTEGER,
+	dir_id      INTEGER,
+	name        TEXT,
+	mtime       INTEGER
+);
+CREATE VIEW namespace AS SELECT p.path, i.* FROM inodes i JOIN paths p ON p.inode_id = i.id;
+CREATE VIEW files AS SELECT * FROM namespace WHERE type = 'file';
+CREATE VIEW dirs AS SELECT * FROM namespace WHERE type = 'dir';
+CREATE VIEW symlinks AS SELECT * FROM namespace WHERE type = 'symlink';
+`
+
+// namespaceIndexes are created after the bulk load. paths_path serves
+// prefix lookups written as `path GLOB '/data/*'`.
+const namespaceIndexes = `
+CREATE INDEX paths_path ON paths(path);
+CREATE INDEX inodes_parent ON inodes(parent);
+CREATE INDEX inodes_user ON inodes(user);
+CREATE INDEX inodes_grp ON inodes(grp);
+CREATE INDEX blocks_block_id ON blocks(block_id);
+CREATE INDEX blocks_inode_id ON blocks(inode_id);
+CREATE INDEX acls_inode_id ON acls(inode_id);
+CREATE INDEX xattrs_inode_id ON xattrs(inode_id);
+`
+
+// sqlBatchSize is the number of inodes inserted per transaction.
+const sqlBatchSize = 100000
+
+func writeSQLite(outputPath string, imageFile *os.File, sectionMap map[string]*pb.FileSummary_Section,
+	ns *Namespace, filter *Filter) {
+	if err := os.Remove(outputPath); err != nil && !os.IsNotExist(err) {
+		logIfErr(err)
+	}
+	db, err := sql.Open("sqlite", outputPath)
+	logIfErr(err)
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	_, err = db.Exec(`PRAGMA journal_mode = OFF; PRAGMA synchronous = OFF; PRAGMA cache_size = -262144;`)
+	logIfErr(err)
+	_, err = db.Exec(namespaceSchema)
+	logIfErr(err)
+
+	snapshots, err := parseSnapshotSection(sectionMap["SNAPSHOT"], imageFile)
+	logIfErr(err)
+
+	logIfErr(loadNamespaceSQL(db, ns, filter))
+	logIfErr(loadStringsSQL(db))
+	logIfErr(loadSnapshotsSQL(db, snapshots))
+
+	_, err = db.Exec(namespaceIndexes)
+	logIfErr(err)
+	_, err = db.Exec(`ANALYZE`)
+	logIfErr(err)
+}
+
+// sqlBatch wraps a transaction that is committed and reopened every
+// sqlBatchSize rows, keeping prepared statements alive across commits.
+type sqlBatch struct {
+	db    *sql.DB
+	tx    *sql.Tx
+	query []string
+	stmts []*sql.Stmt
+	rows  int
+}
+
+func newSQLBatch(db *sql.DB, query ...string) (*sqlBatch, error) {
+	b := &sqlBatch{db: db, query: query}
+	return b, b.begin()
+}
+
+func (b *sqlBatch) begin() error {
+	tx, err := b.db.Begin()
+	if err != nil {
+		return err
+	}
+	b.tx = tx
+	b.stmts = b.stmts[:0]
+	for _, q := range b.query {
+		stmt, err := tx.Prepare(q)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+		b.stmts = append(b.stmts, stmt)
+	}
+	return nil
+}
+
+// Exec runs the i-th prepared statement.
+func (b *sqlBatch) Exec(i int, args ...any) error {
+	_, err := b.stmts[i].Exec(args...)
+	return err
+}
+
+// Row marks the end of one logical row and rolls the transaction when
+// the batch is full.
+func (b *sqlBatch) Row() error {
+	b.rows++
+	if b.rows%sqlBatchSize != 0 {
+		return nil
+	}
+	if err := b.tx.Commit(); err != nil {
+		return err
+	}
+	return b.begin()
+}
+
+func (b *sqlBatch) Commit() error {
+	return b.tx.Commit()
+}
+
+func (b *sqlBatch) Rollback() {
+	b.tx.Rollback()
+}
+
+const (
+	stmtInode = iota
+	stmtPath
+	stmtBlock
+	stmtAcl
+	stmtXAttr
+)
+
+// loadNamespaceSQL inserts every inode passing filter, with its path,
+// blocks, ACL entries and xattrs.
+func loadNamespaceSQL(db *sql.DB, ns *Namespace, filter *Filter) error {
+	parents := ns.Parents()
+
+	batch, err := newSQLBatch(db,
+		`INSERT INTO inodes VALUES (?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?)`,
+		`INSERT INTO paths VALUES (?,?)`,
+		`INSERT INTO blocks VALUES (?,?,?,?,?,?)`,
+		`INSERT INTO acls VALUES (?,?,?,?,?)`,
+		`INSERT INTO xattrs VALUES (?,?,?,?)`,
+	)
+	if err != nil {
+		return err
+	}
+
+	ns.Walk(filter, func(inode *pb.INodeSection_INode, path string) {
+		if err != nil {
+			return
+		}
+		err = insertInodeSQL(batch, inode, path, parents)
+	})
+	if err != nil {
+		batch.Rollback()
+		return err
+	}
+	return batch.Commit()
+}
+
+func insertInodeSQL(batch *sqlBatch, inode *pb.INodeSection_INode, path string, parents map[uint64]uint64) error {
+	id := int64(inode.GetId())
+	var parent any
+	if p, ok := parents[inode.GetId()]; ok {
+		parent = int64(p)
+	}
+	perm := decodePermission(inodePermission(inode))
+
+	var typ, target string
+	var replication, storagePolicy uint32
+	var mtime, atime, blockSize, size uint64
+	var blocks int
+	nsQuota, dsQuota := int64(-1), int64(-1)
+	switch inode.GetType() {
+	case pb.INodeSection_INode_FILE:
+		file := inode.GetFile()
+		typ = "file"
+		replication = file.GetReplication()
+		mtime = file.GetModificationTime()
+		atime = file.GetAccessTime()
+		blockSize = file.GetPreferredBlockSize()
+		blocks = len(file.GetBlocks())
+		size = getFileSize(file)
+		storagePolicy = file.GetStoragePolicyID()
+		for _, b := range inodeBlocks(inode, path) {
+			if err := batch.Exec(stmtBlock, b.BlockId, int64(b.GenStamp), int64(b.NumBytes), id, b.Index, b.BlockType); err != nil {
+				return err
+			}
+		}
+	case pb.INodeSection_INode_DIRECTORY:
+		dir := inode.GetDirectory()
+		typ = "dir"
+		mtime = dir.GetModificationTime()
+		nsQuota = int64(dir.GetNsQuota())
+		dsQuota = int64(dir.GetDsQuota())
+	case pb.INodeSection_INode_SYMLINK:
+		link := inode.GetSymlink()
+		typ = "symlink"
+		mtime = link.GetModificationTime()
+		atime = link.GetAccessTime()
+		target = string(link.GetTarget())
+	}
+
+	err := batch.Exec(stmtInode, id, parent, string(inode.GetName()), typ,
+		perm.UserName, perm.GroupName, perm.Permission, replication,
+		int64(mtime), int64(atime), int64(blockSize), blocks, int64(size),
+		nsQuota, dsQuota, storagePolicy, target)
+	if err != nil {
+		return err
+	}
+	if err := batch.Exec(stmtPath, id, path); err != nil {
+		return err
+	}
+	for _, e := range inodeAcl(inode) {
+		if err := batch.Exec(stmtAcl, id, e.Scope, e.Type, e.Name, e.Permission); err != nil {
+			return err
+		}
+	}
+	for _, x := range inodeXAttrs(inode) {
+		if err := batch.Exec(stmtXAttr, id, x.Namespace, x.Name, x.Value); err != nil {
+			return err
+		}
+	}
+	return batch.Row()
+}
+
+func loadStringsSQL(db *sql.DB) error {
+	batch, err := newSQLBatch(db, `INSERT INTO strings VALUES (?,?)`)
+	if err != nil {
+		return err
+	}
+	for id, str := range stringMap {
+		if err = batch.Exec(0, int64(id), str); err == nil {
+			err = batch.Row()
+		}
+		if err != nil {
+			batch.Rollback()
+			return fmt.Errorf("string %d: %w", id, err)
+		}
+	}
+	return batch.Commit()
+}
+
+func loadSnapshotsSQL(db *sql.DB, snapshots []Snapshot) error {
+	batch, err := newSQLBatch(db, `INSERT INTO snapshots VALUES (?,?,?,?)`)
+	if err != nil {
+		return err
+	}
+	for _, s := range snapshots {
+		if err = batch.Exec(0, int64(s.Id), int64(s.DirId), s.Name, int64(s.Mtime)); err == nil {
+			err = batch.Row()
+		}
+		if err != nil {
+			batch.Rollback()
+			return fmt.Errorf("snapshot %d: %w", s.Id, err)
+		}
+	}
+	return batch.Commit()
+}
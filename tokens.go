@@ -0,0 +1,305 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	pb "hdfs-fsimage-parse-go/pkg/hadoop_hdfs_fsimage"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// SecretManager is the SECRET_MANAGER section: the delegation token
+// master keys and the tokens outstanding when the image was saved.
+type SecretManager struct {
+	CurrentId           uint32
+	TokenSequenceNumber uint32
+	Keys                []*pb.SecretManagerSection_DelegationKey
+	Tokens              []*pb.SecretManagerSection_PersistToken
+}
+
+// parseSecretManagerSection reads the header, then numKeys
+// DelegationKey and numTokens PersistToken records.
+func parseSecretManagerSection(info *pb.FileSummary_Section, imageFile *os.File) (*SecretManager, error) {
+	sm := &SecretManager{}
+	header := &pb.SecretManagerSection{}
+	var index uint32
+	err := forEachRecord(info, imageFile, header, func(record []byte) error {
+		index++
+		if index <= header.GetNumKeys() {
+			key := &pb.SecretManagerSection_DelegationKey{}
+			if err := proto.Unmarshal(record, key); err != nil {
+				return err
+			}
+			sm.Keys = append(sm.Keys, key)
+			return nil
+		}
+		token := &pb.SecretManagerSection_PersistToken{}
+		if err := proto.Unmarshal(record, token); err != nil {
+			return err
+		}
+		sm.Tokens = append(sm.Tokens, token)
+		return nil
+	})
+	sm.CurrentId = header.GetCurrentId()
+	sm.TokenSequenceNumber = header.GetTokenSequenceNumber()
+	if err == nil && (uint32(len(sm.Keys)) != header.GetNumKeys() || uint32(len(sm.Tokens)) != header.GetNumTokens()) {
+		log.Printf("warning: SECRET_MANAGER header lists %d keys and %d tokens, found %d and %d",
+			header.GetNumKeys(), header.GetNumTokens(), len(sm.Keys), len(sm.Tokens))
+	}
+	return sm, err
+}
+
+// tokenExpiryBuckets are the upper bounds of the expiry distribution,
+// relative to the audit time.
+var tokenExpiryBuckets = []struct {
+	label string
+	limit time.Duration
+}{
+	{"within 1 hour", time.Hour},
+	{"within 1 day", 24 * time.Hour},
+	{"within 7 days", 7 * 24 * time.Hour},
+	{"within 30 days", 30 * 24 * time.Hour},
+}
+
+// TokenReport is the result of `tokens`, also its JSON output.
+type TokenReport struct {
+	Image               string         `json:"image"`
+	At                  string         `json:"at"`
+	CurrentKeyId        uint32         `json:"current_key_id"`
+	TokenSequenceNumber uint32         `json:"token_sequence_number"`
+	Keys                []KeyInfo      `json:"keys"`
+	Tokens              int            `json:"tokens"`
+	Expired             int            `json:"expired"`
+	Expiry              []ExpiryBucket `json:"expiry"`
+	ByOwner             []OwnerSummary `json:"by_owner"`
+	TokenList           []TokenInfo    `json:"token_list,omitempty"`
+}
+
+// KeyInfo is a master key. Key is only filled with -include-keys.
+type KeyInfo struct {
+	Id        uint32 `json:"id"`
+	Expiry    string `json:"expiry"`
+	Expired   bool   `json:"expired"`
+	KeyLength int    `json:"key_length"`
+	Key       string `json:"key,omitempty"`
+}
+
+type ExpiryBucket struct {
+	Label  string `json:"label"`
+	Tokens int    `json:"tokens"`
+}
+
+type OwnerSummary struct {
+	Owner       string `json:"owner"`
+	Renewer     string `json:"renewer"`
+	Tokens      int    `json:"tokens"`
+	Expired     int    `json:"expired"`
+	FirstExpiry string `json:"first_expiry"`
+	LastExpiry  string `json:"last_expiry"`
+}
+
+type TokenInfo struct {
+	SequenceNumber uint32 `json:"sequence_number"`
+	Owner          string `json:"owner"`
+	Renewer        string `json:"renewer"`
+	RealUser       string `json:"real_user,omitempty"`
+	IssueDate      string `json:"issue_date"`
+	ExpiryDate     string `json:"expiry_date"`
+	MaxDate        string `json:"max_date"`
+	MasterKeyId    uint32 `json:"master_key_id"`
+	Expired        bool   `json:"expired"`
+}
+
+// runTokens implements the `tokens` subcommand, an audit of the
+// delegation tokens in SECRET_MANAGER.
+func runTokens(args []string) {
+	fs := flag.NewFlagSet("tokens", flag.ExitOnError)
+	format := fs.String("format", "text", "output format: text or json")
+	list := fs.Bool("list", false, "also list every token")
+	includeKeys := fs.Bool("include-keys", false, "include master key material (hex) in the output; it is redacted by default")
+	at := fs.String("at", "", "audit time for expiry, a date (2024-01-31) or an age (7d); default now")
+	output := fs.String("o", "", "write to this file instead of stdout")
+	registerParseFlags(fs)
+	registerLogFlags(fs)
+	fs.Usage = commandUsage(fs, "[flags] <fsimage>",
+		"Master key material is redacted unless -include-keys is given.")
+	parseArgs(fs, args, 1)
+
+	if *format != "text" && *format != "json" {
+		log.Fatalf("unknown format %q (want text or json)", *format)
+	}
+	now := time.Now()
+	atMillis := uint64(now.UnixMilli())
+	if *at != "" {
+		var err error
+		atMillis, err = parseTimeBound(*at, now)
+		logIfErr(err)
+	}
+
+	f, sectionMap, err := openImage(fs.Arg(0))
+	logIfErr(err)
+	defer f.Close()
+	if sectionMap["SECRET_MANAGER"] == nil {
+		log.Printf("%s has no SECRET_MANAGER section", fs.Arg(0))
+	}
+	sm, err := parseSecretManagerSection(sectionMap["SECRET_MANAGER"], f)
+	logIfErr(err)
+
+	report := buildTokenReport(sm, atMillis, *list, *includeKeys)
+	report.Image = fs.Arg(0)
+
+	out, err := createOutput(*output, OutputOptions{})
+	logIfErr(err)
+	if *format == "json" {
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		logIfErr(enc.Encode(report))
+	} else {
+		logIfErr(writeTokenReport(out, report))
+	}
+	logIfErr(out.Close())
+}
+
+func buildTokenReport(sm *SecretManager, at uint64, list, includeKeys bool) *TokenReport {
+	report := &TokenReport{
+		At:                  formatTime(at),
+		CurrentKeyId:        sm.CurrentId,
+		TokenSequenceNumber: sm.TokenSequenceNumber,
+		Keys:                []KeyInfo{},
+		Tokens:              len(sm.Tokens),
+		ByOwner:             []OwnerSummary{},
+	}
+	for _, k := range sm.Keys {
+		info := KeyInfo{Id: k.GetId(), Expiry: formatTime(k.GetExpiryDate()), Expired: k.GetExpiryDate() < at, KeyLength: len(k.GetKey())}
+		if includeKeys {
+			info.Key = hex.EncodeToString(k.GetKey())
+		}
+		report.Keys = append(report.Keys, info)
+	}
+
+	buckets := make([]int, len(tokenExpiryBuckets)+1)
+	type ownerKey struct{ owner, renewer string }
+	type ownerStats struct {
+		tokens, expired int
+		first, last     uint64
+	}
+	owners := make(map[ownerKey]*ownerStats)
+	for _, t := range sm.Tokens {
+		expiry := t.GetExpiryDate()
+		expired := expiry < at
+		if expired {
+			report.Expired++
+		} else {
+			i := 0
+			for i < len(tokenExpiryBuckets) && time.Duration(expiry-at)*time.Millisecond > tokenExpiryBuckets[i].limit {
+				i++
+			}
+			buckets[i]++
+		}
+
+		key := ownerKey{t.GetOwner(), t.GetRenewer()}
+		s := owners[key]
+		if s == nil {
+			s = &ownerStats{first: expiry, last: expiry}
+			owners[key] = s
+		}
+		s.tokens++
+		if expired {
+			s.expired++
+		}
+		s.first, s.last = min(s.first, expiry), max(s.last, expiry)
+
+		if list {
+			report.TokenList = append(report.TokenList, TokenInfo{
+				SequenceNumber: t.GetSequenceNumber(),
+				Owner:          t.GetOwner(),
+				Renewer:        t.GetRenewer(),
+				RealUser:       t.GetRealUser(),
+				IssueDate:      formatTime(t.GetIssueDate()),
+				ExpiryDate:     formatTime(expiry),
+				MaxDate:        formatTime(t.GetMaxDate()),
+				MasterKeyId:    t.GetMasterKeyId(),
+				Expired:        expired,
+			})
+		}
+	}
+
+	report.Expiry = append(report.Expiry, ExpiryBucket{"expired", report.Expired})
+	for i, b := range tokenExpiryBuckets {
+		report.Expiry = append(report.Expiry, ExpiryBucket{b.label, buckets[i]})
+	}
+	report.Expiry = append(report.Expiry, ExpiryBucket{"later", buckets[len(tokenExpiryBuckets)]})
+
+	for key, s := range owners {
+		report.ByOwner = append(report.ByOwner, OwnerSummary{
+			Owner:       key.owner,
+			Renewer:     key.renewer,
+			Tokens:      s.tokens,
+			Expired:     s.expired,
+			FirstExpiry: formatTime(s.first),
+			LastExpiry:  formatTime(s.last),
+		})
+	}
+	sort.Slice(report.ByOwner, func(i, j int) bool {
+		a, b := report.ByOwner[i], report.ByOwner[j]
+		if a.Tokens != b.Tokens {
+			return a.Tokens > b.Tokens
+		}
+		if a.Owner != b.Owner {
+			return a.Owner < b.Owner
+		}
+		return a.Renewer < b.Renewer
+	})
+	sort.Slice(report.TokenList, func(i, j int) bool {
+		return report.TokenList[i].SequenceNumber < report.TokenList[j].SequenceNumber
+	})
+	return report
+}
+
+func writeTokenReport(out io.Writer, r *TokenReport) error {
+	w := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(w, "Audit time:\t%s UTC\n", r.At)
+	fmt.Fprintf(w, "Current key id:\t%d\n", r.CurrentKeyId)
+	fmt.Fprintf(w, "Token sequence number:\t%d\n", r.TokenSequenceNumber)
+	fmt.Fprintf(w, "Master keys:\t%d\n", len(r.Keys))
+	fmt.Fprintf(w, "Tokens:\t%d (%d expired)\n", r.Tokens, r.Expired)
+
+	fmt.Fprintf(w, "\nExpiry\tTokens\n")
+	for _, b := range r.Expiry {
+		fmt.Fprintf(w, "%s\t%d\n", b.Label, b.Tokens)
+	}
+
+	fmt.Fprintf(w, "\nOwner\tRenewer\tTokens\tExpired\tFirstExpiry\tLastExpiry\n")
+	for _, o := range r.ByOwner {
+		fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%s\t%s\n", convertSpecialSymbols(o.Owner), convertSpecialSymbols(o.Renewer),
+			o.Tokens, o.Expired, o.FirstExpiry, o.LastExpiry)
+	}
+
+	fmt.Fprintf(w, "\nKeyId\tExpiry\tExpired\tKey\n")
+	for _, k := range r.Keys {
+		key := k.Key
+		if key == "" {
+			key = fmt.Sprintf("<redacted, %d bytes>", k.KeyLength)
+		}
+		fmt.Fprintf(w, "%d\t%s\t%t\t%s\n", k.Id, k.Expiry, k.Expired, key)
+	}
+
+	if len(r.TokenList) > 0 {
+		fmt.Fprintf(w, "\nSequence\tOwner\tRenewer\tRealUser\tIssued\tExpiry\tMaxDate\tKeyId\tExpired\n")
+		for _, t := range r.TokenList {
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\t%s\t%d\t%t\n", t.SequenceNumber,
+				convertSpecialSymbols(t.Owner), convertSpecialSymbols(t.Renewer), convertSpecialSymbols(t.RealUser),
+				t.IssueDate, t.ExpiryDate, t.MaxDate, t.MasterKeyId, t.Expired)
+		}
+	}
+	return w.Flush()
+}
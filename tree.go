@@ -0,0 +1,154 @@
+package main
+
+import (
+	"sort"
+
+	pb "hdfs-fsimage-parse-go/pkg/hadoop_hdfs_fsimage"
+)
+
+// Namespace is the directory structure from INODE_DIR in compressed
+// sparse row form: the children of dirs[i] are children[start[i]:start[i+1]].
+// Names are not copied, they are read from inodeData when a path is built.
+type Namespace struct {
+	dirs     []uint64 // parent inode ids, sorted after finish
+	start    []uint64 // len(dirs)+1 offsets into children
+	children []uint64
+
+	// refChildren are INODE_REFERENCE indexes of children renamed under
+	// a snapshot; they are rare, so they are kept sparse.
+	refChildren map[uint64][]uint32
+}
+
+// addDirEntry appends one INODE_DIR record. A parent may appear in
+// several records, their children are concatenated in order.
+func (ns *Namespace) addDirEntry(parent uint64, children []uint64, refChildren []uint32) {
+	ns.dirs = append(ns.dirs, parent)
+	ns.start = append(ns.start, uint64(len(ns.children)))
+	ns.children = append(ns.children, children...)
+	if len(refChildren) > 0 {
+		if ns.refChildren == nil {
+			ns.refChildren = make(map[uint64][]uint32)
+		}
+		ns.refChildren[parent] = append(ns.refChildren[parent], refChildren...)
+	}
+}
+
+// finish sorts the records by parent id so Children can binary search.
+func (ns *Namespace) finish() {
+	ns.start = append(ns.start, uint64(len(ns.children)))
+	if sort.SliceIsSorted(ns.dirs, func(i, j int) bool { return ns.dirs[i] < ns.dirs[j] }) {
+		return
+	}
+
+	order := make([]int, len(ns.dirs))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool { return ns.dirs[order[i]] < ns.dirs[order[j]] })
+
+	dirs := make([]uint64, 0, len(ns.dirs))
+	start := make([]uint64, 0, len(ns.start))
+	children := make([]uint64, 0, len(ns.children))
+	for _, i := range order {
+		dirs = append(dirs, ns.dirs[i])
+		start = append(start, uint64(len(children)))
+		children = append(children, ns.children[ns.start[i]:ns.start[i+1]]...)
+	}
+	ns.dirs, ns.start, ns.children = dirs, append(start, uint64(len(children))), children
+}
+
+// Children returns the child ids of a directory, sharing the backing
+// array. Multiple INODE_DIR records for one parent are merged.
+func (ns *Namespace) Children(id uint64) []uint64 {
+	i := sort.Search(len(ns.dirs), func(i int) bool { return ns.dirs[i] >= id })
+	j := i
+	for j < len(ns.dirs) && ns.dirs[j] == id {
+		j++
+	}
+	if i == j {
+		return nil
+	}
+	return ns.children[ns.start[i]:ns.start[j]]
+}
+
+// Parents maps every child id to the directory listing it.
+func (ns *Namespace) Parents() map[uint64]uint64 {
+	parents := make(map[uint64]uint64, len(ns.children))
+	for i, dir := range ns.dirs {
+		for _, child := range ns.children[ns.start[i]:ns.start[i+1]] {
+			parents[child] = dir
+		}
+	}
+	return parents
+}
+
+// walkFrame is one directory on the DFS stack.
+type walkFrame struct {
+	id       uint64
+	children []uint64
+	next     int
+	pathLen  int // length of the path buffer up to and including this dir
+}
+
+// Walk calls visit for the root and every inode reachable from it that
+// passes filter, parents before children and in INODE_DIR order. The
+// walk is iterative and reuses one path buffer, so memory stays
+// proportional to the tree depth. Ids missing from inodeData and
+// directories already on the stack (cycles) are skipped.
+func (ns *Namespace) Walk(filter *Filter, visit func(inode *pb.INodeSection_INode, path string)) {
+	if rootInode, exists := inodeData[ROOT_INODE_ID]; exists && filter.Match(rootInode, "/") {
+		visit(rootInode, "/")
+	}
+
+	path := make([]byte, 0, 4096)
+	stack := []walkFrame{{id: ROOT_INODE_ID, children: ns.Children(ROOT_INODE_ID)}}
+	for len(stack) > 0 {
+		top := &stack[len(stack)-1]
+		if top.next >= len(top.children) {
+			stack = stack[:len(stack)-1]
+			continue
+		}
+		childId := top.children[top.next]
+		top.next++
+
+		inode, exists := inodeData[childId]
+		if !exists || onStack(stack, childId) {
+			continue
+		}
+		path = append(path[:top.pathLen], '/')
+		path = append(path, inode.GetName()...)
+		currentPath := string(path)
+
+		if filter.Match(inode, currentPath) {
+			visit(inode, currentPath)
+		}
+		if inode.GetType() != pb.INodeSection_INode_DIRECTORY || filter.Prune(currentPath) {
+			continue
+		}
+		if children := ns.Children(childId); len(children) > 0 {
+			stack = append(stack, walkFrame{id: childId, children: children, pathLen: len(path)})
+		}
+	}
+}
+
+func onStack(stack []walkFrame, id uint64) bool {
+	for i := range stack {
+		if stack[i].id == id {
+			return true
+		}
+	}
+	return false
+}
+
+// forEachDir calls fn once per directory listed in INODE_DIR, in parent
+// id order, with the children of all its records merged.
+func (ns *Namespace) forEachDir(fn func(parent uint64, children []uint64, refChildren []uint32)) {
+	for i := 0; i < len(ns.dirs); {
+		j := i
+		for j < len(ns.dirs) && ns.dirs[j] == ns.dirs[i] {
+			j++
+		}
+		fn(ns.dirs[i], ns.children[ns.start[i]:ns.start[j]], ns.refChildren[ns.dirs[i]])
+		i = j
+	}
+}
@@ -0,0 +1,403 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"slices"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// TrendReport is the growth of the recorded aggregates over the
+// checkpoints in a window ending at the latest one.
+type TrendReport struct {
+	History     string       `json:"history"`
+	Checkpoints int          `json:"checkpoints"`
+	FirstTxId   int64        `json:"first_txid"`
+	LastTxId    int64        `json:"last_txid"`
+	From        string       `json:"from"`
+	To          string       `json:"to"`
+	Usage       []UsageTrend `json:"usage"`
+	Quotas      []QuotaTrend `json:"quotas"`
+}
+
+// UsageTrend is one directory, user or policy: its usage at the latest
+// checkpoint and the least squares growth per day over the window.
+type UsageTrend struct {
+	Kind           string  `json:"kind"`
+	Key            string  `json:"key"`
+	Files          int64   `json:"files"`
+	Bytes          int64   `json:"bytes"`
+	RawBytes       int64   `json:"raw_bytes"`
+	FilesPerDay    float64 `json:"files_per_day"`
+	BytesPerDay    float64 `json:"bytes_per_day"`
+	RawBytesPerDay float64 `json:"raw_bytes_per_day"`
+	Samples        int     `json:"samples"`
+}
+
+// QuotaTrend projects when a namespace, space or storage type quota
+// runs out at the current growth rate. DaysLeft is nil when usage is not
+// growing.
+type QuotaTrend struct {
+	Path     string   `json:"path"`
+	Quota    string   `json:"quota"` // namespace, space or the storage type
+	Used     int64    `json:"used"`
+	Limit    int64    `json:"limit"`
+	PerDay   float64  `json:"per_day"`
+	DaysLeft *float64 `json:"days_left"`
+	FullOn   string   `json:"full_on,omitempty"`
+	Over     bool     `json:"over"`
+	Samples  int      `json:"samples"`
+}
+
+// trendPoint is one sample of a series, x in days.
+type trendPoint struct {
+	x float64
+	y []float64
+}
+
+// growthPerDay is the least squares slope of the i-th value.
+func growthPerDay(points []trendPoint, i int) float64 {
+	if len(points) < 2 {
+		return 0
+	}
+	var mx, my float64
+	for _, p := range points {
+		mx += p.x
+		my += p.y[i]
+	}
+	mx /= float64(len(points))
+	my /= float64(len(points))
+	var num, den float64
+	for _, p := range points {
+		num += (p.x - mx) * (p.y[i] - my)
+		den += (p.x - mx) * (p.x - mx)
+	}
+	if den == 0 {
+		return 0
+	}
+	return num / den
+}
+
+func millisToDays(ms int64) float64 {
+	return float64(ms) / float64(24*time.Hour/time.Millisecond)
+}
+
+// buildTrendReport reads the checkpoints recorded at or after the
+// window start, which parseTimeBound resolves against the latest one.
+func buildTrendReport(db *sql.DB, window string, kinds []string) (*TrendReport, error) {
+	r := &TrendReport{Usage: []UsageTrend{}, Quotas: []QuotaTrend{}}
+	var lastTime int64
+	err := db.QueryRow(`SELECT txid, checkpoint_time FROM checkpoints ORDER BY txid DESC LIMIT 1`).Scan(&r.LastTxId, &lastTime)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("no checkpoints recorded")
+	}
+	if err != nil {
+		return nil, err
+	}
+	start, err := parseTimeBound(window, time.UnixMilli(lastTime))
+	if err != nil {
+		return nil, fmt.Errorf("-window: %w", err)
+	}
+	var firstTime int64
+	err = db.QueryRow(`SELECT count(*), min(txid), min(checkpoint_time) FROM checkpoints WHERE checkpoint_time >= ?`,
+		int64(start)).Scan(&r.Checkpoints, &r.FirstTxId, &firstTime)
+	if err != nil {
+		return nil, err
+	}
+	r.From, r.To = formatTime(uint64(firstTime)), formatTime(uint64(lastTime))
+
+	rows, err := db.Query(`SELECT u.kind, u.key, u.txid, c.checkpoint_time, u.files, u.bytes, u.raw_bytes
+		FROM usage u JOIN checkpoints c ON c.txid = u.txid
+		WHERE c.checkpoint_time >= ? ORDER BY u.kind, u.key, c.checkpoint_time`, int64(start))
+	if err != nil {
+		return nil, err
+	}
+	var series []trendPoint
+	var cur UsageTrend
+	var curTxId int64
+	flush := func() {
+		// only what still exists at the latest checkpoint is reported
+		if len(series) == 0 || curTxId != r.LastTxId || !slices.Contains(kinds, cur.Kind) {
+			return
+		}
+		cur.Samples = len(series)
+		cur.FilesPerDay = growthPerDay(series, 0)
+		cur.BytesPerDay = growthPerDay(series, 1)
+		cur.RawBytesPerDay = growthPerDay(series, 2)
+		r.Usage = append(r.Usage, cur)
+	}
+	for rows.Next() {
+		var kind, key string
+		var txId, t, files, bytes, rawBytes int64
+		if err := rows.Scan(&kind, &key, &txId, &t, &files, &bytes, &rawBytes); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if kind != cur.Kind || key != cur.Key {
+			flush()
+			series = series[:0]
+			cur = UsageTrend{Kind: kind, Key: key}
+		}
+		series = append(series, trendPoint{millisToDays(t), []float64{float64(files), float64(bytes), float64(rawBytes)}})
+		cur.Files, cur.Bytes, cur.RawBytes, curTxId = files, bytes, rawBytes, txId
+	}
+	flush()
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = db.Query(`SELECT q.path, q.txid, c.checkpoint_time, q.ns_quota, q.ns_used, q.ds_quota, q.space_used
+		FROM quotas q JOIN checkpoints c ON c.txid = q.txid
+		WHERE c.checkpoint_time >= ? ORDER BY q.path, c.checkpoint_time`, int64(start))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	series = series[:0]
+	var path string
+	var nsQuota, dsQuota, nsUsed, spaceUsed int64
+	flushQuota := func() {
+		if len(series) == 0 || curTxId != r.LastTxId {
+			return
+		}
+		for i, q := range []struct {
+			name        string
+			used, limit int64
+		}{{quotaNamespace, nsUsed, nsQuota}, {quotaSpace, spaceUsed, dsQuota}} {
+			if q.limit < 0 {
+				continue
+			}
+			r.Quotas = append(r.Quotas, quotaTrend(path, q.name, q.used, q.limit, series, i, lastTime))
+		}
+	}
+	for rows.Next() {
+		var p string
+		var txId, t int64
+		var ns, nsU, ds, spU int64
+		if err := rows.Scan(&p, &txId, &t, &ns, &nsU, &ds, &spU); err != nil {
+			return nil, err
+		}
+		if p != path {
+			flushQuota()
+			series = series[:0]
+			path = p
+		}
+		series = append(series, trendPoint{millisToDays(t), []float64{float64(nsU), float64(spU)}})
+		nsQuota, nsUsed, dsQuota, spaceUsed, curTxId = ns, nsU, ds, spU, txId
+	}
+	flushQuota()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+
+	rows, err = db.Query(`SELECT q.path, q.storage_type, q.txid, c.checkpoint_time, q.quota, q.used
+		FROM type_quotas q JOIN checkpoints c ON c.txid = q.txid
+		WHERE c.checkpoint_time >= ? ORDER BY q.path, q.storage_type, c.checkpoint_time`, int64(start))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	series = series[:0]
+	path = ""
+	var storageType string
+	var typeQuota, typeUsed int64
+	flushTypeQuota := func() {
+		if len(series) > 0 && curTxId == r.LastTxId {
+			r.Quotas = append(r.Quotas, quotaTrend(path, storageType, typeUsed, typeQuota, series, 0, lastTime))
+		}
+	}
+	for rows.Next() {
+		var p, st string
+		var txId, t, quota, used int64
+		if err := rows.Scan(&p, &st, &txId, &t, &quota, &used); err != nil {
+			return nil, err
+		}
+		if p != path || st != storageType {
+			flushTypeQuota()
+			series = series[:0]
+			path, storageType = p, st
+		}
+		series = append(series, trendPoint{millisToDays(t), []float64{float64(used)}})
+		typeQuota, typeUsed, curTxId = quota, used, txId
+	}
+	flushTypeQuota()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// fastest growing first, quotas soonest exhausted first
+	sort.SliceStable(r.Usage, func(i, j int) bool {
+		a, b := r.Usage[i], r.Usage[j]
+		if a.Kind != b.Kind {
+			return slices.Index(kinds, a.Kind) < slices.Index(kinds, b.Kind)
+		}
+		return a.BytesPerDay > b.BytesPerDay
+	})
+	sort.SliceStable(r.Quotas, func(i, j int) bool {
+		a, b := r.Quotas[i], r.Quotas[j]
+		switch {
+		case (a.DaysLeft == nil) != (b.DaysLeft == nil):
+			return a.DaysLeft != nil
+		case a.DaysLeft != nil && *a.DaysLeft != *b.DaysLeft:
+			return *a.DaysLeft < *b.DaysLeft
+		}
+		return float64(a.Used)/float64(max(a.Limit, 1)) > float64(b.Used)/float64(max(b.Limit, 1))
+	})
+	return r, nil
+}
+
+// quotaTrend projects the i-th value of series, the usage of a quota
+// now at used, onto its limit.
+func quotaTrend(path, quota string, used, limit int64, series []trendPoint, i int, lastTime int64) QuotaTrend {
+	t := QuotaTrend{Path: path, Quota: quota, Used: used, Limit: limit,
+		PerDay: growthPerDay(series, i), Samples: len(series)}
+	switch {
+	case used >= limit:
+		// full at the limit, over it only beyond, as HDFS enforces
+		t.Over = used > limit
+		t.DaysLeft = new(float64)
+		t.FullOn = formatTime(uint64(lastTime))
+	case t.PerDay > 0:
+		days := float64(limit-used) / t.PerDay
+		t.DaysLeft = &days
+		if days < 100*365 {
+			t.FullOn = formatTime(uint64(lastTime + int64(days*float64(24*time.Hour/time.Millisecond))))
+		}
+	}
+	return t
+}
+
+// limitTrends keeps the top usage entries of each kind and the top
+// quotas.
+func (r *TrendReport) limitTrends(top int) {
+	if top <= 0 {
+		return
+	}
+	perKind := make(map[string]int)
+	r.Usage = slices.DeleteFunc(r.Usage, func(u UsageTrend) bool {
+		perKind[u.Kind]++
+		return perKind[u.Kind] > top
+	})
+	if len(r.Quotas) > top {
+		r.Quotas = r.Quotas[:top]
+	}
+}
+
+func writeTrendReport(out io.Writer, r *TrendReport, human bool) error {
+	size := func(v int64) string {
+		if human && v >= 0 {
+			return formatSize(uint64(v))
+		}
+		return fmt.Sprint(v)
+	}
+	rate := func(v float64, bytes bool) string {
+		if bytes && human {
+			sign := "+"
+			if v < 0 {
+				sign = "-"
+			}
+			return sign + formatSize(uint64(math.Round(math.Abs(v))))
+		}
+		return fmt.Sprintf("%+.0f", v)
+	}
+
+	w := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(w, "%d checkpoints from %s (txid %d) to %s (txid %d)\n", r.Checkpoints, r.From, r.FirstTxId, r.To, r.LastTxId)
+	if len(r.Usage) > 0 {
+		fmt.Fprintf(w, "\nKind\tKey\tFiles\tFiles/day\tSize\tSize/day\tRawSize/day\tSamples\n")
+		for _, u := range r.Usage {
+			fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\t%s\t%s\t%d\n", u.Kind, convertSpecialSymbols(u.Key), u.Files, rate(u.FilesPerDay, false),
+				size(u.Bytes), rate(u.BytesPerDay, true), rate(u.RawBytesPerDay, true), u.Samples)
+		}
+	}
+	if len(r.Quotas) > 0 {
+		fmt.Fprintf(w, "\nPath\tQuota\tUsed\tLimit\tGrowth/day\tFull in\tFull on\n")
+		for _, q := range r.Quotas {
+			used, limit := fmt.Sprint(q.Used), fmt.Sprint(q.Limit)
+			if q.Quota != quotaNamespace {
+				used, limit = size(q.Used), size(q.Limit)
+			}
+			left, on := "-", "-"
+			switch {
+			case q.Over:
+				left, on = "over quota", ""
+			case q.DaysLeft != nil:
+				left = fmt.Sprintf("%.0fd", math.Ceil(*q.DaysLeft))
+				if q.FullOn != "" {
+					on = q.FullOn[:10]
+				}
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", convertSpecialSymbols(q.Path), q.Quota, used, limit,
+				rate(q.PerDay, q.Quota != quotaNamespace), left, on)
+		}
+	}
+	return w.Flush()
+}
+
+// runTrend implements the `trend` subcommand: growth rates from a
+// history database written by `history` or `watch -history`, and when
+// quotas will be exhausted at those rates.
+func runTrend(args []string) {
+	fs := flag.NewFlagSet("trend", flag.ExitOnError)
+	window := fs.String("window", "30d", "use the checkpoints this long before the latest one, or since a date (YYYY-MM-DD)")
+	kindList := fs.String("kinds", strings.Join(usageKinds, ","), "usage to report: "+strings.Join(usageKinds, ", ")+" (empty for quotas only)")
+	top := fs.Int("top", 20, "entries per kind and quotas listed (0 for all)")
+	human := fs.Bool("h", false, "print sizes as 1.5 G instead of bytes")
+	format := fs.String("format", "text", "output format: text or json")
+	output := fs.String("o", "", "write to this file instead of stdout")
+	registerLogFlags(fs)
+	fs.Usage = commandUsage(fs, "[flags] <history.db>")
+	parseArgs(fs, args, 1)
+
+	if *format != "text" && *format != "json" {
+		log.Fatalf("unknown format %q (want text or json)", *format)
+	}
+	var kinds []string
+	for _, k := range strings.Split(*kindList, ",") {
+		if k = strings.TrimSpace(k); k == "" {
+			continue
+		}
+		if !slices.Contains(usageKinds, k) {
+			log.Fatalf("unknown kind %q (want %s)", k, strings.Join(usageKinds, ", "))
+		}
+		kinds = append(kinds, k)
+	}
+	if !fileExists(fs.Arg(0)) {
+		log.Fatalf("%s: no such file", fs.Arg(0))
+	}
+	db, err := openHistory(fs.Arg(0))
+	logIfErr(err)
+	defer db.Close()
+	report, err := buildTrendReport(db, *window, kinds)
+	logIfErr(err)
+	report.History = fs.Arg(0)
+	report.limitTrends(*top)
+	if report.Checkpoints < 2 {
+		log.Printf("warning: %d checkpoint in the window, growth cannot be computed", report.Checkpoints)
+	}
+
+	out, err := createOutput(*output, OutputOptions{})
+	logIfErr(err)
+	if *format == "json" {
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		logIfErr(enc.Encode(report))
+	} else {
+		logIfErr(writeTrendReport(out, report, *human))
+	}
+	logIfErr(out.Close())
+}
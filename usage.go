@@ -0,0 +1,401 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path"
+	"sort"
+	"time"
+
+	hd "hdfs-fsimage-parse-go/pkg/hadoop_hdfs"
+	pb "hdfs-fsimage-parse-go/pkg/hadoop_hdfs_fsimage"
+)
+
+// storagePolicyNames are the policies of BlockStoragePolicySuite by id.
+// Files and directories without one inherit it, the root defaults to HOT.
+var storagePolicyNames = map[uint32]string{
+	1:  "PROVIDED",
+	2:  "COLD",
+	5:  "WARM",
+	7:  "HOT",
+	10: "ONE_SSD",
+	12: "ALL_SSD",
+	14: "ALL_NVDIMM",
+	15: "LAZY_PERSIST",
+}
+
+// storagePolicyTypes are the storage types of each policy's replicas,
+// the last one repeated for the rest, as chooseStorageTypes picks them.
+var storagePolicyTypes = map[uint32][]hd.StorageTypeProto{
+	1:  {hd.StorageTypeProto_PROVIDED, hd.StorageTypeProto_DISK},
+	2:  {hd.StorageTypeProto_ARCHIVE},
+	5:  {hd.StorageTypeProto_DISK, hd.StorageTypeProto_ARCHIVE},
+	7:  {hd.StorageTypeProto_DISK},
+	10: {hd.StorageTypeProto_SSD, hd.StorageTypeProto_DISK},
+	12: {hd.StorageTypeProto_SSD},
+	14: {hd.StorageTypeProto_NVDIMM},
+	15: {hd.StorageTypeProto_RAM_DISK, hd.StorageTypeProto_DISK},
+}
+
+const defaultStoragePolicy = 7
+
+func storagePolicyName(id uint32) string {
+	if name, ok := storagePolicyNames[id]; ok {
+		return name
+	}
+	return fmt.Sprintf("policy-%d", id)
+}
+
+// ecPolicyTable holds the erasure coding policies of an image by id.
+type ecPolicyTable map[uint32]ecPolicy
+
+// systemECPolicyTable has only the system policies, which images from
+// before the ERASURE_CODING section was added use.
+func systemECPolicyTable() ecPolicyTable {
+	t := make(ecPolicyTable, len(systemECPolicies))
+	for _, p := range systemECPolicies {
+		t[p.id] = p
+	}
+	return t
+}
+
+// loadECPolicies reads the policies of the ERASURE_CODING section over
+// the system ones, so user defined policies and their cell sizes are
+// known.
+func loadECPolicies(f io.ReaderAt, sectionMap map[string]*pb.FileSummary_Section) (ecPolicyTable, error) {
+	t := systemECPolicyTable()
+	section := &pb.ErasureCodingSection{}
+	err := forEachRecord(sectionMap["ERASURE_CODING"], f, section, func([]byte) error { return nil })
+	for _, p := range section.GetPolicies() {
+		t[p.GetId()] = ecPolicy{
+			id:       p.GetId(),
+			name:     p.GetName(),
+			codec:    p.GetSchema().GetCodecName(),
+			data:     p.GetSchema().GetDataUnits(),
+			parity:   p.GetSchema().GetParityUnits(),
+			cellSize: p.GetCellSize(),
+		}
+	}
+	return t, err
+}
+
+func (t ecPolicyTable) name(id uint32) string {
+	if p, ok := t[id]; ok {
+		return p.name
+	}
+	return fmt.Sprintf("ec-%d", id)
+}
+
+// fileQuotaSpace is the space a file is charged against quotas: its
+// size times the replication, or for striped files the data and parity
+// of every block group, as StripedBlockUtil.spaceConsumedByStripedBlock
+// computes it. Striped files with an unknown policy count their data.
+func fileQuotaSpace(file *pb.INodeSection_INodeFile, policies ecPolicyTable) uint64 {
+	if file.GetBlockType() != hd.BlockTypeProto_STRIPED {
+		return fileRawBytes(file)
+	}
+	p, ok := policies[file.GetErasureCodingPolicyID()]
+	if !ok || p.data == 0 || p.cellSize == 0 {
+		return getFileSize(file)
+	}
+	data, parity, cell := uint64(p.data), uint64(p.parity), uint64(p.cellSize)
+	var space uint64
+	for _, b := range file.GetBlocks() {
+		n := b.GetNumBytes()
+		// parity blocks are as long as the first data block
+		stripe := cell * data
+		parityLen := n / data
+		if last := n % stripe; last != 0 {
+			parityLen = (n-1)/stripe*cell + min(last, cell)
+		}
+		space += n + parityLen*parity
+	}
+	return space
+}
+
+// addTypeSpace charges a file's space to the storage types its policy
+// places the replicas on. Block groups of striped files are charged to
+// the first type, which is the only one the EC-capable policies have.
+func addTypeSpace(typeUsed map[hd.StorageTypeProto]uint64, file *pb.INodeSection_INodeFile, policy uint32, ecPolicies ecPolicyTable) {
+	types := storagePolicyTypes[policy]
+	if len(types) == 0 {
+		types = storagePolicyTypes[defaultStoragePolicy]
+	}
+	if file.GetBlockType() == hd.BlockTypeProto_STRIPED {
+		typeUsed[types[0]] += fileQuotaSpace(file, ecPolicies)
+		return
+	}
+	size := getFileSize(file)
+	for i := range int(file.GetReplication()) {
+		typeUsed[types[min(i, len(types)-1)]] += size
+	}
+}
+
+// usageCounts is the usage of the files owned by one user, stored under
+// one directory or written with one policy.
+type usageCounts struct {
+	files, dirs, smallFiles uint64
+	bytes, rawBytes         uint64
+}
+
+func (u *usageCounts) addFile(file *pb.INodeSection_INodeFile, smallFileSize uint64) {
+	size := getFileSize(file)
+	u.files++
+	u.bytes += size
+	u.rawBytes += fileRawBytes(file)
+	if size < smallFileSize {
+		u.smallFiles++
+	}
+}
+
+// quotaUsage is a directory with a quota and the usage of its subtree,
+// counted the way DirectoryWithQuotaFeature does: the namespace includes
+// the directory itself, the space is what fileQuotaSpace charges, per
+// storage type as the storage policy places it.
+type quotaUsage struct {
+	path              string
+	nsQuota, dsQuota  int64
+	nsUsed, spaceUsed uint64
+	typeQuotas        []*pb.INodeSection_QuotaByStorageTypeEntryProto
+	typeUsed          map[hd.StorageTypeProto]uint64
+}
+
+// ratio is the fraction of the tightest quota that is used.
+func (q *quotaUsage) ratio() float64 {
+	r := 0.0
+	if q.nsQuota >= 0 {
+		r = float64(q.nsUsed) / float64(max(q.nsQuota, 1))
+	}
+	if q.dsQuota >= 0 {
+		r = max(r, float64(q.spaceUsed)/float64(max(q.dsQuota, 1)))
+	}
+	for _, t := range q.typeQuotas {
+		r = max(r, float64(q.typeUsed[t.GetStorageType()])/float64(max(t.GetQuota(), 1)))
+	}
+	return r
+}
+
+// quotaSet reports whether a quota value from the image is a limit:
+// -1 means none, and the root's default namespace quota is MaxInt64.
+func quotaSet(v uint64) bool {
+	return int64(v) >= 0 && int64(v) != math.MaxInt64
+}
+
+// namespaceUsage aggregates the namespace by user, by directory depth
+// levels below the root, by storage and erasure coding policy and by
+// quota directory.
+type namespaceUsage struct {
+	total                                    usageCounts
+	symlinks, blocks, underConstruction      uint64
+	lastModified                             uint64   // epoch millis
+	sizeCounts                               []uint64 // per fileSizeBuckets, then above the last
+	users, dirs, storagePolicies, ecPolicies map[string]*usageCounts
+	quotas                                   map[string]*quotaUsage
+	quotaBuf                                 []*quotaUsage
+	opts                                     usageOptions
+}
+
+// usageOptions select what computeUsage aggregates.
+type usageOptions struct {
+	depth         int // directory levels below the root counted apart
+	smallFileSize uint64
+	// quotasOnly leaves out the directory, user and policy maps, for
+	// callers that only need the quotas
+	quotasOnly bool
+	ecPolicies ecPolicyTable // the system policies when nil
+}
+
+func usageOf(m map[string]*usageCounts, key string) *usageCounts {
+	u := m[key]
+	if u == nil {
+		u = &usageCounts{}
+		m[key] = u
+	}
+	return u
+}
+
+// computeUsage walks the namespace once. Walk visits parents before
+// their children, so the quotas and policies of all ancestors are known
+// when an inode is counted.
+func computeUsage(ns *Namespace, opts usageOptions) *namespaceUsage {
+	if opts.ecPolicies == nil {
+		opts.ecPolicies = systemECPolicyTable()
+	}
+	depth, smallFileSize := opts.depth, opts.smallFileSize
+	u := &namespaceUsage{
+		opts:            opts,
+		sizeCounts:      make([]uint64, len(fileSizeBuckets)+1),
+		users:           make(map[string]*usageCounts),
+		dirs:            make(map[string]*usageCounts),
+		storagePolicies: make(map[string]*usageCounts),
+		ecPolicies:      make(map[string]*usageCounts),
+		quotas:          make(map[string]*quotaUsage),
+	}
+	dirPolicies := make(map[string]uint32)
+	ns.Walk(nil, func(inode *pb.INodeSection_INode, p string) {
+		isDir := inode.GetType() == pb.INodeSection_INode_DIRECTORY
+		if isDir {
+			dir := inode.GetDirectory()
+			if quotaSet(dir.GetNsQuota()) || quotaSet(dir.GetDsQuota()) || len(dir.GetTypeQuotas().GetQuotas()) > 0 {
+				q := &quotaUsage{path: p, nsQuota: -1, dsQuota: -1, typeQuotas: dir.GetTypeQuotas().GetQuotas(),
+					typeUsed: make(map[hd.StorageTypeProto]uint64)}
+				if quotaSet(dir.GetNsQuota()) {
+					q.nsQuota = int64(dir.GetNsQuota())
+				}
+				if quotaSet(dir.GetDsQuota()) {
+					q.dsQuota = int64(dir.GetDsQuota())
+				}
+				u.quotas[p] = q
+			}
+			for _, x := range inodeXAttrs(inode) {
+				if x.Namespace == "system" && x.Name == storagePolicyXAttr && len(x.Value) == 1 {
+					dirPolicies[p] = uint32(x.Value[0])
+				}
+			}
+			u.lastModified = max(u.lastModified, dir.GetModificationTime())
+		}
+
+		var file *pb.INodeSection_INodeFile
+		switch inode.GetType() {
+		case pb.INodeSection_INode_FILE:
+			file = inode.GetFile()
+			u.total.addFile(file, smallFileSize)
+			if !opts.quotasOnly {
+				usageOf(u.users, decodePermission(file.GetPermission()).UserName).addFile(file, smallFileSize)
+			}
+			u.blocks += uint64(len(file.GetBlocks()))
+			if file.GetFileUC() != nil {
+				u.underConstruction++
+			}
+			u.lastModified = max(u.lastModified, file.GetModificationTime())
+			size := getFileSize(file)
+			i := sort.Search(len(fileSizeBuckets), func(i int) bool { return size <= fileSizeBuckets[i] })
+			u.sizeCounts[i]++
+		case pb.INodeSection_INode_DIRECTORY:
+			u.total.dirs++
+		case pb.INodeSection_INode_SYMLINK:
+			u.symlinks++
+		}
+		if key, ok := duKey("/", p, depth, isDir); ok && p != "/" && !opts.quotasOnly {
+			d := usageOf(u.dirs, key)
+			if file != nil {
+				d.addFile(file, smallFileSize)
+			} else if isDir {
+				d.dirs++
+			}
+		}
+
+		policy := uint32(0)
+		if file != nil {
+			policy = file.GetStoragePolicyID()
+		}
+		if len(u.quotas) == 0 && (file == nil || policy != 0 || len(dirPolicies) == 0) {
+			u.addPolicies(file, policy, smallFileSize)
+			return
+		}
+		quotas := u.quotaBuf[:0]
+		for anc := p; ; anc = path.Dir(anc) {
+			if q := u.quotas[anc]; q != nil {
+				quotas = append(quotas, q)
+			}
+			if policy == 0 {
+				policy = dirPolicies[anc]
+			}
+			if anc == "/" {
+				break
+			}
+		}
+		u.quotaBuf = quotas
+		if policy == 0 {
+			policy = defaultStoragePolicy
+		}
+		for _, q := range quotas {
+			q.nsUsed++
+			if file != nil {
+				q.spaceUsed += fileQuotaSpace(file, opts.ecPolicies)
+				addTypeSpace(q.typeUsed, file, policy, opts.ecPolicies)
+			}
+		}
+		u.addPolicies(file, policy, smallFileSize)
+	})
+	return u
+}
+
+// addPolicies counts a file under its effective storage policy and, if
+// it is striped, its erasure coding policy.
+func (u *namespaceUsage) addPolicies(file *pb.INodeSection_INodeFile, storagePolicy uint32, smallFileSize uint64) {
+	if file == nil || u.opts.quotasOnly {
+		return
+	}
+	if storagePolicy == 0 {
+		storagePolicy = defaultStoragePolicy
+	}
+	usageOf(u.storagePolicies, storagePolicyName(storagePolicy)).addFile(file, smallFileSize)
+	if file.GetBlockType() == hd.BlockTypeProto_STRIPED {
+		usageOf(u.ecPolicies, u.opts.ecPolicies.name(file.GetErasureCodingPolicyID())).addFile(file, smallFileSize)
+	}
+}
+
+// imageUsage is the usage of a loaded image with what describes the
+// image itself.
+type imageUsage struct {
+	fileName      string
+	fInfo         os.FileInfo
+	nsInfo        *pb.NameSystemSection
+	layoutVersion uint32
+	loadTime      time.Duration
+	smallFileSize uint64
+	*namespaceUsage
+}
+
+// loadImageUsage loads an image and aggregates its namespace.
+func loadImageUsage(fileName string, depth int, smallFileSize string) (*imageUsage, error) {
+	small, err := parseSize(smallFileSize)
+	if err != nil {
+		return nil, fmt.Errorf("-small-file-size: %w", err)
+	}
+	if depth < 1 {
+		return nil, fmt.Errorf("-depth must be at least 1")
+	}
+	start := time.Now()
+	f, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	fInfo, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	summary, _, err := readFileSummary(f, fInfo.Size())
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", fileName, err)
+	}
+	sectionMap := make(map[string]*pb.FileSummary_Section)
+	for _, s := range summary.GetSections() {
+		sectionMap[s.GetName()] = s
+	}
+	nsInfo, err := parseNameSystemSection(sectionMap["NS_INFO"], f)
+	if err != nil {
+		return nil, err
+	}
+	ecPolicies, err := loadECPolicies(f, sectionMap)
+	if err != nil {
+		return nil, err
+	}
+	ns, err := loadNamespace(f, sectionMap)
+	if err != nil {
+		return nil, err
+	}
+	return &imageUsage{
+		fileName:       fileName,
+		fInfo:          fInfo,
+		nsInfo:         nsInfo,
+		layoutVersion:  summary.GetLayoutVersion(),
+		loadTime:       time.Since(start),
+		smallFileSize:  small,
+		namespaceUsage: computeUsage(ns, usageOptions{depth: depth, smallFileSize: small, ecPolicies: ecPolicies}),
+	}, nil
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"testing"
+
+	hd "hdfs-fsimage-parse-go/pkg/hadoop_hdfs"
+	pb "hdfs-fsimage-parse-go/pkg/hadoop_hdfs_fsimage"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// TestFileQuotaSpace charges a striped file by the policy the image
+// defines, a user defined one with 64k cells here.
+func TestFileQuotaSpace(t *testing.T) {
+	fileName := writeTestImage(t, testGenerateOptions())
+	f, sectionMap, err := openImage(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	policies, err := loadECPolicies(f, sectionMap)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p := policies[1]; p.name != "RS-6-3-1024k" || p.data != 6 || p.parity != 3 || p.cellSize != 1<<20 {
+		t.Errorf("policy 1 from the image is %+v", p)
+	}
+
+	file := &pb.INodeSection_INodeFile{
+		BlockType:             hd.BlockTypeProto_STRIPED.Enum(),
+		ErasureCodingPolicyID: proto.Uint32(64),
+		Blocks:                []*hd.BlockProto{{BlockId: proto.Uint64(1), GenStamp: proto.Uint64(1), NumBytes: proto.Uint64(200 << 10)}},
+	}
+	if got := fileQuotaSpace(file, policies); got != 200<<10 {
+		t.Errorf("unknown policy charges %d, want the data %d", got, 200<<10)
+	}
+	policies[64] = ecPolicy{id: 64, name: "RS-2-1-64k", codec: "rs", data: 2, parity: 1, cellSize: 64 << 10}
+	// cells of 64k, 64k, 64k and 8k: the first data block and the parity
+	// block hold 128k
+	if got, want := fileQuotaSpace(file, policies), uint64(200<<10+128<<10); got != want {
+		t.Errorf("RS-2-1-64k charges %d, want %d", got, want)
+	}
+}
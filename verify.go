@@ -0,0 +1,204 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	pb "hdfs-fsimage-parse-go/pkg/hadoop_hdfs_fsimage"
+
+	"google.golang.org/protobuf/proto"
+)
+
+const imageMagic = "HDFSIMG1"
+
+// requiredSections are needed to rebuild the namespace.
+var requiredSections = []string{"NS_INFO", "INODE", "INODE_DIR"}
+
+// runVerify implements the `verify` subcommand.
+func runVerify(args []string) {
+	fs := flag.NewFlagSet("verify", flag.ExitOnError)
+	requireMD5 := fs.Bool("require-md5", false, "fail when the .md5 sidecar is missing")
+	fs.Usage = commandUsage(fs, "[flags] <fsimage>...",
+		fmt.Sprintf("Exits with status %d when any image fails.", exitProblems))
+	registerLogFlags(fs)
+	parseArgs(fs, args, 1)
+
+	failed := false
+	for _, fileName := range fs.Args() {
+		if err := verifyImage(fileName, *requireMD5); err != nil {
+			fmt.Printf("%s: FAILED\n%v\n", fileName, err)
+			failed = true
+			continue
+		}
+		fmt.Printf("%s: OK\n", fileName)
+	}
+	if failed {
+		os.Exit(exitProblems)
+	}
+}
+
+// verifyImage checks an fsimage before it is parsed: the MD5 sidecar,
+// the magic header, the FileSummary trailer and that every section lies
+// between the header and the summary without overlapping another one.
+func verifyImage(fileName string, requireMD5 bool) error {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	fInfo, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	fileLength := fInfo.Size()
+
+	if err := verifyMD5Sidecar(fileName, f, requireMD5); err != nil {
+		return err
+	}
+
+	summary, summaryStart, err := readFileSummary(f, fileLength)
+	if err != nil {
+		return err
+	}
+	return verifySections(summary.GetSections(), int64(len(imageMagic)), summaryStart)
+}
+
+// readFileSummary validates the magic header and the trailing
+// FileSummary and returns it with the offset where it starts.
+func readFileSummary(f io.ReaderAt, fileLength int64) (*pb.FileSummary, int64, error) {
+	minLength := int64(len(imageMagic) + FILE_SUM_BYTES)
+	if fileLength < minLength {
+		return nil, 0, fmt.Errorf("file is %d bytes, shorter than magic and summary length (%d bytes): truncated", fileLength, minLength)
+	}
+
+	magic := make([]byte, len(imageMagic))
+	if _, err := f.ReadAt(magic, 0); err != nil {
+		return nil, 0, fmt.Errorf("reading magic header: %w", err)
+	}
+	if string(magic) != imageMagic {
+		return nil, 0, fmt.Errorf("bad magic header %q at offset 0, want %q: not a protobuf fsimage", magic, imageMagic)
+	}
+
+	fSummaryLength, err := decodeFileSummaryLength(fileLength, f)
+	if err != nil {
+		return nil, 0, err
+	}
+	summaryLength := int64(fSummaryLength)
+	maxLength := fileLength - minLength
+	if summaryLength <= 0 || summaryLength > maxLength {
+		return nil, 0, fmt.Errorf("summary length %d at offset %d out of range (1..%d): truncated or corrupt trailer",
+			summaryLength, fileLength-FILE_SUM_BYTES, maxLength)
+	}
+
+	summaryStart := fileLength - FILE_SUM_BYTES - summaryLength
+	summaryBytes := make([]byte, summaryLength)
+	if _, err := f.ReadAt(summaryBytes, summaryStart); err != nil {
+		return nil, 0, fmt.Errorf("reading summary at offset %d: %w", summaryStart, err)
+	}
+	msg, rest, ok := readDelimited(summaryBytes)
+	if !ok {
+		return nil, 0, fmt.Errorf("summary at offset %d: bad length prefix", summaryStart)
+	}
+	if len(rest) != 0 {
+		return nil, 0, fmt.Errorf("summary at offset %d: %d trailing bytes after the message", summaryStart, len(rest))
+	}
+	summary := &pb.FileSummary{}
+	if err := proto.Unmarshal(msg, summary); err != nil {
+		return nil, 0, fmt.Errorf("summary at offset %d: %w", summaryStart, err)
+	}
+	return summary, summaryStart, nil
+}
+
+// verifySections checks that every section lies in [dataStart, dataEnd)
+// and that sections do not overlap.
+func verifySections(sections []*pb.FileSummary_Section, dataStart, dataEnd int64) error {
+	var errs []error
+	seen := make(map[string]bool)
+	for _, s := range sections {
+		if seen[s.GetName()] {
+			errs = append(errs, fmt.Errorf("section %s listed twice", s.GetName()))
+		}
+		seen[s.GetName()] = true
+
+		if err := checkSectionBounds(s, dataStart, dataEnd); err != nil {
+			errs = append(errs, fmt.Errorf("section %s %w", s.GetName(), err))
+		}
+	}
+	for _, name := range requiredSections {
+		if !seen[name] {
+			errs = append(errs, fmt.Errorf("section %s missing", name))
+		}
+	}
+
+	sorted := append([]*pb.FileSummary_Section(nil), sections...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].GetOffset() < sorted[j].GetOffset() })
+	for i := 1; i < len(sorted); i++ {
+		prev, cur := sorted[i-1], sorted[i]
+		if prev.GetOffset()+prev.GetLength() > cur.GetOffset() {
+			errs = append(errs, fmt.Errorf("section %s [%d, %d) overlaps %s starting at %d",
+				prev.GetName(), prev.GetOffset(), prev.GetOffset()+prev.GetLength(), cur.GetName(), cur.GetOffset()))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// checkSectionBounds fails when s does not lie within the data area
+// [dataStart, dataEnd) between the magic header and the summary.
+func checkSectionBounds(s *pb.FileSummary_Section, dataStart, dataEnd int64) error {
+	offset, length := s.GetOffset(), s.GetLength()
+	if offset < uint64(dataStart) || offset > uint64(dataEnd) || length > uint64(dataEnd)-offset {
+		return fmt.Errorf("[%d, %d) outside the data area [%d, %d)", offset, offset+length, dataStart, dataEnd)
+	}
+	return nil
+}
+
+// verifyMD5Sidecar compares the image against fsimage_<txid>.md5, which
+// the namenode writes as "<hex digest> *<file name>".
+func verifyMD5Sidecar(fileName string, f *os.File, required bool) error {
+	sidecar := fileName + ".md5"
+	content, err := os.ReadFile(sidecar)
+	if os.IsNotExist(err) {
+		if required {
+			return fmt.Errorf("%s not found", sidecar)
+		}
+		infof("%s not found, skipping MD5 check", sidecar)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	fields := strings.Fields(string(content))
+	if len(fields) == 0 {
+		return fmt.Errorf("%s is empty", sidecar)
+	}
+	expected, err := hex.DecodeString(fields[0])
+	if err != nil || len(expected) != md5.Size {
+		return fmt.Errorf("%s: invalid digest %q", sidecar, fields[0])
+	}
+	if len(fields) > 1 {
+		if name := strings.TrimPrefix(fields[1], "*"); name != filepath.Base(fileName) {
+			log.Printf("%s names %s, not %s", sidecar, name, filepath.Base(fileName))
+		}
+	}
+
+	h := md5.New()
+	if _, err := io.Copy(h, bufio.NewReaderSize(io.NewSectionReader(f, 0, 1<<62), 1<<20)); err != nil {
+		return fmt.Errorf("hashing %s: %w", fileName, err)
+	}
+	if actual := h.Sum(nil); !bytes.Equal(actual, expected) {
+		return fmt.Errorf("MD5 mismatch: image is %x, %s says %x", actual, sidecar, expected)
+	}
+	return nil
+}
@@ -0,0 +1,432 @@
+package main
+
+import (
+	"cmp"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// imageNameRe matches the checkpoints the namenode and
+// `hdfs dfsadmin -fetchImage` write, not fsimage.ckpt_ files in progress.
+var imageNameRe = regexp.MustCompile(`^fsimage_(\d+)$`)
+
+// WatchCommand is one -run: a subcommand run against every new image,
+// with its stdout written to Output in the image's result directory.
+type WatchCommand struct {
+	Output string
+	Args   []string
+}
+
+// parseWatchCommand splits "[output=]command args..." like a shell
+// would, honouring single and double quotes.
+func parseWatchCommand(s string) (WatchCommand, error) {
+	var c WatchCommand
+	if name, rest, ok := strings.Cut(s, "="); ok && !strings.ContainsAny(name, " \t'\"") {
+		if name == "" || name != filepath.Base(name) || strings.HasPrefix(name, ".") {
+			return c, fmt.Errorf("-run %q: output must be a plain file name", s)
+		}
+		c.Output, s = name, rest
+	}
+	var arg strings.Builder
+	inArg := false
+	var quote rune
+	for _, r := range s {
+		switch {
+		case quote != 0 && r == quote:
+			quote = 0
+		case quote != 0:
+			arg.WriteRune(r)
+		case r == '\'' || r == '"':
+			quote, inArg = r, true
+		case r == ' ' || r == '\t':
+			if inArg {
+				c.Args = append(c.Args, arg.String())
+				arg.Reset()
+				inArg = false
+			}
+		default:
+			arg.WriteRune(r)
+			inArg = true
+		}
+	}
+	if quote != 0 {
+		return c, fmt.Errorf("-run %q: unterminated quote", s)
+	}
+	if inArg {
+		c.Args = append(c.Args, arg.String())
+	}
+	if len(c.Args) == 0 {
+		return c, fmt.Errorf("-run %q: no command", s)
+	}
+	// unknown commands fail on the first image, looking them up here
+	// would make commands refer to itself
+	if c.Args[0] == "watch" {
+		return c, fmt.Errorf("-run %q: watch cannot run itself", s)
+	}
+	return c, nil
+}
+
+// args substitutes {image} and {dir}; without {image} the image path is
+// appended after the command's own arguments, which is right for the
+// commands taking only the image. Commands that take more positional
+// arguments after the image need {image}.
+func (c WatchCommand) args(image, dir string) []string {
+	args := make([]string, 0, len(c.Args)+2)
+	args = append(args, c.Args[0])
+	// the commands log as much as the watcher does, unless -run says
+	// otherwise
+	if !slices.ContainsFunc(c.Args[1:], isVerbosityFlag) {
+		switch verbosity {
+		case 0:
+			args = append(args, "-q")
+		case 2:
+			args = append(args, "-v")
+		}
+	}
+	hasImage := false
+	for _, a := range c.Args[1:] {
+		hasImage = hasImage || strings.Contains(a, "{image}")
+		args = append(args, strings.NewReplacer("{image}", image, "{dir}", dir).Replace(a))
+	}
+	if !hasImage {
+		args = append(args, image)
+	}
+	return args
+}
+
+func isVerbosityFlag(arg string) bool {
+	switch strings.TrimPrefix(arg, "-") {
+	case "q", "v", "-q", "-v":
+		return true
+	}
+	return false
+}
+
+// watcher processes the checkpoints appearing in a directory.
+type watcher struct {
+	dir         string
+	out         string
+	commands    []WatchCommand
+	keep        int
+	metrics     *metricsHandler // nil without -listen
+	metricsFile string
+	metricsOpts MetricsOptions
+	history     *sql.DB // nil without -history
+
+	lastTxId    uint64
+	failed      map[string]bool
+	processed   int
+	failures    int
+	lastSuccess time.Time
+	image       *ImageMetrics
+}
+
+// pending returns the images after the last processed one whose .md5
+// sidecar has been written, oldest first.
+func (w *watcher) pending() ([]string, error) {
+	entries, err := os.ReadDir(w.dir)
+	if err != nil {
+		return nil, err
+	}
+	type image struct {
+		name string
+		txId uint64
+	}
+	var images []image
+	for _, e := range entries {
+		m := imageNameRe.FindStringSubmatch(e.Name())
+		if m == nil || e.IsDir() || w.failed[e.Name()] {
+			continue
+		}
+		txId, err := strconv.ParseUint(m[1], 10, 64)
+		if err != nil || txId <= w.lastTxId {
+			continue
+		}
+		if !fileExists(filepath.Join(w.dir, e.Name()+".md5")) {
+			debugf("%s: waiting for its .md5", e.Name())
+			continue
+		}
+		images = append(images, image{e.Name(), txId})
+	}
+	slices.SortFunc(images, func(a, b image) int { return cmp.Compare(a.txId, b.txId) })
+	names := make([]string, len(images))
+	for i, img := range images {
+		names[i] = img.name
+	}
+	return names, nil
+}
+
+// resume continues after the newest result already in the output
+// directory, so a restart does not redo work.
+func (w *watcher) resume() error {
+	if w.out == "" {
+		return nil
+	}
+	entries, err := os.ReadDir(w.out)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if m := imageNameRe.FindStringSubmatch(e.Name()); m != nil && e.IsDir() {
+			txId, _ := strconv.ParseUint(m[1], 10, 64)
+			w.lastTxId = max(w.lastTxId, txId)
+		} else if strings.HasPrefix(e.Name(), ".fsimage_") {
+			// left by an interrupted run
+			os.RemoveAll(filepath.Join(w.out, e.Name()))
+		}
+	}
+	if w.lastTxId > 0 {
+		infof("resuming after transaction %d", w.lastTxId)
+	}
+	return nil
+}
+
+// process verifies one image, runs the commands into a temporary
+// directory renamed into place when all of them are done, and updates
+// the metrics.
+func (w *watcher) process(name string) error {
+	image := filepath.Join(w.dir, name)
+	if err := verifyImage(image, true); err != nil {
+		return err
+	}
+
+	var tmp string
+	if len(w.commands) > 0 {
+		tmp = filepath.Join(w.out, "."+name)
+		if err := os.RemoveAll(tmp); err != nil {
+			return err
+		}
+		if err := os.MkdirAll(tmp, 0o755); err != nil {
+			return err
+		}
+		self, err := os.Executable()
+		if err != nil {
+			return err
+		}
+		for _, c := range w.commands {
+			if err := runWatchCommand(self, c, image, tmp); err != nil {
+				os.RemoveAll(tmp)
+				return err
+			}
+		}
+	}
+
+	if w.metrics != nil || w.metricsFile != "" || w.history != nil {
+		// the namespace of the previous image is still loaded
+		resetNamespace()
+		u, err := loadImageUsage(image, w.metricsOpts.Depth, w.metricsOpts.SmallFileSize)
+		if parseReport.Total() > 0 {
+			parseReport.Log()
+			parseReport.reset()
+		}
+		if err == nil && w.history != nil {
+			var recorded bool
+			if recorded, err = historyHas(w.history, u.nsInfo.GetTransactionId()); err == nil && !recorded {
+				err = recordUsage(w.history, u)
+			}
+		}
+		if err != nil {
+			os.RemoveAll(tmp)
+			return err
+		}
+		w.image = collectMetrics(u, w.metricsOpts)
+	}
+
+	if tmp != "" {
+		if err := os.Rename(tmp, filepath.Join(w.out, name)); err != nil {
+			return err
+		}
+		w.prune()
+	}
+	return nil
+}
+
+// runWatchCommand runs c as a child process of this program, so a
+// failing command cannot take the watcher down. Exit status 4 (corrupt
+// records skipped) is a warning, the output is kept.
+func runWatchCommand(self string, c WatchCommand, image, dir string) error {
+	args := c.args(image, dir)
+	cmd := exec.Command(self, args...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if c.Output != "" {
+		f, err := os.Create(filepath.Join(dir, c.Output))
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		cmd.Stdout = f
+	}
+	debugf("running %s", strings.Join(args, " "))
+	err := cmd.Run()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == exitIncomplete {
+		log.Printf("warning: %s: corrupt records skipped", strings.Join(args, " "))
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", strings.Join(args, " "), err)
+	}
+	return nil
+}
+
+// prune removes all but the newest keep results.
+func (w *watcher) prune() {
+	if w.keep <= 0 {
+		return
+	}
+	entries, err := os.ReadDir(w.out)
+	if err != nil {
+		log.Printf("warning: %v", err)
+		return
+	}
+	var results []string
+	for _, e := range entries {
+		if imageNameRe.MatchString(e.Name()) && e.IsDir() {
+			results = append(results, e.Name())
+		}
+	}
+	// the fixed-width txid makes name order transaction order
+	slices.Sort(results)
+	for len(results) > w.keep {
+		debugf("removing result %s", results[0])
+		if err := os.RemoveAll(filepath.Join(w.out, results[0])); err != nil {
+			log.Printf("warning: %v", err)
+		}
+		results = results[1:]
+	}
+}
+
+// publish hands the metrics of the last image, with the watcher's own,
+// to the server and the textfile.
+func (w *watcher) publish() {
+	if w.image == nil {
+		return
+	}
+	m := *w.image
+	processed := metricFamily{name: metricsPrefix + "watch_images_processed", help: "Images processed since the watcher started.", typ: "counter"}
+	processed.add(float64(w.processed))
+	failures := metricFamily{name: metricsPrefix + "watch_failures", help: "Images that failed verification or a command.", typ: "counter"}
+	failures.add(float64(w.failures))
+	last := metricFamily{name: metricsPrefix + "watch_last_success_timestamp_seconds", help: "Time the last image was processed.", typ: "gauge"}
+	last.add(float64(w.lastSuccess.Unix()))
+	m.Families = append(slices.Clip(m.Families), processed, failures, last)
+
+	if w.metrics != nil {
+		w.metrics.set(&m)
+	}
+	if w.metricsFile != "" {
+		if err := writeMetricsFile(w.metricsFile, &m); err != nil {
+			log.Printf("warning: %v", err)
+		}
+	}
+}
+
+// poll processes every pending image. An image that fails is not
+// retried, a later checkpoint supersedes it.
+func (w *watcher) poll() error {
+	names, err := w.pending()
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		start := time.Now()
+		infof("processing %s", name)
+		if err := w.process(name); err != nil {
+			log.Printf("warning: %s: %v", name, err)
+			w.failed[name] = true
+			w.failures++
+			continue
+		}
+		txId, _ := strconv.ParseUint(imageNameRe.FindStringSubmatch(name)[1], 10, 64)
+		w.lastTxId = txId
+		w.processed++
+		w.lastSuccess = time.Now()
+		infof("processed %s in %v", name, time.Since(start).Round(time.Millisecond))
+	}
+	if len(names) > 0 {
+		w.publish()
+	}
+	return nil
+}
+
+// runWatch implements the `watch` subcommand: a daemon that processes
+// each checkpoint written to a directory.
+func runWatch(args []string) {
+	fs := flag.NewFlagSet("watch", flag.ExitOnError)
+	out := fs.String("out", "", "directory for the results, one subdirectory per image")
+	var commands []WatchCommand
+	fs.Func("run", "run `[output=]command args` on each image, stdout into output in its result directory (repeatable)", func(s string) error {
+		c, err := parseWatchCommand(s)
+		commands = append(commands, c)
+		return err
+	})
+	keep := fs.Int("keep", 10, "results kept in -out, older ones are removed (0 keeps all)")
+	interval := fs.Duration("interval", 30*time.Second, "how often the directory is listed")
+	once := fs.Bool("once", false, "process the pending images and exit")
+	listen := fs.String("listen", "", "serve the metrics of the latest image on http://<addr>/metrics")
+	metricsFile := fs.String("metrics-file", "", "write the metrics of the latest image to this .prom file")
+	history := fs.String("history", "", "append the aggregates of each image to this history database for trend")
+	var metricsOpts MetricsOptions
+	registerMetricsFlags(fs, &metricsOpts)
+	registerParseFlags(fs)
+	registerLogFlags(fs)
+	fs.Usage = commandUsage(fs, "[flags] <dir>",
+		"An fsimage_<txid> is processed once its .md5 has been written and matches.",
+		"{image} and {dir} in -run are replaced by the image path and its result directory;",
+		"without {image} the image path is appended.")
+	parseArgs(fs, args, 1)
+
+	if len(commands) > 0 && *out == "" {
+		log.Fatal("-run needs -out")
+	}
+	if *out != "" {
+		logIfErr(os.MkdirAll(*out, 0o755))
+	}
+	w := &watcher{
+		dir:         fs.Arg(0),
+		out:         *out,
+		commands:    commands,
+		keep:        *keep,
+		metricsFile: *metricsFile,
+		metricsOpts: metricsOpts,
+		failed:      make(map[string]bool),
+	}
+	logIfErr(w.resume())
+	if *history != "" {
+		db, err := openHistory(*history)
+		logIfErr(err)
+		defer db.Close()
+		w.history = db
+	}
+	if *listen != "" && !*once {
+		w.metrics = &metricsHandler{}
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", w.metrics)
+		go func() { log.Fatal(http.ListenAndServe(*listen, mux)) }()
+		infof("serving metrics on %s/metrics", *listen)
+	}
+
+	for {
+		logIfErr(w.poll())
+		if *once {
+			if w.failures > 0 {
+				os.Exit(exitError)
+			}
+			return
+		}
+		time.Sleep(*interval)
+	}
+}
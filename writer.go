@@ -0,0 +1,402 @@
+package main
+
+import (
+	"bufio"
+	"crypto/md5"
+	"encoding/binary"
+	"errors"
+	"flag"
+	"fmt"
+	"hash"
+	"io"
+	"log"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	pb "hdfs-fsimage-parse-go/pkg/hadoop_hdfs_fsimage"
+
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+)
+
+// Versions written into the FileSummary of images built from scratch:
+// FSImageUtil.FILE_VERSION and the layout version of Hadoop 3.3.
+const (
+	defaultOndiskVersion = 1
+	defaultLayoutVersion = -66
+)
+
+// sectionOrder is the order in which FSImageFormatProtobuf.Saver writes
+// sections. The loader sorts them by name itself, so this only keeps
+// written images looking like the namenode's.
+var sectionOrder = []string{
+	"NS_INFO", "ERASURE_CODING", "INODE", "INODE_DIR", "FILES_UNDERCONSTRUCTION", "SNAPSHOT",
+	"SNAPSHOT_DIFF", "INODE_REFERENCE", "SECRET_MANAGER", "CACHE_MANAGER", "STRING_TABLE",
+}
+
+// ImageWriter writes a protobuf fsimage: the magic header, sections of
+// varint-delimited records and the FileSummary trailer followed by its
+// 4-byte big-endian length. It keeps the MD5 of everything written.
+type ImageWriter struct {
+	w       *bufio.Writer
+	md5     hash.Hash
+	offset  uint64
+	summary *pb.FileSummary
+	section *pb.FileSummary_Section
+	buf     []byte
+}
+
+// NewImageWriter writes the magic header to w. Sections are written
+// uncompressed.
+func NewImageWriter(w io.Writer, ondiskVersion, layoutVersion uint32) (*ImageWriter, error) {
+	h := md5.New()
+	iw := &ImageWriter{
+		w:       bufio.NewWriterSize(io.MultiWriter(w, h), 1<<20),
+		md5:     h,
+		summary: &pb.FileSummary{OndiskVersion: proto.Uint32(ondiskVersion), LayoutVersion: proto.Uint32(layoutVersion)},
+	}
+	return iw, iw.write([]byte(imageMagic))
+}
+
+func (iw *ImageWriter) write(p []byte) error {
+	n, err := iw.w.Write(p)
+	iw.offset += uint64(n)
+	return err
+}
+
+// BeginSection ends the current section, if any, and starts name.
+func (iw *ImageWriter) BeginSection(name string) {
+	iw.EndSection()
+	iw.section = &pb.FileSummary_Section{Name: proto.String(name), Offset: proto.Uint64(iw.offset)}
+}
+
+// EndSection records the current section in the summary.
+func (iw *ImageWriter) EndSection() {
+	if iw.section == nil {
+		return
+	}
+	iw.section.Length = proto.Uint64(iw.offset - iw.section.GetOffset())
+	iw.summary.Sections = append(iw.summary.Sections, iw.section)
+	iw.section = nil
+}
+
+// WriteRecord appends m to the current section as a delimited record.
+func (iw *ImageWriter) WriteRecord(m proto.Message) error {
+	if iw.section == nil {
+		return errors.New("record written outside of a section")
+	}
+	var err error
+	iw.buf, err = proto.MarshalOptions{Deterministic: true}.MarshalAppend(iw.buf[:0], m)
+	if err != nil {
+		return err
+	}
+	if err := iw.write(protowire.AppendVarint(nil, uint64(len(iw.buf)))); err != nil {
+		return err
+	}
+	return iw.write(iw.buf)
+}
+
+// WriteRaw appends bytes that are already framed, such as a section
+// copied from another image.
+func (iw *ImageWriter) WriteRaw(r io.Reader) error {
+	if iw.section == nil {
+		return errors.New("record written outside of a section")
+	}
+	n, err := io.Copy(iw.w, r)
+	iw.offset += uint64(n)
+	return err
+}
+
+// Close ends the last section and writes the summary trailer. It does
+// not close the underlying writer.
+func (iw *ImageWriter) Close() error {
+	iw.EndSection()
+	summary, err := proto.MarshalOptions{Deterministic: true}.Marshal(iw.summary)
+	if err != nil {
+		return err
+	}
+	trailer := protowire.AppendVarint(nil, uint64(len(summary)))
+	trailer = append(trailer, summary...)
+	trailer = binary.BigEndian.AppendUint32(trailer, uint32(len(trailer)))
+	if err := iw.write(trailer); err != nil {
+		return err
+	}
+	return iw.w.Flush()
+}
+
+// Sum is the MD5 of the image, valid after Close.
+func (iw *ImageWriter) Sum() []byte {
+	return iw.md5.Sum(nil)
+}
+
+// RawSection is a section copied verbatim from another image.
+type RawSection struct {
+	Name   string
+	Source io.ReaderAt
+	Offset int64
+	Length int64
+}
+
+// Image is what writeImage serializes: the namespace held in inodeData,
+// stringMap and Namespace, and the sections the model does not cover,
+// either copied unchanged from another image or built record by record.
+type Image struct {
+	OndiskVersion  uint32
+	LayoutVersion  uint32
+	NsInfo         *pb.NameSystemSection
+	LastInodeId    uint64
+	StringMaskBits uint32
+	Namespace      *Namespace
+	Raw            []RawSection
+	Records        []RecordSection
+}
+
+// RecordSection is a section given as its records, header first.
+type RecordSection struct {
+	Name    string
+	Records []proto.Message
+}
+
+// newImage returns an empty image carrying the versions of a current
+// namenode; the caller fills inodeData, stringMap and the namespace.
+func newImage() *Image {
+	layoutVersion := int32(defaultLayoutVersion)
+	return &Image{
+		OndiskVersion: defaultOndiskVersion,
+		LayoutVersion: uint32(layoutVersion),
+		NsInfo:        &pb.NameSystemSection{},
+		Namespace:     &Namespace{},
+	}
+}
+
+// loadImage loads the namespace of an image like loadNamespace and
+// keeps the headers and remaining sections needed to write it back.
+// Parallel-load sub-sections (INODE_SUB, ...) index into the sections
+// they belong to and are dropped; the namenode loads serially without
+// them.
+func loadImage(f *os.File, sectionMap map[string]*pb.FileSummary_Section) (*Image, error) {
+	fInfo, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	summary, _, err := readFileSummary(f, fInfo.Size())
+	if err != nil {
+		return nil, err
+	}
+	if summary.GetCodec() != "" {
+		return nil, fmt.Errorf("image is compressed with %s, only uncompressed images can be rewritten", summary.GetCodec())
+	}
+	ns, err := loadNamespace(f, sectionMap)
+	if err != nil {
+		return nil, err
+	}
+	img := &Image{OndiskVersion: summary.GetOndiskVersion(), LayoutVersion: summary.GetLayoutVersion(), Namespace: ns}
+
+	if img.NsInfo, err = parseNameSystemSection(sectionMap["NS_INFO"], f); err != nil {
+		return nil, err
+	}
+	inodeHeader := &pb.INodeSection{}
+	if err := readSectionHeader(sectionMap["INODE"], f, inodeHeader); err != nil {
+		return nil, err
+	}
+	img.LastInodeId = inodeHeader.GetLastInodeId()
+	stringHeader := &pb.StringTableSection{}
+	if err := readSectionHeader(sectionMap["STRING_TABLE"], f, stringHeader); err != nil {
+		return nil, err
+	}
+	img.StringMaskBits = stringHeader.GetMaskBits()
+
+	for _, s := range summary.GetSections() {
+		switch name := s.GetName(); {
+		case name == "NS_INFO" || name == "INODE" || name == "INODE_DIR" || name == "STRING_TABLE":
+		case strings.HasSuffix(name, "_SUB"):
+			debugf("dropping %s", name)
+		default:
+			img.Raw = append(img.Raw, RawSection{Name: name, Source: f, Offset: int64(s.GetOffset()), Length: int64(s.GetLength())})
+		}
+	}
+	return img, nil
+}
+
+// readSectionHeader unmarshals the first record of a section into
+// header without reading the rest.
+func readSectionHeader(info *pb.FileSummary_Section, imageFile io.ReaderAt, header proto.Message) error {
+	if info == nil {
+		return nil
+	}
+	record, _, err := newRecordScanner(info, imageFile).next()
+	if err == io.EOF {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return proto.Unmarshal(record, header)
+}
+
+// writeImage writes img to w in the order the namenode saves sections
+// and returns the MD5 of the image. Inodes and strings are written in
+// id order.
+func writeImage(w io.Writer, img *Image) ([]byte, error) {
+	iw, err := NewImageWriter(w, img.OndiskVersion, img.LayoutVersion)
+	if err != nil {
+		return nil, err
+	}
+	// given sections by name, and the names the namenode does not
+	// know, which come last but one in their original order
+	given := make(map[string]func() error)
+	var unknown []string
+	for _, s := range img.Raw {
+		given[s.Name] = func() error {
+			return iw.WriteRaw(io.NewSectionReader(s.Source, s.Offset, s.Length))
+		}
+		unknown = append(unknown, s.Name)
+	}
+	for _, s := range img.Records {
+		given[s.Name] = func() error {
+			for _, record := range s.Records {
+				if err := iw.WriteRecord(record); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		unknown = append(unknown, s.Name)
+	}
+	unknown = slices.DeleteFunc(unknown, func(name string) bool { return slices.Contains(sectionOrder, name) })
+
+	for _, name := range sectionOrder {
+		if name == "STRING_TABLE" {
+			for _, u := range unknown {
+				iw.BeginSection(u)
+				if err := given[u](); err != nil {
+					return nil, err
+				}
+			}
+		}
+		if write, ok := given[name]; ok {
+			iw.BeginSection(name)
+			if err := write(); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		var err error
+		switch name {
+		case "NS_INFO":
+			iw.BeginSection(name)
+			err = iw.WriteRecord(img.NsInfo)
+		case "INODE":
+			iw.BeginSection(name)
+			err = writeINodeSection(iw, img.LastInodeId)
+		case "INODE_DIR":
+			iw.BeginSection(name)
+			err = writeINodeDirectorySection(iw, img.Namespace)
+		case "STRING_TABLE":
+			iw.BeginSection(name)
+			err = writeStringTable(iw, img.StringMaskBits)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := iw.Close(); err != nil {
+		return nil, err
+	}
+	return iw.Sum(), nil
+}
+
+func writeINodeSection(iw *ImageWriter, lastInodeId uint64) error {
+	ids := slices.Sorted(maps.Keys(inodeData))
+	if len(ids) > 0 {
+		lastInodeId = max(lastInodeId, ids[len(ids)-1])
+	}
+	header := &pb.INodeSection{LastInodeId: proto.Uint64(lastInodeId), NumInodes: proto.Uint64(uint64(len(ids)))}
+	if err := iw.WriteRecord(header); err != nil {
+		return err
+	}
+	for _, id := range ids {
+		if err := iw.WriteRecord(inodeData[id]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeINodeDirectorySection(iw *ImageWriter, ns *Namespace) error {
+	var err error
+	ns.forEachDir(func(parent uint64, children []uint64, refChildren []uint32) {
+		if err != nil {
+			return
+		}
+		err = iw.WriteRecord(&pb.INodeDirectorySection_DirEntry{Parent: proto.Uint64(parent), Children: children, RefChildren: refChildren})
+	})
+	return err
+}
+
+func writeStringTable(iw *ImageWriter, maskBits uint32) error {
+	header := &pb.StringTableSection{NumEntry: proto.Uint32(uint32(len(stringMap))), MaskBits: proto.Uint32(maskBits)}
+	if err := iw.WriteRecord(header); err != nil {
+		return err
+	}
+	for _, id := range slices.Sorted(maps.Keys(stringMap)) {
+		if err := iw.WriteRecord(&pb.StringTableSection_Entry{Id: proto.Uint32(id), Str: proto.String(stringMap[id])}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeImageFile writes img to fileName and its MD5 sidecar next to it,
+// as the namenode does. The image is written to a temporary file first
+// so a failed write leaves no partial image behind.
+func writeImageFile(fileName string, img *Image) error {
+	tmp := fileName + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	sum, err := writeImage(f, img)
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, fileName); err != nil {
+		return err
+	}
+	sidecar := fmt.Sprintf("%x *%s\n", sum, filepath.Base(fileName))
+	return os.WriteFile(fileName+".md5", []byte(sidecar), 0o644)
+}
+
+// runRewrite implements the `rewrite` subcommand: load an image and
+// write it back through the writer.
+func runRewrite(args []string) {
+	fs := flag.NewFlagSet("rewrite", flag.ExitOnError)
+	registerParseFlags(fs)
+	registerLogFlags(fs)
+	fs.Usage = commandUsage(fs, "[flags] <fsimage> <output>",
+		"INODE, INODE_DIR, STRING_TABLE and NS_INFO are rebuilt from the loaded namespace,",
+		"other sections are copied unchanged. An .md5 sidecar is written next to the output.")
+	parseArgs(fs, args, 2)
+
+	f, sectionMap, err := openImage(fs.Arg(0))
+	logIfErr(err)
+	defer f.Close()
+	img, err := loadImage(f, sectionMap)
+	logIfErr(err)
+	if parseReport.Total() > 0 {
+		parseReport.Log()
+		log.Fatalf("not writing %s: corrupt records were skipped", fs.Arg(1))
+	}
+	logIfErr(writeImageFile(fs.Arg(1), img))
+	infof("wrote %s: %d inodes, %d strings", fs.Arg(1), len(inodeData), len(stringMap))
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"testing"
+)
+
+// TestRewriteRoundTrip loads a generated image and writes it back, which
+// must reproduce it byte for byte.
+func TestRewriteRoundTrip(t *testing.T) {
+	fileName := writeTestImage(t, testGenerateOptions())
+	want, err := os.ReadFile(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, sectionMap, err := openImage(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	img, err := loadImage(f, sectionMap)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parseReport.Total() > 0 {
+		t.Fatalf("%d corrupt records in a generated image", parseReport.Total())
+	}
+	var got bytes.Buffer
+	if _, err := writeImage(&got, img); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got.Bytes(), want) {
+		t.Errorf("rewritten image differs: %d bytes, generated %d", got.Len(), len(want))
+	}
+}